@@ -0,0 +1,127 @@
+/**
+ * Escape sequence tokenizer.
+ * Splits terminal output into text and the control sequences between it.
+ */
+
+/**
+ * Kind of a token: plain text, Control Sequence, Operating System Command,
+ * Device Control String, APC/PM/SOS string, or another escape sequence
+ */
+export type TokenKind = 'text' | 'csi' | 'osc' | 'dcs' | 'apc' | 'esc';
+
+/**
+ * Token is a piece of terminal output
+ */
+export interface Token {
+  kind: TokenKind;
+  /** The token as it appeared in the input */
+  value: string;
+  /** Parameter and intermediate bytes of CSI and ESC sequences, payload of strings */
+  params: string;
+  /** Final byte of CSI and ESC sequences, empty for other tokens */
+  final: string;
+}
+
+// Sequence kinds by the byte following ESC
+const stringKinds: { [key: string]: TokenKind } = {
+  ']': 'osc',
+  P: 'dcs',
+  _: 'apc',
+  '^': 'apc',
+  X: 'apc',
+};
+
+/**
+ * Tokenize splits s into text and escape sequence tokens. Unterminated sequences
+ * at the end of s run to its end.
+ */
+export function tokenize(s: string): Token[] {
+  const tokens: Token[] = [];
+  let pos = 0;
+
+  while (pos < s.length) {
+    const esc = s.indexOf('\x1b', pos);
+    if (esc !== pos) {
+      const end = esc < 0 ? s.length : esc;
+      tokens.push({ kind: 'text', value: s.slice(pos, end), params: '', final: '' });
+      pos = end;
+      continue;
+    }
+
+    const next = s.charAt(pos + 1);
+    let end: number;
+    if (next === '[') {
+      end = readCSI(s, pos + 2);
+      const body = s.slice(pos + 2, end);
+      const final = end > pos + 2 && isFinal(s.charCodeAt(end - 1)) ? body.slice(-1) : '';
+      const params = final ? body.slice(0, -1) : body;
+      tokens.push({ kind: 'csi', value: s.slice(pos, end), params, final });
+    } else if (stringKinds[next]) {
+      const [payloadEnd, stringEnd] = readString(s, pos + 2, next === ']');
+      tokens.push({
+        kind: stringKinds[next] ?? 'osc',
+        value: s.slice(pos, stringEnd),
+        params: s.slice(pos + 2, payloadEnd),
+        final: '',
+      });
+      end = stringEnd;
+    } else {
+      // ESC, intermediate bytes, final byte
+      end = pos + 1;
+      while (end < s.length && s.charCodeAt(end) >= 0x20 && s.charCodeAt(end) <= 0x2f) {
+        end++;
+      }
+      const final = end < s.length ? s.charAt(end) : '';
+      tokens.push({
+        kind: 'esc',
+        value: s.slice(pos, end + 1),
+        params: s.slice(pos + 1, end),
+        final,
+      });
+      end = Math.min(end + 1, s.length);
+    }
+    pos = end;
+  }
+
+  return tokens;
+}
+
+/**
+ * StripAnsi removes all escape sequences from s, leaving the plain text
+ */
+export function stripAnsi(s: string): string {
+  if (!s.includes('\x1b')) {
+    return s;
+  }
+  return tokenize(s)
+    .filter((t) => t.kind === 'text')
+    .map((t) => t.value)
+    .join('');
+}
+
+function isFinal(c: number): boolean {
+  return c >= 0x40 && c <= 0x7e;
+}
+
+// Returns the index after the CSI final byte
+function readCSI(s: string, pos: number): number {
+  while (pos < s.length) {
+    if (isFinal(s.charCodeAt(pos++))) {
+      return pos;
+    }
+  }
+  return pos;
+}
+
+// Returns the end of the payload and the index after the terminator (ST, or BEL for OSC)
+function readString(s: string, pos: number, bel: boolean): [number, number] {
+  for (let i = pos; i < s.length; i++) {
+    if (bel && s.charAt(i) === '\x07') {
+      return [i, i + 1];
+    }
+    if (s.charAt(i) === '\x1b' && s.charAt(i + 1) === '\\') {
+      return [i, i + 2];
+    }
+  }
+  return [s.length, s.length];
+}
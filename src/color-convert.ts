@@ -0,0 +1,467 @@
+/**
+ * Color conversion between profiles.
+ * Port of the Convert, hexToANSI256Color and ansi256ToANSIColor functions of
+ * github.com/muesli/termenv to TypeScript, with a choice of color distance.
+ */
+
+import { Color as ColorfulColor } from '@tsports/go-colorful';
+import { DefaultPalette, type Palette } from './palette.js';
+import {
+  ANSI256Color,
+  ANSIColor,
+  type Color,
+  convertToRGB,
+  NoColor,
+  Profile,
+  RGBColor,
+} from './types.js';
+
+/**
+ * RGBChannels is a color with red, green and blue channels between 0 and 1, like
+ * a go-colorful Color
+ */
+export interface RGBChannels {
+  r: number;
+  g: number;
+  b: number;
+}
+
+/**
+ * ColorDistance measures how different two colors are; only the order of the
+ * distances matters
+ */
+export type ColorDistance = (a: RGBChannels, b: RGBChannels) => number;
+
+/**
+ * ColorMetricName names a built-in color distance: 'hsluv' like Go,
+ * 'ciede2000' (CIE ΔE 2000), 'oklab' (Euclidean in OKLab) or 'redmean'
+ * (weighted RGB)
+ */
+export type ColorMetricName = 'hsluv' | 'ciede2000' | 'oklab' | 'redmean';
+
+/**
+ * ColorMetric picks the nearest color when a color is downsampled: a built-in
+ * metric or a distance function
+ */
+export type ColorMetric = ColorMetricName | ColorDistance;
+
+function colorful(c: RGBChannels): ColorfulColor {
+  return c instanceof ColorfulColor ? c : new ColorfulColor(c.r, c.g, c.b);
+}
+
+function linear(v: number): number {
+  return v <= 0.04045 ? v / 12.92 : ((v + 0.055) / 1.055) ** 2.4;
+}
+
+// CIE L*a*b* with the D65 white point
+function lab(c: RGBChannels): [number, number, number] {
+  const r = linear(c.r);
+  const g = linear(c.g);
+  const b = linear(c.b);
+  const x = (0.4124564 * r + 0.3575761 * g + 0.1804375 * b) / 0.95047;
+  const y = 0.2126729 * r + 0.7151522 * g + 0.072175 * b;
+  const z = (0.0193339 * r + 0.119192 * g + 0.9503041 * b) / 1.08883;
+  const f = (t: number) => (t > (6 / 29) ** 3 ? Math.cbrt(t) : t / (3 * (6 / 29) ** 2) + 4 / 29);
+  return [116 * f(y) - 16, 500 * (f(x) - f(y)), 200 * (f(y) - f(z))];
+}
+
+function oklab(c: RGBChannels): [number, number, number] {
+  const r = linear(c.r);
+  const g = linear(c.g);
+  const b = linear(c.b);
+  const l = Math.cbrt(0.4122214708 * r + 0.5363325363 * g + 0.0514459929 * b);
+  const m = Math.cbrt(0.2119034982 * r + 0.6806995451 * g + 0.1073969566 * b);
+  const s = Math.cbrt(0.0883024619 * r + 0.2817188376 * g + 0.6299787005 * b);
+  return [
+    0.2104542553 * l + 0.793617785 * m - 0.0040720468 * s,
+    1.9779984951 * l - 2.428592205 * m + 0.4505937099 * s,
+    0.0259040371 * l + 0.7827717662 * m - 0.808675766 * s,
+  ];
+}
+
+const degrees = (rad: number) => (rad * 180) / Math.PI;
+const radians = (deg: number) => (deg * Math.PI) / 180;
+
+// CIEDE2000 color difference of two L*a*b* colors, see Sharma, Wu and Dalal,
+// "The CIEDE2000 Color-Difference Formula" (2005)
+function ciede2000(
+  [l1, a1, b1]: [number, number, number],
+  [l2, a2, b2]: [number, number, number]
+): number {
+  const cBar = (Math.hypot(a1, b1) + Math.hypot(a2, b2)) / 2;
+  const g = 0.5 * (1 - Math.sqrt(cBar ** 7 / (cBar ** 7 + 25 ** 7)));
+  const a1p = (1 + g) * a1;
+  const a2p = (1 + g) * a2;
+  const c1p = Math.hypot(a1p, b1);
+  const c2p = Math.hypot(a2p, b2);
+  const hue = (b: number, a: number) =>
+    b === 0 && a === 0 ? 0 : (degrees(Math.atan2(b, a)) + 360) % 360;
+  const h1p = hue(b1, a1p);
+  const h2p = hue(b2, a2p);
+
+  let dhp = 0;
+  if (c1p * c2p !== 0) {
+    dhp = h2p - h1p;
+    if (dhp > 180) {
+      dhp -= 360;
+    } else if (dhp < -180) {
+      dhp += 360;
+    }
+  }
+  const dLp = l2 - l1;
+  const dCp = c2p - c1p;
+  const dHp = 2 * Math.sqrt(c1p * c2p) * Math.sin(radians(dhp / 2));
+
+  const lBarp = (l1 + l2) / 2;
+  const cBarp = (c1p + c2p) / 2;
+  let hBarp = h1p + h2p;
+  if (c1p * c2p !== 0) {
+    if (Math.abs(h1p - h2p) <= 180) {
+      hBarp /= 2;
+    } else {
+      hBarp = (hBarp + (hBarp < 360 ? 360 : -360)) / 2;
+    }
+  }
+
+  const t =
+    1 -
+    0.17 * Math.cos(radians(hBarp - 30)) +
+    0.24 * Math.cos(radians(2 * hBarp)) +
+    0.32 * Math.cos(radians(3 * hBarp + 6)) -
+    0.2 * Math.cos(radians(4 * hBarp - 63));
+  const dTheta = 30 * Math.exp(-(((hBarp - 275) / 25) ** 2));
+  const rc = 2 * Math.sqrt(cBarp ** 7 / (cBarp ** 7 + 25 ** 7));
+  const sl = 1 + (0.015 * (lBarp - 50) ** 2) / Math.sqrt(20 + (lBarp - 50) ** 2);
+  const sc = 1 + 0.045 * cBarp;
+  const sh = 1 + 0.015 * cBarp * t;
+  const rt = -Math.sin(radians(2 * dTheta)) * rc;
+
+  return Math.sqrt(
+    (dLp / sl) ** 2 + (dCp / sc) ** 2 + (dHp / sh) ** 2 + rt * (dCp / sc) * (dHp / sh)
+  );
+}
+
+/**
+ * ColorMetrics are the built-in color distances
+ */
+export const ColorMetrics: { readonly [name in ColorMetricName]: ColorDistance } = {
+  hsluv: (a, b) => colorful(a).distanceHSLuv(colorful(b)),
+  ciede2000: (a, b) => ciede2000(lab(a), lab(b)),
+  oklab: (a, b) => {
+    const [l1, a1, b1] = oklab(a);
+    const [l2, a2, b2] = oklab(b);
+    return Math.hypot(l1 - l2, a1 - a2, b1 - b2);
+  },
+  // "redmean" from https://www.compuphase.com/cmetric.htm
+  redmean: (a, b) => {
+    const rMean = ((a.r + b.r) / 2) * 255;
+    const dr = (a.r - b.r) * 255;
+    const dg = (a.g - b.g) * 255;
+    const db = (a.b - b.b) * 255;
+    return Math.sqrt(
+      (2 + rMean / 256) * dr ** 2 + 4 * dg ** 2 + (2 + (255 - rMean) / 256) * db ** 2
+    );
+  },
+};
+
+function distance(metric: ColorMetric): ColorDistance {
+  return typeof metric === 'function' ? metric : ColorMetrics[metric];
+}
+
+/**
+ * ConversionOptions configures the caching of color conversion
+ */
+export interface ConversionOptions {
+  /** Conversions kept, dropping the least recently used first; 0 disables the cache */
+  cacheSize?: number;
+  /** Look ANSI256 to ANSI conversions up in a table computed once per built-in metric */
+  ansiTable?: boolean;
+}
+
+/**
+ * ConversionCacheStats reports the use of the conversion cache
+ */
+export interface ConversionCacheStats {
+  size: number;
+  maxSize: number;
+  hits: number;
+  misses: number;
+}
+
+/**
+ * DefaultConversionCacheSize is the number of conversions cached by default
+ */
+export const DefaultConversionCacheSize = 1024;
+
+// Least recently used cache of converted color values. A Map iterates in
+// insertion order, so the first key is the least recently used one.
+class ConversionCache {
+  private entries = new Map<string, number>();
+  hits = 0;
+  misses = 0;
+
+  constructor(public maxSize: number) {}
+
+  get size(): number {
+    return this.entries.size;
+  }
+
+  lookup(key: string, convert: () => number): number {
+    const cached = this.entries.get(key);
+    if (cached !== undefined) {
+      this.hits++;
+      this.entries.delete(key);
+      this.entries.set(key, cached);
+      return cached;
+    }
+
+    this.misses++;
+    const value = convert();
+    if (this.maxSize > 0) {
+      this.entries.set(key, value);
+      this.trim();
+    }
+    return value;
+  }
+
+  resize(maxSize: number): void {
+    this.maxSize = Math.max(maxSize, 0);
+    this.trim();
+  }
+
+  clear(): void {
+    this.entries.clear();
+    this.hits = 0;
+    this.misses = 0;
+  }
+
+  private trim(): void {
+    for (const key of this.entries.keys()) {
+      if (this.entries.size <= this.maxSize) {
+        break;
+      }
+      this.entries.delete(key);
+    }
+  }
+}
+
+const cache = new ConversionCache(DefaultConversionCacheSize);
+// ANSI tables by palette and metric, dropped with their palette
+const ansiTables = new WeakMap<Palette, Map<ColorMetricName, number[]>>();
+let useANSITable = false;
+
+// Distance functions are told apart in cache keys by an id
+const distanceIds = new WeakMap<ColorDistance, number>();
+let lastDistanceId = 0;
+
+function metricKey(metric: ColorMetric): string {
+  if (typeof metric === 'string') {
+    return metric;
+  }
+  let id = distanceIds.get(metric);
+  if (id === undefined) {
+    lastDistanceId += 1;
+    id = lastDistanceId;
+    distanceIds.set(metric, id);
+  }
+  return `func${id}`;
+}
+
+/**
+ * ConfigureColorConversion sets the size of the conversion cache, by default
+ * DefaultConversionCacheSize, and whether ANSI256 to ANSI conversions use a
+ * precomputed table. Building the table for the default metric takes 4096
+ * distances, so it is worth it for programs that convert many colors.
+ */
+export function configureColorConversion(options: ConversionOptions): void {
+  if (options.cacheSize !== undefined) {
+    cache.resize(options.cacheSize);
+  }
+  if (options.ansiTable !== undefined) {
+    useANSITable = options.ansiTable;
+    if (useANSITable) {
+      ansiTable('hsluv', DefaultPalette);
+    }
+  }
+}
+
+/**
+ * ClearConversionCache empties the conversion cache and resets its statistics
+ */
+export function clearConversionCache(): void {
+  cache.clear();
+}
+
+/**
+ * ConversionCacheStats returns the size and hit counts of the conversion cache
+ */
+export function conversionCacheStats(): ConversionCacheStats {
+  return { size: cache.size, maxSize: cache.maxSize, hits: cache.hits, misses: cache.misses };
+}
+
+/**
+ * RGBToANSI256 returns the ANSI256 color nearest to c: the nearest color of the
+ * 6x6x6 cube or the gray ramp, whichever is closer by the metric. A palette that
+ * redefines colors 16-255 is searched for the nearest of those instead.
+ * Port of Go hexToANSI256Color.
+ */
+export function rgbToANSI256(
+  c: RGBChannels,
+  metric: ColorMetric = 'hsluv',
+  palette: Palette = DefaultPalette
+): ANSI256Color {
+  if (palette.customANSI256) {
+    return new ANSI256Color(nearestColor(c, metric, palette, 16, 255));
+  }
+
+  const v2ci = (v: number): number => {
+    if (v < 48) return 0;
+    if (v < 115) return 1;
+    return Math.trunc((v - 35) / 40);
+  };
+
+  // Calculate the nearest 0-based color index at 16..231
+  const r = v2ci(c.r * 255); // 0..5 each
+  const g = v2ci(c.g * 255);
+  const b = v2ci(c.b * 255);
+  const ci = 36 * r + 6 * g + b; // 0..215
+
+  // Calculate the represented colors back from the index
+  const i2cv = [0, 0x5f, 0x87, 0xaf, 0xd7, 0xff];
+  const cr = i2cv[r] ?? 0; // r/g/b, 0..255 each
+  const cg = i2cv[g] ?? 0;
+  const cb = i2cv[b] ?? 0;
+
+  // Calculate the nearest 0-based gray index at 232..255. Like Go, this averages
+  // the cube indices in integer math, so the gray candidate is always 232.
+  const average = Math.trunc((r + g + b) / 3);
+  const grayIdx = average > 238 ? 23 : Math.trunc((average - 3) / 10); // 0..23
+  const gv = 8 + 10 * grayIdx; // same value for r/g/b, 0..255
+
+  // Return the one which is nearer to the original input rgb value
+  const d = distance(metric);
+  const colorDist = d(c, { r: cr / 255, g: cg / 255, b: cb / 255 });
+  const grayDist = d(c, { r: gv / 255, g: gv / 255, b: gv / 255 });
+
+  if (colorDist <= grayDist) {
+    return new ANSI256Color(16 + ci);
+  }
+  return new ANSI256Color(232 + grayIdx);
+}
+
+/**
+ * ANSI256ToANSI returns the ANSI color nearest to c by the metric, comparing the
+ * colors of the palette, by default the xterm colors like Go.
+ * Port of Go ansi256ToANSIColor.
+ */
+export function ansi256ToANSI(
+  c: ANSI256Color,
+  metric: ColorMetric = 'hsluv',
+  palette: Palette = DefaultPalette
+): ANSIColor {
+  if (useANSITable && typeof metric === 'string') {
+    return new ANSIColor(ansiTable(metric, palette)[c.value] ?? 0);
+  }
+  return new ANSIColor(nearestANSI(palette.rgb(c.value), metric, palette));
+}
+
+// Index of the first 16 colors of the palette nearest to c
+function nearestANSI(c: RGBChannels | undefined, metric: ColorMetric, palette: Palette): number {
+  return c ? nearestColor(c, metric, palette, 0, 15) : 0;
+}
+
+// Index of the palette colors first..last nearest to c
+function nearestColor(
+  c: RGBChannels,
+  metric: ColorMetric,
+  palette: Palette,
+  first: number,
+  last: number
+): number {
+  const d = distance(metric);
+  let result = first;
+  let minDistance = Number.MAX_VALUE;
+  for (let i = first; i <= last; i++) {
+    const target = palette.rgb(i);
+    if (!target) continue;
+
+    const dist = d(c, target);
+    if (dist < minDistance) {
+      minDistance = dist;
+      result = i;
+    }
+  }
+  return result;
+}
+
+// The nearest ANSI color of every ANSI256 color, computed on first use
+function ansiTable(metric: ColorMetricName, palette: Palette): number[] {
+  let tables = ansiTables.get(palette);
+  if (!tables) {
+    tables = new Map();
+    ansiTables.set(palette, tables);
+  }
+  let table = tables.get(metric);
+  if (!table) {
+    table = Array.from({ length: 256 }, (_, i) => nearestANSI(palette.rgb(i), metric, palette));
+    tables.set(metric, table);
+  }
+  return table;
+}
+
+// ANSI color of an RGB color. With the xterm ANSI colors it goes through the
+// nearest ANSI256 color like Go; custom ones are compared with the color itself.
+function rgbToANSI(rgb: RGBChannels, metric: ColorMetric, palette: Palette): number {
+  if (palette.customANSI) {
+    return nearestANSI(rgb, metric, palette);
+  }
+  return ansi256ToANSI(rgbToANSI256(rgb, metric, palette), metric, palette).value;
+}
+
+/**
+ * ConvertColor transforms a color to one the profile supports, downsampling with
+ * the metric to the colors of the palette. Downsampled colors are cached, see
+ * configureColorConversion. Port of Go Profile.Convert.
+ */
+export function convertColor(
+  profile: Profile,
+  c: Color,
+  metric: ColorMetric = 'hsluv',
+  palette: Palette = DefaultPalette
+): Color {
+  if (profile === Profile.Ascii) {
+    return new NoColor();
+  }
+
+  const key = `${metricKey(metric)}:${palette.id}:${profile}:`;
+  if (c instanceof ANSI256Color) {
+    if (profile !== Profile.ANSI) {
+      return c;
+    }
+    const value = cache.lookup(key + c.value, () => ansi256ToANSI(c, metric, palette).value);
+    return new ANSIColor(value);
+  }
+
+  if (c instanceof RGBColor) {
+    if (profile === Profile.TrueColor) {
+      return convertToRGB(c) ? c : new NoColor();
+    }
+
+    // -1 for colors without RGB channels
+    const value = cache.lookup(key + c.hex.toLowerCase(), () => {
+      const rgb = convertToRGB(c);
+      if (!rgb) {
+        return -1;
+      }
+      return profile === Profile.ANSI
+        ? rgbToANSI(rgb, metric, palette)
+        : rgbToANSI256(rgb, metric, palette).value;
+    });
+    if (value < 0) {
+      return new NoColor();
+    }
+    return profile === Profile.ANSI ? new ANSIColor(value) : new ANSI256Color(value);
+  }
+
+  return c;
+}
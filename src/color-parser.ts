@@ -0,0 +1,353 @@
+/**
+ * Color string parsing.
+ * Understands ANSI indices, hex colors, CSS and X11 color names, the CSS rgb(),
+ * hsl() and hwb() functions, and the X11 rgb: and rgbi: forms that terminals
+ * use in OSC color reports.
+ */
+
+import { CSSColors, X11Colors } from './color-names.js';
+import { ANSI256Color, ANSIColor, type Color, InvalidColorError, RGBColor } from './types.js';
+
+/**
+ * ParseColorOptions configures parseColor
+ */
+export interface ParseColorOptions {
+  /** Throw an InvalidColorError saying what is wrong instead of returning null */
+  strict?: boolean;
+}
+
+// A CSS number, optionally a percentage or with a unit
+const numberPattern = /^([+-]?(?:\d+\.?\d*|\.\d+)(?:e[+-]?\d+)?)(%|deg|grad|rad|turn)?$/i;
+
+function invalidColor(s: string, reason: string): InvalidColorError {
+  return new InvalidColorError(`invalid color ${JSON.stringify(s)}: ${reason}`);
+}
+
+function clamp(n: number): number {
+  return Math.min(Math.max(n, 0), 1);
+}
+
+function hex2(n: number): string {
+  return Math.round(clamp(n) * 255)
+    .toString(16)
+    .padStart(2, '0');
+}
+
+// RGB color from channels in [0, 1]; out of range values are clamped
+function rgb(r: number, g: number, b: number): RGBColor {
+  return new RGBColor(`#${hex2(r)}${hex2(g)}${hex2(b)}`);
+}
+
+// Parse a number, with its unit if any. "none" is 0, like in CSS.
+function parseNumber(s: string): { value: number; unit: string } | null {
+  if (s.toLowerCase() === 'none') {
+    return { value: 0, unit: '' };
+  }
+  const m = numberPattern.exec(s);
+  if (!m) {
+    return null;
+  }
+  return { value: Number(m[1]), unit: (m[2] ?? '').toLowerCase() };
+}
+
+// A channel of rgb(): 0-255 or a percentage
+function parseChannel(s: string): number | null {
+  const n = parseNumber(s);
+  if (!n || (n.unit !== '' && n.unit !== '%')) {
+    return null;
+  }
+  return n.unit === '%' ? n.value / 100 : n.value / 255;
+}
+
+// A percentage of hsl() and hwb(); plain numbers count as percentages
+function parsePercent(s: string): number | null {
+  const n = parseNumber(s);
+  if (!n || (n.unit !== '' && n.unit !== '%')) {
+    return null;
+  }
+  return n.value / 100;
+}
+
+// A hue in degrees
+function parseHue(s: string): number | null {
+  const n = parseNumber(s);
+  if (!n || n.unit === '%') {
+    return null;
+  }
+  const degrees: { [unit: string]: number } = {
+    '': 1,
+    deg: 1,
+    grad: 0.9,
+    rad: 180 / Math.PI,
+    turn: 360,
+  };
+  return n.value * (degrees[n.unit] ?? 1);
+}
+
+// Channels in [0, 1] of a hue (degrees), saturation and lightness in [0, 1]
+function hslChannels(h: number, s: number, l: number): [number, number, number] {
+  const hue = (((h % 360) + 360) % 360) / 30;
+  const a = s * Math.min(l, 1 - l);
+  const f = (n: number) => {
+    const k = (n + hue) % 12;
+    return l - a * Math.max(-1, Math.min(k - 3, 9 - k, 1));
+  };
+  return [f(0), f(8), f(4)];
+}
+
+function hwb(h: number, w: number, b: number): RGBColor {
+  const white = clamp(w);
+  const black = clamp(b);
+  if (white + black >= 1) {
+    const gray = white / (white + black);
+    return rgb(gray, gray, gray);
+  }
+  const [r = 0, g = 0, bl = 0] = hslChannels(h, 1, 0.5).map((c) => c * (1 - white - black) + white);
+  return rgb(r, g, bl);
+}
+
+type ArgParser = (s: string) => number | null;
+
+// A CSS color function: how to read its three values and make a color of them
+interface ColorFunction {
+  args: [ArgParser, ArgParser, ArgParser];
+  color: (a: number, b: number, c: number) => RGBColor;
+}
+
+const rgbFunction: ColorFunction = {
+  args: [parseChannel, parseChannel, parseChannel],
+  color: rgb,
+};
+
+const hslFunction: ColorFunction = {
+  args: [parseHue, parsePercent, parsePercent],
+  color: (h, s, l) => rgb(...hslChannels(h, clamp(s), clamp(l))),
+};
+
+const colorFunctions: { [name: string]: ColorFunction } = {
+  rgb: rgbFunction,
+  rgba: rgbFunction,
+  hsl: hslFunction,
+  hsla: hslFunction,
+  hwb: { args: [parseHue, parsePercent, parsePercent], color: hwb },
+};
+
+// Arguments of a CSS color function; the alpha after / or a fourth comma is dropped
+function functionArgs(body: string): string[] | null {
+  const [channels = '', alpha] = body.split('/');
+  const args = channels.includes(',')
+    ? channels.split(',').map((arg) => arg.trim())
+    : channels.trim().split(/\s+/);
+
+  if (alpha !== undefined && (args.length !== 3 || !parseNumber(alpha.trim()))) {
+    return null;
+  }
+  if (args.length === 4 && body.includes(',') && parseNumber(args[3] ?? '')) {
+    args.pop();
+  }
+  return args.length === 3 ? args : null;
+}
+
+function parseFunction(s: string): RGBColor {
+  const m = /^([a-z]+)\(\s*(.*?)\s*\)$/i.exec(s);
+  if (!m) {
+    throw invalidColor(s, 'malformed color function');
+  }
+  const name = (m[1] ?? '').toLowerCase();
+  const fn = Object.hasOwn(colorFunctions, name) ? colorFunctions[name] : undefined;
+  if (!fn) {
+    throw invalidColor(s, `unknown color function ${name}()`);
+  }
+  const args = functionArgs(m[2] ?? '');
+  if (!args) {
+    throw invalidColor(s, `${name}() takes 3 values and an optional alpha`);
+  }
+
+  const values = args.map((arg, i) => {
+    const value = fn.args[i]?.(arg) ?? null;
+    if (value === null) {
+      throw invalidColor(s, `invalid ${name}() value ${JSON.stringify(arg)}`);
+    }
+    return value;
+  });
+  const [a = 0, b = 0, c = 0] = values;
+  return fn.color(a, b, c);
+}
+
+// X11 rgb:r/g/b with 1 to 4 hex digits per channel, scaled to their range, and
+// rgbi:r/g/b with intensities between 0 and 1
+function parseX11(s: string): RGBColor {
+  const space = s.slice(0, s.indexOf(':')).toLowerCase();
+  if (space === 'rgb') {
+    const m = /^rgb:([0-9a-f]{1,4})\/([0-9a-f]{1,4})\/([0-9a-f]{1,4})$/i.exec(s);
+    if (!m) {
+      throw invalidColor(s, 'rgb: takes 3 channels of 1 to 4 hex digits, like rgb:ff/80/00');
+    }
+    const [r = 0, g = 0, b = 0] = m.slice(1).map((h) => parseInt(h, 16) / (16 ** h.length - 1));
+    return rgb(r, g, b);
+  }
+  if (space === 'rgbi') {
+    const [r, g, b, extra] = s.slice(5).split('/').map((v) => {
+      const n = parseNumber(v);
+      return n && n.unit === '' && n.value >= 0 && n.value <= 1 ? n.value : null;
+    });
+    if (r == null || g == null || b == null || extra !== undefined) {
+      throw invalidColor(s, 'rgbi: takes 3 intensities between 0 and 1, like rgbi:1/0.5/0');
+    }
+    return rgb(r, g, b);
+  }
+  throw invalidColor(s, `unknown color space ${space}:`);
+}
+
+// The first character of digits that isn't a hex digit
+function badHexDigit(s: string, digits: string): InvalidColorError | null {
+  const bad = /[^0-9a-f]/i.exec(digits);
+  return bad ? invalidColor(s, `${JSON.stringify(bad[0])} is not a hex digit`) : null;
+}
+
+// #rgb, #rgba, #rrggbb and #rrggbbaa like CSS, and #rrrgggbbb and #rrrrggggbbbb
+// like X11, which uses the most significant digits of each channel
+function parseHex(s: string): RGBColor {
+  const bad = badHexDigit(s, s.slice(1));
+  if (bad) {
+    throw bad;
+  }
+  const digits = s.slice(1).toLowerCase();
+  switch (digits.length) {
+    case 3:
+    case 4:
+      return new RGBColor(`#${[...digits.slice(0, 3)].map((c) => c + c).join('')}`);
+    case 6:
+    case 8:
+      return new RGBColor(`#${digits.slice(0, 6)}`);
+    case 9:
+    case 12: {
+      const n = digits.length / 3;
+      const channels = [0, 1, 2].map((i) => digits.slice(i * n, i * n + 2));
+      return new RGBColor(`#${channels.join('')}`);
+    }
+    default:
+      throw invalidColor(s, `hex colors have 3, 4, 6, 8, 9 or 12 digits, not ${digits.length}`);
+  }
+}
+
+function parseIndex(s: string): Color {
+  const i = Number(s);
+  if (i > 255) {
+    throw invalidColor(s, `color index ${i} is out of range 0-255`);
+  }
+  return i < 16 ? new ANSIColor(i) : new ANSI256Color(i);
+}
+
+/**
+ * ParseNamedColor returns the color with a CSS or X11 name, or null. Names are
+ * case-insensitive and may contain spaces; where CSS and X11 disagree, as for
+ * gray and green, the CSS color is used.
+ */
+export function parseNamedColor(name: string): RGBColor | null {
+  const key = name.toLowerCase().replace(/[\s_]/g, '');
+  const hex = Object.hasOwn(CSSColors, key)
+    ? CSSColors[key]
+    : Object.hasOwn(X11Colors, key)
+      ? X11Colors[key]
+      : undefined;
+  return hex ? new RGBColor(hex) : null;
+}
+
+// Parses a color string, throwing an InvalidColorError if it isn't one
+function parse(s: string): Color {
+  const value = s.trim();
+  if (value === '') {
+    throw invalidColor(s, 'empty color string');
+  }
+  if (/^\d+$/.test(value)) {
+    return parseIndex(value);
+  }
+  if (value.startsWith('#')) {
+    return parseHex(value);
+  }
+  if (value.includes('(')) {
+    return parseFunction(value);
+  }
+  if (value.includes(':')) {
+    return parseX11(value);
+  }
+
+  const named = parseNamedColor(value);
+  if (!named) {
+    throw invalidColor(s, 'unknown color name');
+  }
+  return named;
+}
+
+/**
+ * ParseColor parses a color string, or returns null if it isn't one. It accepts
+ * ANSI color indices (0-15 as ANSIColor, 16-255 as ANSI256Color), hex colors
+ * (#rgb, #rrggbb, with alpha, or X11 #rrrrggggbbbb), CSS and X11 color names,
+ * rgb(), rgba(), hsl(), hsla() and hwb(), and the X11 rgb:rr/gg/bb and
+ * rgbi:r/g/b forms. Alpha is ignored; the result isn't converted to a profile.
+ * With strict set it throws an InvalidColorError instead of returning null.
+ */
+export function parseColor(s: string, options: { strict: true }): Color;
+export function parseColor(s: string, options?: ParseColorOptions): Color | null;
+export function parseColor(s: string, options: ParseColorOptions = {}): Color | null {
+  try {
+    return parse(s);
+  } catch (err) {
+    if (options.strict || !(err instanceof InvalidColorError)) {
+      throw err;
+    }
+    return null;
+  }
+}
+
+/**
+ * ColorFromString is the color of Profile.Color: strings starting with # are
+ * kept as given like in Go, whose hex parsing reads the first six digits, so
+ * #rrrrggggbbbb isn't read the X11 way here and invalid hex colors still produce
+ * an RGBColor; other strings go through parseColor. Strict parsing uses
+ * parseColor for everything and throws an InvalidColorError for what it rejects.
+ */
+export function colorFromString(s: string, strict = false): Color | null {
+  if (strict) {
+    return parseColor(s, { strict });
+  }
+  if (s.length === 0) {
+    return null;
+  }
+  if (s.startsWith('#')) {
+    return new RGBColor(s);
+  }
+  if (/^[+-]?\d/.test(s)) {
+    const i = parseInt(s, 10);
+    return i < 16 ? new ANSIColor(i) : new ANSI256Color(i);
+  }
+  return parseColor(s);
+}
+
+/**
+ * ValidateColor throws an InvalidColorError for colors that would render nothing
+ * or a broken sequence: ANSI colors outside 0-15, ANSI256 colors outside 0-255
+ * and RGB colors that aren't #rgb or #rrggbb
+ */
+export function validateColor(c: Color): void {
+  if (c instanceof ANSIColor && !(Number.isInteger(c.value) && c.value >= 0 && c.value < 16)) {
+    throw new InvalidColorError(`invalid color ${c.value}: ANSI colors are 0-15`);
+  }
+  if (c instanceof ANSI256Color && !(Number.isInteger(c.value) && c.value >= 0 && c.value < 256)) {
+    throw new InvalidColorError(`invalid color ${c.value}: ANSI256 colors are 0-255`);
+  }
+  if (c instanceof RGBColor) {
+    if (!c.hex.startsWith('#')) {
+      throw invalidColor(c.hex, 'RGB colors are hex colors like #rgb or #rrggbb');
+    }
+    const digits = c.hex.slice(1);
+    const bad = badHexDigit(c.hex, digits);
+    if (bad) {
+      throw bad;
+    }
+    if (digits.length !== 3 && digits.length !== 6) {
+      throw invalidColor(c.hex, `RGB colors have 3 or 6 hex digits, not ${digits.length}`);
+    }
+  }
+}
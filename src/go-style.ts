@@ -60,6 +60,7 @@ export {
 export { ProfileUtils } from './profile.js';
 // Re-export classes and functions
 export { Style } from './style.js';
+export { type FuncMap, Template, TemplateError } from './template.js';
 // Re-export color classes using qualified names to avoid conflicts
 // Re-export color constants with Go-style names
 // Re-export utility functions
@@ -122,6 +123,8 @@ import {
 import type { OutputImpl } from './output.js';
 import { newOutput as newOutputFunc } from './output.js';
 import { ProfileUtils } from './profile.js';
+import { type FuncMap, newTemplate as newTemplateFunc, type Template } from './template.js';
+import { templateFuncs as templateFuncsFunc } from './template-funcs.js';
 import type { Color as ColorInterface, OutputOption, Profile } from './types.js';
 
 // Go-compatible API functions with PascalCase naming
@@ -391,4 +394,18 @@ export function CreateNotify(title: string, body: string): string {
   return notificationFunc(title, body);
 }
 
+/**
+ * TemplateFuncs returns template functions for styling text - matches Go TemplateFuncs function
+ */
+export function TemplateFuncs(profile: Profile): FuncMap {
+  return templateFuncsFunc(profile);
+}
+
+/**
+ * NewTemplate allocates a new template - matches Go template.New function
+ */
+export function NewTemplate(name: string): Template {
+  return newTemplateFunc(name);
+}
+
 // This file maintains 100% API compatibility with the original Go package
@@ -3,7 +3,7 @@
  * Port of github.com/muesli/termenv/hyperlink.go
  */
 
-import type { Output } from './types.js';
+import { type Output, sendString } from './types.js';
 
 /**
  * Creates a clickable hyperlink using OSC 8 escape sequences
@@ -33,7 +33,7 @@ export class HyperlinkControl {
    * @returns This instance for chaining
    */
   hyperlink(link: string, name: string): this {
-    this.output.writeString(hyperlink(link, name));
+    sendString(this.output, hyperlink(link, name));
     return this;
   }
 }
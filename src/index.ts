@@ -21,31 +21,184 @@
  * ```
  */
 
+// Export escape sequence tokenizer
+export { stripAnsi, type Token, type TokenKind, tokenize } from './ansi.js';
+// Export color conversion
+export {
+  ansi256ToANSI,
+  type ColorDistance,
+  type ColorMetric,
+  type ColorMetricName,
+  ColorMetrics,
+  type ConversionCacheStats,
+  type ConversionOptions,
+  clearConversionCache,
+  configureColorConversion,
+  conversionCacheStats,
+  convertColor,
+  DefaultConversionCacheSize,
+  type RGBChannels,
+  rgbToANSI256,
+} from './color-convert.js';
+// Export color names and color string parsing
+export { CSSColors, X11Colors } from './color-names.js';
+export {
+  type ParseColorOptions,
+  parseColor,
+  parseNamedColor,
+  validateColor,
+} from './color-parser.js';
 // Export hyperlink functionality
 export { HyperlinkControl, hyperlink } from './hyperlink.js';
+// Export display-width layout
+export {
+  type Alignment,
+  align,
+  type ColumnOptions,
+  center,
+  displayWidth,
+  fitColumns,
+  hardWrap,
+  padEnd,
+  padStart,
+  type TruncateOptions,
+  truncate,
+  type WrapOptions,
+  wordWrap,
+} from './layout.js';
 // Export notification functionality
 export { NotificationControl, notify } from './notification.js';
+// Export inline markup
+export {
+  escapeMarkup,
+  type MarkupElement,
+  type MarkupNode,
+  type MarkupTarget,
+  type MarkupText,
+  markup,
+  markupTag,
+  parseMarkup,
+  parseMarkupColor,
+  parseTag,
+  renderMarkup,
+} from './markup.js';
 // Export output implementation and factory functions
 export {
+  type BufferingOptions,
+  DefaultBufferThreshold,
   defaultOutputInstance,
   newOutput,
   OutputImpl,
+  parseCursorPosition,
+  parseModeReport,
   setDefaultOutput,
+  withBuffering,
   withColorCache,
+  withColorMetric,
   withEnvironment,
+  withErrorHandler,
+  withExtendedUnderline,
+  withHyperlinks,
+  withInput,
+  withLineMode,
+  withLinkFallback,
+  withPalette,
   withProfile,
+  withResetStrategy,
+  withStatusReportTimeout,
+  withStrictColors,
+  withSyncWriter,
+  withTerminalIdentity,
   withTTY,
   withUnsafe,
 } from './output.js';
+// Export terminal color palettes
+export { DefaultPalette, Palette, paletteColorQuery, parsePaletteReport } from './palette.js';
 // Export profile utilities
 export { ProfileUtils } from './profile.js';
+// Export in-memory output
+export { MemoryWriter, newMemoryOutput, RecordingOutput, type WriteRecord } from './recording.js';
 // Export screen control functionality
 export { EraseLineMode, EraseMode, ScreenControl, SEQUENCES } from './screen.js';
+// Export SGR state tracking
+export {
+  applySGR,
+  closeSGR,
+  diffSGR,
+  reapplySGR,
+  type SGRAttribute,
+  SGROff,
+  type SGRState,
+  sgrGroups,
+} from './sgr.js';
+// Export terminal status report support
+export {
+  type InputStream,
+  OSCTimeout,
+  type StatusReport,
+  type StatusReportKind,
+  type StatusReportOptions,
+  StatusReportReader,
+  withStatusReportReader,
+} from './status-report.js';
+// Export string width measurement
+export { stringWidth } from './string-width.js';
+// Export templates
+export {
+  type FuncMap,
+  newTemplate,
+  sprintf,
+  Template,
+  TemplateError,
+} from './template.js';
+// Export template styling functions
+export { templateFuncs } from './template-funcs.js';
+// Export terminal identification
+export {
+  identify,
+  PrimaryDeviceAttributesQuery,
+  parsePrimaryDeviceAttributes,
+  parseSecondaryDeviceAttributes,
+  parseXTVersion,
+  profileFromIdentity,
+  SecondaryDeviceAttributesQuery,
+  type TerminalFeature,
+  type TerminalIdentity,
+  XTVersionQuery,
+} from './terminal-identity.js';
+// Export terminfo database support
+export {
+  findTerminfo,
+  loadTerminfo,
+  parseTerminfo,
+  profileFromTerminfo,
+  Terminfo,
+  terminfoDirs,
+} from './terminfo.js';
 // Export style implementation
-export { Style } from './style.js';
+export {
+  DefaultLinkFallback,
+  type LineMode,
+  type LinkFallback,
+  type LinkOptions,
+  renderSpans,
+  type ResetStrategy,
+  Style,
+  type StyleLink,
+  type UnderlineStyle,
+} from './style.js';
+// Export reusable style definitions
+export {
+  newStyleSpec,
+  type StyleAttributeName,
+  StyleAttributeNames,
+  type StyleAttributes,
+  StyleSpec,
+} from './style-spec.js';
 // Export all core types and interfaces
 export type {
   Color,
+  CursorPosition,
   Environ,
   File,
   Output,
@@ -77,6 +230,7 @@ export {
   ANSIYellow,
   convertToRGB,
   InvalidColorError,
+  MarkupError,
   NoColor,
   Profile,
   RGBColor,
@@ -89,7 +243,15 @@ import { notify } from './notification.js';
 // Global convenience functions - matches Go termenv package API
 import { defaultOutputInstance } from './output.js';
 import { ProfileUtils } from './profile.js';
-import { ANSI256Color, ANSIColor, type Color, NoColor, type Profile, RGBColor } from './types.js';
+import {
+  ANSI256Color,
+  ANSIColor,
+  type Color,
+  type CursorPosition,
+  NoColor,
+  type Profile,
+  RGBColor,
+} from './types.js';
 
 /**
  * String returns a new styled string for the default output
@@ -183,6 +345,13 @@ export function profileName(profile: Profile): string {
 }
 
 // Screen control global functions
+/**
+ * CursorPosition asks the terminal for the current cursor position
+ */
+export function cursorPosition(): Promise<CursorPosition> {
+  return defaultOutputInstance().cursorPosition();
+}
+
 /**
  * MoveCursor moves the cursor to the given position
  */
@@ -268,6 +437,15 @@ export function disableMouse(): void {
   defaultOutputInstance().disableMouse();
 }
 
+// Synchronized output global functions
+/**
+ * WithSynchronizedOutput runs fn inside a synchronized update, so the terminal
+ * shows everything it draws at once
+ */
+export function withSynchronizedOutput<T>(fn: () => T): T {
+  return defaultOutputInstance().withSynchronizedOutput(fn);
+}
+
 // Hyperlink global functions
 /**
  * CreateHyperlink creates a clickable hyperlink (convenience function, doesn't write to output)
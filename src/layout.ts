@@ -0,0 +1,410 @@
+/**
+ * Display-width layout of styled strings.
+ * Truncates, pads and wraps strings that contain escape sequences by the width of
+ * their visible text, keeping SGR and OSC 8 hyperlink sequences intact.
+ */
+
+import { type Token, tokenize } from './ansi.js';
+import { applySGR, closeSGR, diffSGR, type SGRState } from './sgr.js';
+import { stringWidth } from './string-width.js';
+import { CSI, OSC, ST } from './types.js';
+
+/**
+ * Alignment of text within a column
+ */
+export type Alignment = 'left' | 'right' | 'center';
+
+/**
+ * TruncateOptions configures truncate
+ */
+export interface TruncateOptions {
+  /** Appended where the string is cut, counted in the width. Defaults to "…". */
+  tail?: string;
+}
+
+/**
+ * ColumnOptions configures fitColumns
+ */
+export interface ColumnOptions {
+  /** Placed between columns. Defaults to a space. */
+  separator?: string;
+  /** Alignment of each column. Columns without one are aligned left. */
+  align?: Alignment[];
+  /** Appended to cells that are cut. Defaults to "…". */
+  tail?: string;
+}
+
+/**
+ * WrapOptions configures wordWrap and hardWrap
+ */
+export interface WrapOptions {
+  /** Prefix of the first line of each paragraph. Counted in the width. */
+  indent?: string;
+  /** Prefix of the lines after the first, for hanging indents. Defaults to indent. */
+  hangingIndent?: string;
+  /** Keep the newlines of the input. Defaults to true; when false they become spaces. */
+  preserveNewlines?: boolean;
+}
+
+const graphemes = new Intl.Segmenter(undefined, { granularity: 'grapheme' });
+
+// A grapheme cluster takes the width of its widest part, at most 2 columns, so
+// emoji sequences joined by ZWJ count once
+function graphemeWidth(cluster: string): number {
+  return Math.min(stringWidth(cluster), 2);
+}
+
+function splitGraphemes(s: string): string[] {
+  return Array.from(graphemes.segment(s), (g) => g.segment);
+}
+
+// Tracks the SGR attributes and hyperlink left open by escape sequences
+class OpenSpans {
+  private sgr: SGRState = {};
+  private link = '';
+
+  update(token: Token): void {
+    if (token.kind === 'csi' && token.final === 'm' && !/^[<=>?]/.test(token.params)) {
+      this.sgr = applySGR(this.sgr, token.params);
+    } else if (token.kind === 'osc' && token.params.startsWith('8;')) {
+      this.link = token.params.endsWith(';') ? '' : token.value;
+    }
+  }
+
+  // Sequences that open what is open, from a clean state
+  open(): string {
+    const params = diffSGR({}, this.sgr);
+    return (params ? `${CSI}${params}m` : '') + this.link;
+  }
+
+  // Sequences that close what is open
+  close(): string {
+    const params = closeSGR(this.sgr);
+    return (params ? `${CSI}${params}m` : '') + (this.link ? `${OSC}8;;${ST}` : '');
+  }
+}
+
+/**
+ * DisplayWidth returns the display width of s, ignoring escape sequences and
+ * counting each grapheme cluster once
+ */
+export function displayWidth(s: string): number {
+  let total = 0;
+  for (const token of tokenize(s)) {
+    if (token.kind === 'text') {
+      for (const cluster of splitGraphemes(token.value)) {
+        total += graphemeWidth(cluster);
+      }
+    }
+  }
+  return total;
+}
+
+/**
+ * Truncate cuts s to at most the given display width, ending it with the tail.
+ * Escape sequences before the cut are kept; SGR attributes and hyperlinks still
+ * open at the cut are closed after the tail. Wide characters and grapheme
+ * clusters are never split.
+ */
+export function truncate(s: string, maxWidth: number, options: TruncateOptions = {}): string {
+  const tail = options.tail ?? '…';
+  // Negative widths act like 0
+  const width = Math.max(maxWidth, 0);
+  if (displayWidth(s) <= width) {
+    return s;
+  }
+
+  const tailWidth = displayWidth(tail);
+  if (tailWidth > width) {
+    return truncate(tail, width, { tail: '' });
+  }
+
+  let out = '';
+  let room = width - tailWidth;
+  const spans = new OpenSpans();
+
+  cut: for (const token of tokenize(s)) {
+    if (token.kind !== 'text') {
+      spans.update(token);
+      out += token.value;
+      continue;
+    }
+
+    for (const cluster of splitGraphemes(token.value)) {
+      const w = graphemeWidth(cluster);
+      if (w > room) {
+        break cut;
+      }
+      out += cluster;
+      room -= w;
+    }
+  }
+
+  return out + tail + spans.close();
+}
+
+// Fill of exactly n columns
+function repeatFill(fill: string, n: number): string {
+  const unit = displayWidth(fill);
+  if (n <= 0) {
+    return '';
+  }
+  if (unit === 0) {
+    return ' '.repeat(n);
+  }
+
+  let out = '';
+  let used = 0;
+  for (const cluster of splitGraphemes(fill.repeat(Math.ceil(n / unit)))) {
+    const w = graphemeWidth(cluster);
+    if (used + w > n) {
+      break;
+    }
+    out += cluster;
+    used += w;
+  }
+  return out + ' '.repeat(n - used);
+}
+
+/**
+ * PadEnd pads s on the right to the given display width. Strings at least that
+ * wide are returned unchanged.
+ */
+export function padEnd(s: string, minWidth: number, fill = ' '): string {
+  return s + repeatFill(fill, minWidth - displayWidth(s));
+}
+
+/**
+ * PadStart pads s on the left to the given display width. Strings at least that
+ * wide are returned unchanged.
+ */
+export function padStart(s: string, minWidth: number, fill = ' '): string {
+  return repeatFill(fill, minWidth - displayWidth(s)) + s;
+}
+
+/**
+ * Center pads s on both sides to the given display width; an odd column of
+ * padding goes on the right
+ */
+export function center(s: string, minWidth: number, fill = ' '): string {
+  const extra = minWidth - displayWidth(s);
+  const left = Math.floor(extra / 2);
+  return repeatFill(fill, left) + s + repeatFill(fill, extra - left);
+}
+
+/**
+ * Align pads s to the given display width with the alignment
+ */
+export function align(s: string, minWidth: number, alignment: Alignment = 'left'): string {
+  switch (alignment) {
+    case 'right':
+      return padStart(s, minWidth);
+    case 'center':
+      return center(s, minWidth);
+    default:
+      return padEnd(s, minWidth);
+  }
+}
+
+/**
+ * FitColumns lays out cells as a row of columns with the given display widths,
+ * truncating cells that are too wide and padding the others. Cells beyond the
+ * last width are dropped.
+ */
+export function fitColumns(
+  cells: string[],
+  widths: number[],
+  options: ColumnOptions = {}
+): string {
+  const truncateOptions = options.tail === undefined ? {} : { tail: options.tail };
+  return widths
+    .map((w, i) => align(truncate(cells[i] ?? '', w, truncateOptions), w, options.align?.[i]))
+    .join(options.separator ?? ' ');
+}
+
+// An escape sequence or a grapheme cluster of text to wrap
+type WrapUnit = { token: Token } | { text: string; width: number; space: boolean };
+
+// A run of units that is either a word or the space between words
+interface WrapRun {
+  space: boolean;
+  units: WrapUnit[];
+  width: number;
+}
+
+interface WrapLine {
+  units: WrapUnit[];
+  /** Whether the line starts a paragraph */
+  first: boolean;
+}
+
+function unitWidth(unit: WrapUnit): number {
+  return 'width' in unit ? unit.width : 0;
+}
+
+function runWidth(units: WrapUnit[]): number {
+  return units.reduce((sum, unit) => sum + unitWidth(unit), 0);
+}
+
+function isSpace(unit: WrapUnit): boolean {
+  return 'space' in unit && unit.space;
+}
+
+// Splits s into paragraphs of units at its newlines
+function wrapParagraphs(s: string, preserveNewlines: boolean): WrapUnit[][] {
+  const paragraphs: WrapUnit[][] = [[]];
+  const current = () => paragraphs[paragraphs.length - 1] ?? [];
+
+  for (const token of tokenize(s)) {
+    if (token.kind !== 'text') {
+      current().push({ token });
+      continue;
+    }
+    for (const cluster of splitGraphemes(token.value)) {
+      if (cluster === '\n' || cluster === '\r\n') {
+        if (preserveNewlines) {
+          paragraphs.push([]);
+        } else {
+          current().push({ text: ' ', width: 1, space: true });
+        }
+        continue;
+      }
+      const space = /^\s+$/.test(cluster);
+      current().push({ text: cluster, width: graphemeWidth(cluster), space });
+    }
+  }
+  return paragraphs;
+}
+
+// Groups units into words and spaces. Escape sequences belong to the word they
+// precede or are in.
+function wrapRuns(units: WrapUnit[]): WrapRun[] {
+  const runs: WrapRun[] = [];
+  for (const unit of units) {
+    const space = isSpace(unit);
+    const last = runs[runs.length - 1];
+    if (last && last.space === space) {
+      last.units.push(unit);
+      last.width += unitWidth(unit);
+    } else {
+      runs.push({ space, units: [unit], width: unitWidth(unit) });
+    }
+  }
+  return runs;
+}
+
+// Lays out paragraphs in lines of at most width columns, breaking between words
+// or, with words false, anywhere
+function wrapLines(
+  paragraphs: WrapUnit[][],
+  width: number,
+  options: WrapOptions,
+  words: boolean
+): WrapLine[] {
+  const indentWidth = displayWidth(options.indent ?? '');
+  const hangingWidth = displayWidth(options.hangingIndent ?? options.indent ?? '');
+  const lines: WrapLine[] = [];
+
+  for (const paragraph of paragraphs) {
+    let line: WrapUnit[] = [];
+    let used = 0;
+    let first = true;
+
+    const limit = () => Math.max(width - (first ? indentWidth : hangingWidth), 1);
+    const breakLine = () => {
+      lines.push({ units: line, first });
+      line = [];
+      used = 0;
+      first = false;
+    };
+    // Place units one at a time, breaking before a cluster that doesn't fit
+    const place = (units: WrapUnit[]) => {
+      for (const unit of units) {
+        if (used > 0 && used + unitWidth(unit) > limit()) {
+          breakLine();
+        }
+        line.push(unit);
+        used += unitWidth(unit);
+      }
+    };
+
+    if (!words) {
+      place(paragraph);
+      lines.push({ units: line, first });
+      continue;
+    }
+
+    // Spaces wait for the next word; where the line breaks they are dropped
+    let pending: WrapUnit[] = [];
+    for (const run of wrapRuns(paragraph)) {
+      if (run.space || run.width === 0) {
+        pending.push(...run.units);
+        continue;
+      }
+
+      const pendingWidth = runWidth(pending);
+      if (used + pendingWidth + run.width <= limit()) {
+        line.push(...pending, ...run.units);
+        used += pendingWidth + run.width;
+      } else {
+        line.push(...pending.filter((unit) => !('text' in unit)));
+        if (used > 0) {
+          breakLine();
+        }
+        place(run.units);
+      }
+      pending = [];
+    }
+
+    if (used + runWidth(pending) <= limit()) {
+      line.push(...pending);
+    } else {
+      line.push(...pending.filter((unit) => !('text' in unit)));
+    }
+    lines.push({ units: line, first });
+  }
+  return lines;
+}
+
+// Renders lines with their indents, closing open spans at the end of each line
+// and reopening them after the indent of the next
+function renderLines(lines: WrapLine[], options: WrapOptions): string {
+  const indent = options.indent ?? '';
+  const hangingIndent = options.hangingIndent ?? indent;
+  const spans = new OpenSpans();
+
+  return lines
+    .map(({ units, first }) => {
+      let out = (first ? indent : hangingIndent) + spans.open();
+      for (const unit of units) {
+        if ('token' in unit) {
+          spans.update(unit.token);
+          out += unit.token.value;
+        } else {
+          out += unit.text;
+        }
+      }
+      return out + spans.close();
+    })
+    .join('\n');
+}
+
+/**
+ * WordWrap wraps s at spaces so its lines are at most the given display width.
+ * Words longer than a line are broken. Styles and hyperlinks open at a line break
+ * are closed at the end of the line and reopened on the next.
+ */
+export function wordWrap(s: string, maxWidth: number, options: WrapOptions = {}): string {
+  const paragraphs = wrapParagraphs(s, options.preserveNewlines ?? true);
+  return renderLines(wrapLines(paragraphs, maxWidth, options, true), options);
+}
+
+/**
+ * HardWrap breaks s into lines of the given display width, without
+ * looking for spaces. Like wordWrap, it carries styles across line breaks and
+ * never splits a wide character or grapheme cluster.
+ */
+export function hardWrap(s: string, maxWidth: number, options: WrapOptions = {}): string {
+  const paragraphs = wrapParagraphs(s, options.preserveNewlines ?? true);
+  return renderLines(wrapLines(paragraphs, maxWidth, options, false), options);
+}
@@ -0,0 +1,275 @@
+/**
+ * Inline markup for styled text, e.g. "[bold red]Error:[/] see [link=https://x]x.ts[/link]".
+ *
+ * A tag holds space-separated style words: attributes (bold, faint or dim, italic,
+ * underline, overline, blink, reverse, strike or crossout), colors (names like red
+ * or bright-blue, color(0-255), and whatever parseColor accepts, like #rrggbb or
+ * tomato), "on <color>" for the background,
+ * "not <attribute>", underline=<kind>, underline-color=<color> and link=<url>.
+ * [/] closes the innermost tag, [/word] the innermost tag containing word. Tags
+ * left open end with the text. \[ is a literal bracket and \\ a literal backslash.
+ */
+
+import { parseColor } from './color-parser.js';
+import { defaultOutputInstance, type OutputImpl } from './output.js';
+import { renderSpans, Style, type UnderlineStyle } from './style.js';
+import { type StyleAttributes, StyleSpec } from './style-spec.js';
+import { ANSIColor, type Color, MarkupError, Profile } from './types.js';
+
+/**
+ * MarkupText is plain text in parsed markup
+ */
+export interface MarkupText {
+  kind: 'text';
+  text: string;
+}
+
+/**
+ * MarkupElement is a tag and the markup it encloses
+ */
+export interface MarkupElement {
+  kind: 'element';
+  /** Tag content, e.g. "bold red" */
+  tag: string;
+  attributes: StyleAttributes;
+  children: MarkupNode[];
+}
+
+export type MarkupNode = MarkupText | MarkupElement;
+
+// The 16 ANSI colors by name; dashes and underscores are ignored
+// biome-ignore format: keep the table compact
+const colorNames = [
+  'black', 'red', 'green', 'yellow', 'blue', 'magenta', 'cyan', 'white',
+  'brightblack', 'brightred', 'brightgreen', 'brightyellow', 'brightblue',
+  'brightmagenta', 'brightcyan', 'brightwhite',
+];
+
+const flagWords: { [word: string]: keyof StyleAttributes } = {
+  bold: 'bold',
+  faint: 'faint',
+  dim: 'faint',
+  italic: 'italic',
+  underline: 'underline',
+  overline: 'overline',
+  blink: 'blink',
+  reverse: 'reverse',
+  strike: 'crossOut',
+  crossout: 'crossOut',
+};
+
+const underlineKinds = ['none', 'single', 'double', 'curly', 'dotted', 'dashed'];
+
+// A tag starts with a letter, # or /; other brackets are text
+const tagPattern = /\[(\/?[a-zA-Z#][^[\]]*|\/)\]/y;
+
+/**
+ * ParseMarkupColor parses one of the 16 ANSI color names or color(n), and
+ * otherwise anything parseColor accepts, like #rrggbb, tomato or hsl(0,100%,50%).
+ * Returns null for anything else.
+ */
+export function parseMarkupColor(s: string): Color | null {
+  const name = s.toLowerCase().replace(/[-_]/g, '');
+  const index = colorNames.indexOf(name === 'gray' || name === 'grey' ? 'brightblack' : name);
+  if (index >= 0) {
+    return new ANSIColor(index);
+  }
+
+  const n = /^color\((\d{1,3})\)$/i.exec(s)?.[1];
+  if (n !== undefined) {
+    return parseColor(n);
+  }
+  return parseColor(s);
+}
+
+/**
+ * ParseTag returns the style attributes of a tag's content
+ */
+export function parseTag(tag: string, position = 0): StyleAttributes {
+  const attrs: StyleAttributes = {};
+  const words = tag.trim().split(/\s+/);
+  const color = (word: string | undefined): Color => {
+    const c = word === undefined ? null : parseMarkupColor(word);
+    if (!c) {
+      throw new MarkupError(`invalid color "${word ?? ''}" in [${tag}]`, position);
+    }
+    return c;
+  };
+
+  for (let i = 0; i < words.length; i++) {
+    const word = words[i] ?? '';
+    const [key = '', value] = splitWord(word);
+    const keyword = key.toLowerCase();
+    const flag = flagWords[keyword];
+
+    if (value !== undefined) {
+      const kind = value.toLowerCase();
+      if (keyword === 'link') {
+        attrs.link = { url: value };
+      } else if (keyword === 'underline' && underlineKinds.includes(kind)) {
+        attrs.underline = kind as UnderlineStyle;
+      } else if (keyword === 'underline-color') {
+        attrs.underlineColor = color(value);
+      } else {
+        throw new MarkupError(`unknown attribute "${word}" in [${tag}]`, position);
+      }
+    } else if (keyword === 'on') {
+      attrs.background = color(words[++i]);
+    } else if (keyword === 'not') {
+      const negated = flagWords[(words[++i] ?? '').toLowerCase()];
+      if (!negated) {
+        throw new MarkupError(`invalid attribute after "not" in [${tag}]`, position);
+      }
+      Object.assign(attrs, { [negated]: false });
+    } else if (flag) {
+      Object.assign(attrs, { [flag]: true });
+    } else if (parseMarkupColor(word)) {
+      attrs.foreground = color(word);
+    } else {
+      throw new MarkupError(`unknown style "${word}" in [${tag}]`, position);
+    }
+  }
+  return attrs;
+}
+
+function splitWord(word: string): [string, string | undefined] {
+  const eq = word.indexOf('=');
+  return eq < 0 ? [word, undefined] : [word.slice(0, eq), word.slice(eq + 1)];
+}
+
+/**
+ * ParseMarkup parses markup into a tree of text and elements
+ */
+export function parseMarkup(s: string): MarkupNode[] {
+  const root: MarkupNode[] = [];
+  const open: { element: MarkupElement; words: string[] }[] = [];
+  const children = () => open[open.length - 1]?.element.children ?? root;
+  let text = '';
+
+  const flush = () => {
+    if (text !== '') {
+      children().push({ kind: 'text', text });
+      text = '';
+    }
+  };
+
+  let pos = 0;
+  while (pos < s.length) {
+    const c = s.charAt(pos);
+    if (c === '\\' && (s.charAt(pos + 1) === '[' || s.charAt(pos + 1) === '\\')) {
+      text += s.charAt(pos + 1);
+      pos += 2;
+      continue;
+    }
+
+    tagPattern.lastIndex = pos;
+    const match = c === '[' ? tagPattern.exec(s) : null;
+    if (!match) {
+      text += c;
+      pos++;
+      continue;
+    }
+
+    flush();
+    const tag = match[1] ?? '';
+    if (tag.startsWith('/')) {
+      const name = tag.slice(1).trim();
+      let i = open.length - 1;
+      while (name !== '' && i >= 0 && !open[i]?.words.includes(name)) {
+        i--;
+      }
+      if (i < 0) {
+        throw new MarkupError(`closing tag [${tag}] doesn't match an open tag`, pos);
+      }
+      open.length = i;
+    } else {
+      const element: MarkupElement = {
+        kind: 'element',
+        tag,
+        attributes: parseTag(tag, pos),
+        children: [],
+      };
+      children().push(element);
+      // a tag can be closed by its content, any word or any key=
+      const words = tag.trim().split(/\s+/);
+      open.push({ element, words: [tag.trim(), ...words, ...words.map((w) => splitWord(w)[0])] });
+    }
+    pos += match[0].length;
+  }
+
+  flush();
+  return root;
+}
+
+/**
+ * EscapeMarkup escapes s so it renders literally
+ */
+export function escapeMarkup(s: string): string {
+  return s.replace(/[\\[]/g, (c) => `\\${c}`);
+}
+
+/**
+ * MarkupTarget is where markup is rendered for: an output, whose profile and
+ * hyperlink settings are used, or just a color profile
+ */
+export type MarkupTarget = OutputImpl | Profile;
+
+/**
+ * RenderMarkup renders markup as styled text for the target, by default the
+ * default output
+ */
+export function renderMarkup(s: string, target: MarkupTarget = defaultOutputInstance()): string {
+  const base = (text: string): Style =>
+    typeof target === 'number' ? new Style(target, text) : target.string(text);
+  const probe = base('');
+  const linksSupported = probe.profile !== Profile.Ascii && probe.linksSupported;
+
+  const spans = (nodes: MarkupNode[], spec: StyleSpec): Style[] =>
+    nodes.flatMap((node) => {
+      if (node.kind === 'text') {
+        return [spec.apply(base(node.text))];
+      }
+
+      const inner = spec.with(node.attributes);
+      const link = node.attributes.link;
+      if (!link || linksSupported) {
+        return spans(node.children, inner);
+      }
+
+      // render the fallback once for the whole link, not per span
+      const plain = inner.unset('link');
+      const content = spans(node.children, plain);
+      const text = content.map((span) => span.string).join('');
+      const fallback = probe.linkFallback(text, link.url);
+      if (fallback.startsWith(text)) {
+        return [...content, plain.apply(base(fallback.slice(text.length)))];
+      }
+      return [plain.apply(base(fallback))];
+    });
+
+  return renderSpans(...spans(parseMarkup(s), StyleSpec.create()));
+}
+
+/**
+ * MarkupTag returns a template literal tag that renders markup for the target.
+ * Interpolated values are escaped, so they never add tags.
+ */
+export function markupTag(
+  target?: MarkupTarget
+): (strings: TemplateStringsArray, ...values: unknown[]) => string {
+  return (strings, ...values) => {
+    const s = strings.reduce(
+      (acc, str, i) => acc + str + (i < values.length ? escapeMarkup(String(values[i])) : ''),
+      ''
+    );
+    return renderMarkup(s, target ?? defaultOutputInstance());
+  };
+}
+
+/**
+ * Markup renders a template literal as markup for the default output, escaping
+ * interpolated values: markup`[bold]${name}[/bold]`
+ */
+export function markup(strings: TemplateStringsArray, ...values: unknown[]): string {
+  return markupTag()(strings, ...values);
+}
@@ -3,7 +3,7 @@
  * Port of github.com/muesli/termenv/notification.go
  */
 
-import type { Output } from './types.js';
+import { type Output, sendString } from './types.js';
 
 /**
  * Creates a terminal notification using OSC 777 escape sequences
@@ -29,7 +29,7 @@ export class NotificationControl {
    * @returns This instance for chaining
    */
   notify(title: string, body: string): this {
-    this.output.writeString(notify(title, body));
+    sendString(this.output, notify(title, body));
     return this;
   }
 }
@@ -3,27 +3,137 @@
  * Port of github.com/muesli/termenv Output struct to TypeScript.
  */
 
+import { writeSync } from 'node:fs';
+import { isatty } from 'node:tty';
+import { type ColorMetric, convertColor } from './color-convert.js';
+import { colorFromString } from './color-parser.js';
 import { HyperlinkControl } from './hyperlink.js';
 import { NotificationControl } from './notification.js';
-import { ScreenControl } from './screen.js';
-import { Style } from './style.js';
+import { DefaultPalette, Palette, paletteColorQuery, parsePaletteReport } from './palette.js';
+import { ScreenControl, SEQUENCES } from './screen.js';
+import { type InputStream, OSCTimeout, withStatusReportReader } from './status-report.js';
+import {
+  DefaultLinkFallback,
+  type LineMode,
+  type LinkFallback,
+  type ResetStrategy,
+  Style,
+} from './style.js';
+import {
+  identify,
+  PrimaryDeviceAttributesQuery,
+  parsePrimaryDeviceAttributes,
+  parseSecondaryDeviceAttributes,
+  parseXTVersion,
+  profileFromIdentity,
+  SecondaryDeviceAttributesQuery,
+  type TerminalIdentity,
+  XTVersionQuery,
+} from './terminal-identity.js';
+import { loadTerminfo, profileFromTerminfo } from './terminfo.js';
 import {
-  ANSI256Color,
   ANSIColor,
   BEL,
+  CSI,
   type Color,
+  type CursorPosition,
   convertToRGB,
   type Environ,
   ESC,
   type Output as IOutput,
   NoColor,
+  OSC,
   type OutputOption,
   ProcessEnviron,
   Profile,
   RGBColor,
   ST,
+  StatusReportError,
 } from './types.js';
 
+/**
+ * DefaultBufferThreshold is the buffered output size, in characters, at which
+ * buffered output is flushed
+ */
+export const DefaultBufferThreshold = 16384;
+
+/**
+ * BufferingOptions configures buffered output
+ */
+export interface BufferingOptions {
+  /** Flush once this many characters are buffered */
+  threshold?: number;
+  /** 'microtask' flushes at the end of the current microtask, 'none' waits for flush() */
+  autoFlush?: 'none' | 'microtask';
+}
+
+// Terminals known to support underline styles and colors, by identity and TERM
+const extendedUnderlineTerminals = [
+  'alacritty',
+  'contour',
+  'foot',
+  'ghostty',
+  'iterm2',
+  'kitty',
+  'mintty',
+  'vte',
+  'wezterm',
+];
+const extendedUnderlineTerms = [
+  'alacritty',
+  'contour',
+  'foot',
+  'wezterm',
+  'xterm-ghostty',
+  'xterm-kitty',
+];
+
+// Profiles selected by the FORCE_COLOR levels
+const forceColorProfiles = [Profile.Ascii, Profile.ANSI, Profile.ANSI256, Profile.TrueColor];
+
+// Streams that already have a broken pipe guard
+const guardedStreams = new WeakSet<object>();
+
+/**
+ * A broken pipe on stdout or stderr is reported to write callbacks and also
+ * emitted as an 'error' event, which crashes the process if nobody listens.
+ * Outputs that exit silently on a broken pipe listen once per stream, from their
+ * first unawaited write, and exit the same way; other errors still crash.
+ */
+function guardProcessStream(writer: NodeJS.WriteStream | NodeJS.WritableStream): void {
+  if (guardedStreams.has(writer)) {
+    return;
+  }
+  guardedStreams.add(writer);
+  writer.on('error', (err: Error) => {
+    if (!isBrokenPipe(err)) {
+      throw err;
+    }
+    process.exit(0);
+  });
+}
+
+// Write all of data to fd, retrying when a non-blocking descriptor is full
+function writeAllSync(fd: number, data: Uint8Array): void {
+  let offset = 0;
+  while (offset < data.length) {
+    try {
+      offset += writeSync(fd, data, offset);
+    } catch (err) {
+      if ((err as NodeJS.ErrnoException).code !== 'EAGAIN') {
+        throw err;
+      }
+    }
+  }
+}
+
+// Errors of writes whose reader is gone: a broken pipe or a closed stream
+const brokenPipeCodes = new Set(['EPIPE', 'ERR_STREAM_DESTROYED', 'ERR_STREAM_WRITE_AFTER_END']);
+
+function isBrokenPipe(err: Error): boolean {
+  return brokenPipeCodes.has((err as NodeJS.ErrnoException).code ?? '');
+}
+
 // Default global output instance
 let defaultOutput: OutputImpl;
 
@@ -36,12 +146,33 @@ export class OutputImpl implements IOutput {
   public unsafe: boolean = false;
   public cache: boolean = false;
   public environ: Environ;
+  public statusReportTimeout: number = OSCTimeout;
+  public onError: ((err: Error) => void) | null = null;
+  public linkFallback: LinkFallback = DefaultLinkFallback;
+  public resetStrategy: ResetStrategy = 'full';
+  public lineMode: LineMode = 'block';
+  public strictColors: boolean = false;
+  public colorMetric: ColorMetric = 'hsluv';
+  public palette: Palette = DefaultPalette;
 
   private _writer: NodeJS.WriteStream | NodeJS.WritableStream;
+  private _fd: number | null = null;
+  private _input: InputStream | null = null;
   private _fgColor: Color | null = null;
   private _bgColor: Color | null = null;
   private _fgCached: boolean = false;
   private _bgCached: boolean = false;
+  private _fgReported: Color | null = null;
+  private _bgReported: Color | null = null;
+  private _identity: TerminalIdentity | null = null;
+  private _profileDetected: boolean = false;
+  private _syncDepth = 0;
+  private _extendedUnderline: boolean | null = null;
+  private _hyperlinks: boolean | null = null;
+  private _buffering: Required<BufferingOptions> | null = null;
+  private _buffer: (string | Uint8Array)[] = [];
+  private _bufferSize = 0;
+  private _flushScheduled = false;
 
   // Control classes for additional functionality
   private _screen: ScreenControl;
@@ -69,6 +200,7 @@ export class OutputImpl implements IOutput {
     // Auto-detect profile if not set
     if (this.profile < 0) {
       this.profile = this.envColorProfile();
+      this._profileDetected = true;
     }
   }
 
@@ -76,7 +208,63 @@ export class OutputImpl implements IOutput {
     return this._writer;
   }
 
+  /**
+   * SetSyncWriter makes the output write straight to a file descriptor with
+   * fs.writeSync, or go back to the writer stream when fd is null. Every write is
+   * complete when the call that issued it returns, so sequences from control
+   * methods can't end up after output written later, e.g. by console.log.
+   */
+  setSyncWriter(fd: number | null): void {
+    this._fd = fd;
+  }
+
+  /**
+   * Fd returns the file descriptor set with withSyncWriter, or null
+   */
+  fd(): number | null {
+    return this._fd;
+  }
+
+  // Whether the output goes to the process's own stdout or stderr
+  private writesToProcess(): boolean {
+    if (this._fd !== null) {
+      return this._fd === 1 || this._fd === 2;
+    }
+    return this._writer === process.stdout || this._writer === process.stderr;
+  }
+
+  /**
+   * Input returns the stream terminal responses are read from. Defaults to
+   * process.stdin when writing to the process's own terminal.
+   */
+  input(): InputStream | null {
+    if (this._input) {
+      return this._input;
+    }
+    if (this.writesToProcess() && process.stdin.isTTY) {
+      return process.stdin;
+    }
+    return null;
+  }
+
+  setInput(input: InputStream | null): void {
+    this._input = input;
+  }
+
   async write(data: Uint8Array): Promise<number> {
+    if (this._buffering) {
+      // keep the order: pending sequences go out first, in the same call
+      this._buffer.push(data);
+      this._bufferSize += data.length;
+      await this.flush();
+      return data.length;
+    }
+
+    if (this._fd !== null) {
+      writeAllSync(this._fd, data);
+      return data.length;
+    }
+
     return new Promise((resolve, reject) => {
       this._writer.write(data, (err) => {
         if (err) reject(err);
@@ -86,11 +274,144 @@ export class OutputImpl implements IOutput {
   }
 
   async writeString(s: string): Promise<number> {
+    if (this._buffering) {
+      this.bufferString(s);
+      return Buffer.byteLength(s);
+    }
     return this.write(new TextEncoder().encode(s));
   }
 
+  /**
+   * HandleWriteError applies the error policy to a failed write that nobody
+   * awaited, like the ones issued by the control methods: the handler set with
+   * withErrorHandler() gets it; without one, a broken pipe or a closed stream on
+   * stdout or stderr (e.g. when piped to head) exits the process silently, like
+   * SIGPIPE does for Go programs, and any other error is rethrown.
+   */
+  handleWriteError(err: unknown): void {
+    const error = err instanceof Error ? err : new Error(String(err));
+    if (this.onError) {
+      this.onError(error);
+      return;
+    }
+
+    if (!this.writesToProcess() || !isBrokenPipe(error)) {
+      throw error;
+    }
+    process.exit(0);
+  }
+
+  /**
+   * Send writes s without waiting, like the control methods do; failures go to
+   * handleWriteError
+   */
+  send(s: string): void {
+    this.guardBrokenPipe();
+    this.writeString(s).catch((err: unknown) => this.handleWriteError(err));
+  }
+
+  // Flush without waiting, failures go to handleWriteError
+  private sendBuffer(): void {
+    this.guardBrokenPipe();
+    this.flush().catch((err: unknown) => this.handleWriteError(err));
+  }
+
+  // Unawaited writes to stdout or stderr exit silently on a broken pipe unless
+  // an error handler is set, so the stream's 'error' event must not crash first
+  private guardBrokenPipe(): void {
+    if (this.onError || this._fd !== null || !this.writesToProcess()) {
+      return;
+    }
+    guardProcessStream(this._writer);
+  }
+
+  /**
+   * SetBuffering enables buffered output, or disables it when options is null.
+   * Buffered sequences are written on flush(), once the buffer reaches the
+   * threshold, or at the end of the current microtask with autoFlush 'microtask'.
+   */
+  setBuffering(options: BufferingOptions | null): void {
+    if (!options) {
+      this.sendBuffer();
+      this._buffering = null;
+      return;
+    }
+    this._buffering = {
+      threshold: options.threshold ?? DefaultBufferThreshold,
+      autoFlush: options.autoFlush ?? 'none',
+    };
+  }
+
+  /**
+   * Buffered reports whether output is buffered
+   */
+  buffered(): boolean {
+    return this._buffering !== null;
+  }
+
+  /**
+   * Flush writes all buffered output in a single call to the writer
+   */
+  flush(): Promise<void> {
+    if (this._buffer.length === 0) {
+      return Promise.resolve();
+    }
+
+    const chunks = this._buffer;
+    this._buffer = [];
+    this._bufferSize = 0;
+
+    const data = chunks.every((c) => typeof c === 'string')
+      ? chunks.join('')
+      : Buffer.concat(chunks.map((c) => (typeof c === 'string' ? Buffer.from(c) : c)));
+
+    if (this._fd !== null) {
+      try {
+        writeAllSync(this._fd, typeof data === 'string' ? Buffer.from(data) : data);
+        return Promise.resolve();
+      } catch (err) {
+        return Promise.reject(err);
+      }
+    }
+
+    return new Promise((resolve, reject) => {
+      this._writer.write(data, (err) => {
+        if (err) reject(err);
+        else resolve();
+      });
+    });
+  }
+
+  private bufferString(s: string): void {
+    const buffering = this._buffering;
+    if (!buffering) {
+      return;
+    }
+
+    this._buffer.push(s);
+    this._bufferSize += s.length;
+    if (this._bufferSize >= buffering.threshold) {
+      this.sendBuffer();
+    } else if (buffering.autoFlush === 'microtask' && !this._flushScheduled) {
+      this._flushScheduled = true;
+      queueMicrotask(() => {
+        this._flushScheduled = false;
+        this.sendBuffer();
+      });
+    }
+  }
+
   string(...strings: string[]): Style {
-    return new Style(this.profile, strings.join(' '));
+    const style = new Style(this.profile, strings.join(' '));
+    style.extendedUnderline = this.extendedUnderline();
+    style.linksSupported = this.hyperlinksSupported();
+    style.linkFallback = this.linkFallback;
+    style.resetStrategy = this.resetStrategy;
+    style.lineMode = this.lineMode;
+    style.strictColors = this.strictColors;
+    style.colorMetric = this.colorMetric;
+    style.palette = this.palette;
+    return style;
   }
 
   // Go-style API compatibility methods (PascalCase)
@@ -136,6 +457,10 @@ export class OutputImpl implements IOutput {
       return false;
     }
 
+    if (this._fd !== null) {
+      return isatty(this._fd);
+    }
+
     // Check if writer has isTTY method (like process.stdout/stderr)
     const writer = this._writer as NodeJS.WriteStream;
     if (writer && typeof writer.isTTY === 'boolean') {
@@ -150,6 +475,19 @@ export class OutputImpl implements IOutput {
       return Profile.Ascii;
     }
 
+    const p = this.termColorProfile();
+    if (this._identity) {
+      // the terminal's own identity can only upgrade what the environment says
+      const ip = profileFromIdentity(this._identity);
+      if (ip !== null && ip < p) {
+        return ip;
+      }
+    }
+
+    return p;
+  }
+
+  private termColorProfile(): Profile {
     // Google Cloud Shell
     if (this.environ.getenv('GOOGLE_CLOUD_SHELL') === 'true') {
       return Profile.TrueColor;
@@ -202,24 +540,182 @@ export class OutputImpl implements IOutput {
       return Profile.ANSI;
     }
 
+    // Ask the terminfo database, it knows terminals the name doesn't describe.
+    // Entry names are case-sensitive, e.g. Eterm, so it gets TERM as is.
+    const ti = loadTerminfo(this.environ.getenv('TERM'), this.environ);
+    if (ti) {
+      return profileFromTerminfo(ti);
+    }
+
     // Default to no color for unknown terminals
     return Profile.Ascii;
   }
 
+  /**
+   * ExtendedUnderline reports whether the terminal supports underline styles and
+   * colors, as announced by TERM, TERM_PROGRAM, VTE_VERSION, the terminfo Smulx or
+   * Su capabilities, or the identity found by probeTerminal().
+   */
+  extendedUnderline(): boolean {
+    if (this._extendedUnderline !== null) {
+      return this._extendedUnderline;
+    }
+    if (!this.isTTY()) {
+      return false;
+    }
+
+    if (this._identity && extendedUnderlineTerminals.includes(this._identity.name)) {
+      return true;
+    }
+
+    const term = this.environ.getenv('TERM').toLowerCase();
+    if (extendedUnderlineTerms.includes(term)) {
+      return true;
+    }
+
+    const termProgram = this.environ.getenv('TERM_PROGRAM');
+    if (['WezTerm', 'iTerm.app', 'ghostty', 'vscode'].includes(termProgram)) {
+      return true;
+    }
+
+    // curly underlines and underline colors arrived in VTE 0.51.2
+    const vte = parseInt(this.environ.getenv('VTE_VERSION'), 10);
+    if (vte >= 5102) {
+      return true;
+    }
+
+    const ti = loadTerminfo(this.environ.getenv('TERM'), this.environ);
+    return ti !== null && (ti.string('Smulx') !== null || ti.flag('Su'));
+  }
+
+  /**
+   * SetExtendedUnderline overrides the detected underline style support, or
+   * restores detection when enabled is null
+   */
+  setExtendedUnderline(enabled: boolean | null): void {
+    this._extendedUnderline = enabled;
+  }
+
+  /**
+   * HyperlinksSupported reports whether styles render their links as OSC 8. Piped
+   * output and consoles that would print the sequences get the link fallback.
+   */
+  hyperlinksSupported(): boolean {
+    if (this._hyperlinks !== null) {
+      return this._hyperlinks;
+    }
+    if (!this.isTTY()) {
+      return false;
+    }
+
+    const term = this.environ.getenv('TERM').toLowerCase();
+    return term !== 'linux' && term !== 'dumb';
+  }
+
+  /**
+   * SetHyperlinks overrides hyperlink support detection, or restores it when
+   * enabled is null
+   */
+  setHyperlinks(enabled: boolean | null): void {
+    this._hyperlinks = enabled;
+  }
+
+  /**
+   * TerminalIdentity returns the identity found by probeTerminal(), if any
+   */
+  terminalIdentity(): TerminalIdentity | null {
+    return this._identity;
+  }
+
+  setTerminalIdentity(identity: TerminalIdentity | null): void {
+    this._identity = identity;
+  }
+
+  /**
+   * ProbeTerminal identifies the terminal by sending XTVERSION, Secondary and
+   * Primary Device Attributes queries. The identity is used by colorProfile() to
+   * upgrade the profile detected from TERM/COLORTERM, which SSH and sudo often
+   * strip; an auto-detected profile is re-detected.
+   * Rejects with StatusReportError if the terminal doesn't answer.
+   */
+  async probeTerminal(): Promise<TerminalIdentity> {
+    const input = this.input();
+    if (!input || !this.isTTY()) {
+      throw new StatusReportError();
+    }
+
+    const options = { timeout: this.statusReportTimeout, raw: !this.unsafe };
+    const identity = await withStatusReportReader(input, options, async (reader) => {
+      const deadline = Date.now() + this.statusReportTimeout;
+      let secondary: number[] = [];
+      let xtversion = '';
+
+      // DA1 goes last: every terminal answers it, so its reply ends the probe
+      this.send(XTVersionQuery);
+      this.send(SecondaryDeviceAttributesQuery);
+      this.send(PrimaryDeviceAttributesQuery);
+      this.sendBuffer();
+
+      for (;;) {
+        const res = await reader.readResponse();
+        const da1 = res.kind === 'csi' ? parsePrimaryDeviceAttributes(res.response) : null;
+        if (da1) {
+          return identify(da1, secondary, xtversion);
+        }
+
+        const da2 = res.kind === 'csi' ? parseSecondaryDeviceAttributes(res.response) : null;
+        const xtv = res.kind === 'dcs' ? parseXTVersion(res.response) : null;
+        if (da2) {
+          secondary = da2;
+        } else if (xtv !== null) {
+          xtversion = xtv;
+        } else {
+          reader.unread(res);
+        }
+
+        if (Date.now() > deadline) {
+          throw new StatusReportError('timed out waiting for device attributes');
+        }
+      }
+    });
+
+    this._identity = identity;
+    if (this._profileDetected) {
+      this.profile = this.envColorProfile();
+    }
+    return identity;
+  }
+
   envColorProfile(): Profile {
     if (this.envNoColor()) {
       return Profile.Ascii;
     }
 
+    // FORCE_COLOR=1/2/3 selects the profile, even when not writing to a terminal
+    const force = this.forceColor();
+    if (force && !force.minimum) {
+      return forceColorProfiles[Math.min(force.level, 3)] ?? Profile.TrueColor;
+    }
+
     const p = this.colorProfile();
-    if (this.cliColorForced() && p === Profile.Ascii) {
+    if ((force || this.cliColorForced()) && p === Profile.Ascii) {
       return Profile.ANSI;
     }
 
     return p;
   }
 
+  /**
+   * EnvNoColor returns true if the environment variables explicitly disable color output.
+   * FORCE_COLOR=0 always disables color; any other FORCE_COLOR value overrides
+   * NO_COLOR and CLICOLOR=0, like Node.js does.
+   */
   envNoColor(): boolean {
+    const force = this.forceColor();
+    if (force) {
+      return force.level === 0;
+    }
+
     const noColor = this.environ.getenv('NO_COLOR');
     const cliColor = this.environ.getenv('CLICOLOR');
 
@@ -231,6 +727,30 @@ export class OutputImpl implements IOutput {
     return forced !== '' && forced !== '0';
   }
 
+  /**
+   * ForceColor parses FORCE_COLOR: a level from 0 to 3, "false" (level 0), or
+   * "true" and the empty string, which only ask for a minimum of ANSI colors.
+   * Returns null if FORCE_COLOR is unset or not understood.
+   */
+  private forceColor(): { level: number; minimum: boolean } | null {
+    const forceColor = this.environ.getenv('FORCE_COLOR');
+    if (forceColor === 'true') {
+      return { level: 1, minimum: true };
+    }
+    if (forceColor === 'false') {
+      return { level: 0, minimum: false };
+    }
+    if (forceColor === '') {
+      // getenv can't tell an empty value from an unset one
+      const isSet = this.environ.environ().some((e) => e === 'FORCE_COLOR=');
+      return isSet ? { level: 1, minimum: true } : null;
+    }
+    if (!/^\d+$/.test(forceColor)) {
+      return null;
+    }
+    return { level: parseInt(forceColor, 10), minimum: false };
+  }
+
   foregroundColor(): Color {
     if (this.cache) {
       if (!this._fgCached) {
@@ -253,13 +773,158 @@ export class OutputImpl implements IOutput {
     return this._backgroundColor();
   }
 
+  /**
+   * QueryForegroundColor asks the terminal for its foreground color (OSC 10) and
+   * remembers the answer for foregroundColor(). Falls back to COLORFGBG when the
+   * terminal doesn't respond.
+   */
+  async queryForegroundColor(): Promise<Color> {
+    const c = await this.queryTermColor(10);
+    if (c) {
+      this._fgReported = c;
+      this._fgCached = false;
+    }
+    return this.foregroundColor();
+  }
+
+  /**
+   * QueryBackgroundColor asks the terminal for its background color (OSC 11) and
+   * remembers the answer for backgroundColor() and hasDarkBackground(). Falls back
+   * to COLORFGBG when the terminal doesn't respond.
+   */
+  async queryBackgroundColor(): Promise<Color> {
+    const c = await this.queryTermColor(11);
+    if (c) {
+      this._bgReported = c;
+      this._bgCached = false;
+    }
+    return this.backgroundColor();
+  }
+
+  private async queryTermColor(sequence: number): Promise<RGBColor | null> {
+    if (!this.isTTY()) {
+      return null;
+    }
+
+    try {
+      return parseXTermColor(await this.termStatusReport(sequence));
+    } catch (err) {
+      if (err instanceof StatusReportError) {
+        return null;
+      }
+      throw err;
+    }
+  }
+
+  /**
+   * TermStatusReport sends an OSC query to the terminal and returns its raw response.
+   * Rejects with StatusReportError if the terminal doesn't support the query or
+   * doesn't answer in time.
+   * Port of Go termStatusReport.
+   */
+  async termStatusReport(sequence: number): Promise<string> {
+    const input = this.oscInput();
+    if (!input) {
+      throw new StatusReportError();
+    }
+
+    const options = { timeout: this.statusReportTimeout, raw: !this.unsafe };
+    return withStatusReportReader(input, options, async (reader) => {
+      // first, send OSC query, which is ignored by terminal which do not support it
+      this.send(`${OSC}${sequence};?${ST}`);
+
+      // then, query cursor position, should be supported by all terminals
+      this.send(`${CSI}6n`);
+      this.sendBuffer();
+
+      // read the next response
+      const res = await reader.readResponse();
+
+      // if this is not OSC response, then the terminal does not support it
+      if (res.kind !== 'osc') {
+        throw new StatusReportError();
+      }
+
+      // read the cursor query response next and discard the result
+      await reader.readResponse();
+
+      return res.response;
+    });
+  }
+
+  // Input for OSC queries, or null if the terminal can't answer them
+  private oscInput(): InputStream | null {
+    // screen/tmux can't support OSC, because they can be connected to multiple
+    // terminals concurrently.
+    const term = this.environ.getenv('TERM');
+    if (term.startsWith('screen') || term.startsWith('tmux') || term.startsWith('dumb')) {
+      return null;
+    }
+    return this.input();
+  }
+
+  /**
+   * QueryPalette asks the terminal for its colors with OSC 4 and makes them the
+   * output's palette: by default the 16 ANSI colors, which ANSI downsampling maps
+   * onto, or all 256, so ANSI256 downsampling uses the terminal's colors too.
+   * Colors the terminal doesn't report keep their xterm defaults. Rejects with
+   * StatusReportError if the terminal reports none.
+   */
+  async queryPalette(size: 16 | 256 = 16): Promise<Palette> {
+    const input = this.oscInput();
+    if (!input || !this.isTTY()) {
+      throw new StatusReportError();
+    }
+
+    const options = { timeout: this.statusReportTimeout, raw: !this.unsafe };
+    const reported = await withStatusReportReader(input, options, async (reader) => {
+      const deadline = Date.now() + this.statusReportTimeout;
+      const colors = new Map<number, RGBColor>();
+      for (let i = 0; i < size; i++) {
+        this.send(paletteColorQuery(i));
+      }
+      // every terminal answers the cursor position query, so its reply ends the colors
+      this.send(`${CSI}6n`);
+      this.sendBuffer();
+
+      for (;;) {
+        const res = await reader.readResponse();
+        if (res.kind === 'csi' && parseCursorPosition(res.response)) {
+          return colors;
+        }
+
+        const report = res.kind === 'osc' ? parsePaletteReport(res.response) : null;
+        if (report) {
+          colors.set(report.index, report.color);
+        } else {
+          reader.unread(res);
+        }
+        if (Date.now() > deadline) {
+          throw new StatusReportError('timed out waiting for palette colors');
+        }
+      }
+    });
+
+    if (reported.size === 0) {
+      throw new StatusReportError('terminal did not report its palette');
+    }
+    const colors = Array.from(
+      { length: size },
+      (_, i) => reported.get(i) ?? DefaultPalette.color(i) ?? new RGBColor('#000000')
+    );
+    this.palette = new Palette(colors);
+    return this.palette;
+  }
+
   private _foregroundColor(): Color {
     if (!this.isTTY()) {
       return new NoColor();
     }
 
-    // Try terminal status report (not implemented in Node.js for simplicity)
-    // In a full implementation, this would query the terminal
+    // Use the color reported by the terminal, see queryForegroundColor
+    if (this._fgReported) {
+      return this._fgReported;
+    }
 
     // Check COLORFGBG environment variable
     const colorFGBG = this.environ.getenv('COLORFGBG');
@@ -283,8 +948,10 @@ export class OutputImpl implements IOutput {
       return new NoColor();
     }
 
-    // Try terminal status report (not implemented in Node.js for simplicity)
-    // In a full implementation, this would query the terminal
+    // Use the color reported by the terminal, see queryBackgroundColor
+    if (this._bgReported) {
+      return this._bgReported;
+    }
 
     // Check COLORFGBG environment variable
     const colorFGBG = this.environ.getenv('COLORFGBG');
@@ -315,149 +982,60 @@ export class OutputImpl implements IOutput {
   }
 
   /**
-   * Color creates a Color from a string. Valid inputs are hex colors, as well as
-   * ANSI color codes (0-15, 16-255).
-   * This method is a direct port of the Go Profile.Color method, adapted for Output.
+   * Color creates a Color from a string. Valid inputs are hex colors, ANSI color
+   * codes (0-15, 16-255), CSS and X11 color names, rgb(), hsl() and hwb(), and the
+   * X11 rgb: and rgbi: forms, see parseColor. With withStrictColors it throws an
+   * InvalidColorError for strings that aren't colors instead of returning null.
+   * This method is a port of the Go Profile.Color method, adapted for Output.
    */
   color(s: string): Color | null {
-    if (!s || s.length === 0) {
+    const c = colorFromString(s, this.strictColors);
+    if (!c) {
       return null;
     }
-
-    let c: Color;
-    if (s.startsWith('#')) {
-      c = new RGBColor(s);
-    } else {
-      const i = parseInt(s, 10);
-      if (Number.isNaN(i)) {
-        return null;
-      }
-
-      if (i < 16) {
-        c = new ANSIColor(i);
-      } else {
-        c = new ANSI256Color(i);
-      }
-    }
-
     return this.convertColor(c);
   }
 
   /**
-   * Convert transforms a given Color to a Color supported within the current Profile.
+   * Convert transforms a given Color to a Color supported within the current
+   * Profile, downsampling with the output's color metric to its palette.
    * Port of Go Profile.Convert method.
    */
   private convertColor(c: Color): Color {
-    if (this.profile === Profile.Ascii) {
-      return new NoColor();
-    }
-
-    if (c instanceof ANSIColor) {
-      return c;
-    }
-
-    if (c instanceof ANSI256Color) {
-      if (this.profile === Profile.ANSI) {
-        return this.ansi256ToANSIColor(c);
-      }
-      return c;
-    }
-
-    if (c instanceof RGBColor) {
-      const colorfulColor = convertToRGB(c);
-      if (!colorfulColor) {
-        return new NoColor();
-      }
-      if (this.profile !== Profile.TrueColor) {
-        const ac = this.hexToANSI256Color(colorfulColor);
-        if (this.profile === Profile.ANSI) {
-          return this.ansi256ToANSIColor(ac);
-        }
-        return ac;
-      }
-      return c;
-    }
-
-    return c;
+    return convertColor(this.profile, c, this.colorMetric, this.palette);
   }
 
   /**
-   * Convert ANSI256Color to ANSIColor using HSLuv distance matching.
-   * Port of Go ansi256ToANSIColor function.
+   * CursorPosition asks the terminal where the cursor is (DSR 6n) and returns its
+   * 1-based row and column. Keys typed while waiting for the answer are handed back
+   * to the input stream. Rejects with StatusReportError on timeout.
    */
-  private ansi256ToANSIColor(c: ANSI256Color): ANSIColor {
-    let result = 0;
-    let minDistance = Number.MAX_VALUE;
-
-    const sourceColor = convertToRGB(c);
-    if (!sourceColor) {
-      return new ANSIColor(0);
+  async cursorPosition(): Promise<CursorPosition> {
+    const input = this.input();
+    if (!input || !this.isTTY()) {
+      throw new StatusReportError();
     }
 
-    for (let i = 0; i <= 15; i++) {
-      const ansiColor = new ANSIColor(i);
-      const targetColor = convertToRGB(ansiColor);
-      if (!targetColor) continue;
+    const options = { timeout: this.statusReportTimeout, raw: !this.unsafe };
+    return withStatusReportReader(input, options, async (reader) => {
+      const deadline = Date.now() + this.statusReportTimeout;
+      this.send(`${CSI}6n`);
+      this.sendBuffer();
+
+      for (;;) {
+        const res = await reader.readResponse();
+        const pos = res.kind === 'csi' ? parseCursorPosition(res.response) : null;
+        if (pos) {
+          return pos;
+        }
 
-      const distance = sourceColor.distanceHSLuv(targetColor);
-      if (distance < minDistance) {
-        minDistance = distance;
-        result = i;
+        // not ours, e.g. an arrow key pressed while waiting
+        reader.unread(res);
+        if (Date.now() > deadline) {
+          throw new StatusReportError('timed out waiting for cursor position report');
+        }
       }
-    }
-
-    return new ANSIColor(result);
-  }
-
-  /**
-   * Convert RGB color to ANSI256Color using the same algorithm as Go.
-   * Port of Go hexToANSI256Color function.
-   */
-  private hexToANSI256Color(c: ReturnType<typeof convertToRGB>): ANSI256Color {
-    if (!c) {
-      return new ANSI256Color(0);
-    }
-
-    const v2ci = (v: number): number => {
-      if (v < 48) return 0;
-      if (v < 115) return 1;
-      return Math.floor((v - 35) / 40);
-    };
-
-    // Calculate the nearest 0-based color index at 16..231
-    const r = v2ci(c.r * 255.0); // 0..5 each
-    const g = v2ci(c.g * 255.0);
-    const b = v2ci(c.b * 255.0);
-    const ci = 36 * r + 6 * g + b; // 0..215
-
-    // Calculate the represented colors back from the index
-    const i2cv = [0, 0x5f, 0x87, 0xaf, 0xd7, 0xff];
-    const cr = i2cv[r] ?? 0; // r/g/b, 0..255 each
-    const cg = i2cv[g] ?? 0;
-    const cb = i2cv[b] ?? 0;
-
-    // Calculate the nearest 0-based gray index at 232..255
-    let grayIdx: number;
-    const average = (r + g + b) / 3;
-    if (average > 238) {
-      grayIdx = 23;
-    } else {
-      grayIdx = Math.floor((average - 3) / 10); // 0..23
-    }
-    const gv = 8 + 10 * grayIdx; // same value for r/g/b, 0..255
-
-    // Return the one which is nearer to the original input rgb value
-    const c2 = { r: cr / 255.0, g: cg / 255.0, b: cb / 255.0 };
-    const g2 = { r: gv / 255.0, g: gv / 255.0, b: gv / 255.0 };
-
-    // Simple RGB distance calculation (could use HSLuv for better accuracy)
-    const colorDist = Math.sqrt((c.r - c2.r) ** 2 + (c.g - c2.g) ** 2 + (c.b - c2.b) ** 2);
-    const grayDist = Math.sqrt((c.r - g2.r) ** 2 + (c.g - g2.g) ** 2 + (c.b - g2.b) ** 2);
-
-    if (colorDist <= grayDist) {
-      return new ANSI256Color(16 + ci);
-    }
-    return new ANSI256Color(232 + grayIdx);
+    });
   }
 
   // Terminal control methods - delegate to ScreenControl
@@ -611,6 +1189,92 @@ export class OutputImpl implements IOutput {
     this._screen.disableBracketedPaste();
   }
 
+  // Synchronized output
+  beginSynchronizedUpdate(): void {
+    this._screen.beginSynchronizedUpdate();
+  }
+
+  endSynchronizedUpdate(): void {
+    this._screen.endSynchronizedUpdate();
+  }
+
+  /**
+   * WithSynchronizedOutput runs fn between begin and end synchronized update
+   * sequences, so the terminal shows everything fn draws at once. The bracket is
+   * closed even if fn throws; if fn returns a promise, it is closed once the
+   * promise settles. Nested calls share the outermost bracket.
+   */
+  withSynchronizedOutput<T>(fn: () => T): T {
+    if (this._syncDepth++ === 0) {
+      this.beginSynchronizedUpdate();
+    }
+    const end = () => {
+      if (--this._syncDepth === 0) {
+        this.endSynchronizedUpdate();
+      }
+    };
+
+    let result: T;
+    try {
+      result = fn();
+    } catch (err) {
+      end();
+      throw err;
+    }
+
+    if (result instanceof Promise) {
+      return result.finally(end) as T;
+    }
+    end();
+    return result;
+  }
+
+  /**
+   * SupportsSynchronizedOutput asks the terminal whether it knows mode 2026, using
+   * a DECRQM request. Terminals that don't answer are reported as unsupported.
+   */
+  async supportsSynchronizedOutput(): Promise<boolean> {
+    const input = this.input();
+    if (!input || !this.isTTY()) {
+      return false;
+    }
+
+    const options = { timeout: this.statusReportTimeout, raw: !this.unsafe };
+    try {
+      return await withStatusReportReader(input, options, async (reader) => {
+        const deadline = Date.now() + this.statusReportTimeout;
+
+        // DA1 goes last: terminals that ignore DECRQM still answer it
+        this.send(SEQUENCES.RequestSynchronizedUpdateMode);
+        this.send(PrimaryDeviceAttributesQuery);
+        this.sendBuffer();
+
+        let supported = false;
+        for (;;) {
+          const res = await reader.readResponse();
+          const mode = res.kind === 'csi' ? parseModeReport(res.response) : null;
+          if (mode && mode.mode === 2026) {
+            // 1: set, 2: reset, 3: permanently set
+            supported = mode.value >= 1 && mode.value <= 3;
+          } else if (res.kind === 'csi' && parsePrimaryDeviceAttributes(res.response)) {
+            return supported;
+          } else {
+            reader.unread(res);
+          }
+
+          if (Date.now() > deadline) {
+            throw new StatusReportError('timed out waiting for mode report');
+          }
+        }
+      });
+    } catch (err) {
+      if (err instanceof StatusReportError) {
+        return false;
+      }
+      throw err;
+    }
+  }
+
   // Scrolling
   changeScrollingRegion(top: number, bottom: number): void {
     this._screen.changeScrollingRegion(top, bottom);
@@ -664,6 +1328,17 @@ export function withColorCache(enabled: boolean): OutputOption<OutputImpl> {
   };
 }
 
+/**
+ * WithColorMetric sets how colors are downsampled for the ANSI256 and ANSI
+ * profiles: 'hsluv' like Go (the default), 'ciede2000', 'oklab', 'redmean' or a
+ * distance function
+ */
+export function withColorMetric(metric: ColorMetric): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.colorMetric = metric;
+  };
+}
+
 export function withEnvironment(environ: Environ): OutputOption<OutputImpl> {
   return (o: OutputImpl) => {
     o.environ = environ;
@@ -682,6 +1357,136 @@ export function withUnsafe(): OutputOption<OutputImpl> {
   };
 }
 
+/**
+ * WithInput sets the stream terminal status reports are read from
+ */
+export function withInput(input: InputStream): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.setInput(input);
+  };
+}
+
+/**
+ * WithTerminalIdentity sets a known terminal identity, e.g. one saved from an
+ * earlier probeTerminal() call, to be used for profile detection
+ */
+export function withTerminalIdentity(identity: TerminalIdentity): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.setTerminalIdentity(identity);
+  };
+}
+
+/**
+ * WithSyncWriter writes output synchronously to a file descriptor, e.g. 1 for
+ * stdout, instead of the writer stream. See OutputImpl.setSyncWriter.
+ */
+export function withSyncWriter(fd: number): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.setSyncWriter(fd);
+  };
+}
+
+/**
+ * WithErrorHandler sets the function that receives write errors of the control
+ * methods, which don't return a promise. It replaces the default policy, including
+ * the silent exit on a broken pipe.
+ */
+export function withErrorHandler(handler: (err: Error) => void): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.onError = handler;
+  };
+}
+
+/**
+ * WithBuffering collects output in memory and writes it in one call on flush(),
+ * once the threshold is reached, or at the end of the microtask with
+ * autoFlush 'microtask'
+ */
+export function withBuffering(options: BufferingOptions = {}): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.setBuffering(options);
+  };
+}
+
+/**
+ * WithExtendedUnderline enables or disables underline styles and colors,
+ * overriding detection
+ */
+export function withExtendedUnderline(enabled: boolean): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.setExtendedUnderline(enabled);
+  };
+}
+
+/**
+ * WithHyperlinks enables or disables OSC 8 hyperlinks in styles, overriding detection
+ */
+export function withHyperlinks(enabled: boolean): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.setHyperlinks(enabled);
+  };
+}
+
+/**
+ * WithLineMode sets how styles cover text with newlines. 'lines' styles every line
+ * on its own, which pagers and log collectors that handle lines separately need.
+ */
+export function withLineMode(mode: LineMode): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.lineMode = mode;
+  };
+}
+
+/**
+ * WithLinkFallback sets how styles render their links where hyperlinks aren't
+ * supported, by default "text (url)"
+ */
+export function withLinkFallback(fallback: LinkFallback): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.linkFallback = fallback;
+  };
+}
+
+/**
+ * WithPalette sets the terminal colors that colors are downsampled to, as a
+ * Palette or a list of colors for indices 0, 1, 2..., e.g. a theme's 16 colors
+ */
+export function withPalette(palette: Palette | (string | Color)[]): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.palette = palette instanceof Palette ? palette : new Palette(palette);
+  };
+}
+
+/**
+ * WithResetStrategy sets how styles end. 'minimal' resets only the attributes a
+ * style set, so colors set with setForegroundColor() survive styled strings.
+ */
+export function withResetStrategy(strategy: ResetStrategy): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.resetStrategy = strategy;
+  };
+}
+
+/**
+ * WithStatusReportTimeout sets how long to wait for terminal status reports, in milliseconds
+ */
+export function withStatusReportTimeout(timeout: number): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.statusReportTimeout = timeout;
+  };
+}
+
+/**
+ * WithStrictColors makes color() throw an InvalidColorError for strings that
+ * aren't colors, and styles throw one for colors that would render nothing, such
+ * as rgbColor('#GGGGGG') or ansiColor(16). By default they are dropped, like in Go.
+ */
+export function withStrictColors(enabled = true): OutputOption<OutputImpl> {
+  return (o: OutputImpl) => {
+    o.strictColors = enabled;
+  };
+}
+
 /**
  * Global default output management
  */
@@ -740,3 +1545,36 @@ export function parseXTermColor(s: string): RGBColor | null {
     return null;
   }
 }
+
+/**
+ * Parse a cursor position report of the form CSI row ; column R
+ */
+export function parseCursorPosition(s: string): CursorPosition | null {
+  if (!s.startsWith(CSI) || !s.endsWith('R')) {
+    return null;
+  }
+
+  const parts = s.slice(CSI.length, -1).split(';');
+  if (parts.length !== 2 || !parts.every((p) => /^\d+$/.test(p))) {
+    return null;
+  }
+
+  return { row: parseInt(parts[0] ?? '', 10), column: parseInt(parts[1] ?? '', 10) };
+}
+
+/**
+ * Parse a DECRPM mode report of the form CSI ? mode ; value $ y
+ */
+export function parseModeReport(s: string): { mode: number; value: number } | null {
+  const prefix = `${CSI}?`;
+  if (!s.startsWith(prefix) || !s.endsWith('$y')) {
+    return null;
+  }
+
+  const parts = s.slice(prefix.length, -2).split(';');
+  if (parts.length !== 2 || !parts.every((p) => /^\d+$/.test(p))) {
+    return null;
+  }
+
+  return { mode: parseInt(parts[0] ?? '', 10), value: parseInt(parts[1] ?? '', 10) };
+}
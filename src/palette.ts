@@ -0,0 +1,133 @@
+/**
+ * Terminal color palettes.
+ * A palette holds the RGB values of the 256 indexed colors, which terminal themes
+ * like Solarized or Gruvbox redefine, so colors can be downsampled to what the
+ * terminal actually shows.
+ */
+
+import { createHash } from 'node:crypto';
+import { Color as ColorfulColor, Hex } from '@tsports/go-colorful';
+import { parseColor, validateColor } from './color-parser.js';
+import {
+  ansiHex,
+  BEL,
+  type Color,
+  convertToRGB,
+  InvalidColorError,
+  OSC,
+  RGBColor,
+  ST,
+} from './types.js';
+
+/**
+ * Palette is the set of RGB values of the ANSI and ANSI256 colors. Colors that
+ * aren't given keep their xterm defaults. Palettes are immutable.
+ */
+export class Palette {
+  /**
+   * Identifies the colors of the palette in conversion caches: 'xterm' for the
+   * xterm defaults, otherwise a digest, so equal palettes share cache entries
+   */
+  readonly id: string;
+  /** Whether any of the ANSI colors 0-15 differs from xterm */
+  readonly customANSI: boolean;
+  /** Whether any of the ANSI256 colors 16-255 differs from xterm */
+  readonly customANSI256: boolean;
+  private readonly hexes: string[];
+  private readonly channels: ColorfulColor[];
+
+  /**
+   * Creates a palette from colors for indices 0, 1, 2... Strings are parsed with
+   * parseColor and must be colors; colors beyond the 256th are ignored.
+   */
+  constructor(colors: (string | Color)[] = []) {
+    const defaults = Array.from({ length: 256 }, (_, i) => ansiHex[i] ?? '#000000');
+    this.hexes = defaults.map((hex, i) => {
+      const c = colors[i];
+      return c === undefined ? hex : paletteHex(c);
+    });
+    this.channels = this.hexes.map((hex) => Hex(hex));
+
+    const differs = (hex: string, i: number) => hex !== defaults[i];
+    this.customANSI = this.hexes.slice(0, 16).some(differs);
+    this.customANSI256 = this.hexes.some((hex, i) => i >= 16 && differs(hex, i));
+    this.id =
+      this.customANSI || this.customANSI256
+        ? createHash('sha1').update(this.hexes.join('')).digest('base64url')
+        : 'xterm';
+  }
+
+  /**
+   * Color returns the color at an index, or null outside 0-255
+   */
+  color(index: number): RGBColor | null {
+    const hex = this.hexes[index];
+    return hex ? new RGBColor(hex) : null;
+  }
+
+  /**
+   * RGB returns the channels of the color at an index, for distance functions
+   */
+  rgb(index: number): ColorfulColor | undefined {
+    return this.channels[index];
+  }
+
+  /**
+   * Colors returns the 256 colors of the palette
+   */
+  colors(): RGBColor[] {
+    return this.hexes.map((hex) => new RGBColor(hex));
+  }
+}
+
+// #rrggbb of a palette entry
+function paletteHex(c: string | Color): string {
+  const color = typeof c === 'string' ? parseColor(c, { strict: true }) : c;
+  validateColor(color);
+  const rgb = convertToRGB(color);
+  if (!rgb) {
+    throw new InvalidColorError(`invalid palette color ${String(c)}: not an RGB color`);
+  }
+  return rgb.hex();
+}
+
+/**
+ * DefaultPalette holds the xterm colors that Go termenv converts to
+ */
+export const DefaultPalette = new Palette();
+
+/**
+ * PaletteColorQuery is the OSC 4 query for the color at an index
+ */
+export function paletteColorQuery(index: number): string {
+  return `${OSC}4;${index};?${ST}`;
+}
+
+/**
+ * ParsePaletteReport parses an OSC 4 color report like
+ * "ESC ] 4 ; 1 ; rgb:dcdc/3232/2f2f ST", or returns null
+ */
+export function parsePaletteReport(s: string): { index: number; color: RGBColor } | null {
+  if (!s.startsWith(`${OSC}4;`)) {
+    return null;
+  }
+  let body = s.slice(OSC.length + 2);
+  if (body.endsWith(BEL)) {
+    body = body.slice(0, -BEL.length);
+  } else if (body.endsWith(ST)) {
+    body = body.slice(0, -ST.length);
+  } else {
+    return null;
+  }
+
+  const m = /^(\d{1,3});(.+)$/.exec(body);
+  if (!m) {
+    return null;
+  }
+  const index = Number(m[1]);
+  const color = parseColor(m[2] ?? '');
+  if (index > 255 || !(color instanceof RGBColor)) {
+    return null;
+  }
+  return { index, color };
+}
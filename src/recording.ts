@@ -0,0 +1,106 @@
+/**
+ * In-memory output, the equivalent of passing a strings.Builder to Go NewOutput.
+ */
+
+import { Writable } from 'node:stream';
+import { stripAnsi, type Token, tokenize } from './ansi.js';
+import { OutputImpl } from './output.js';
+import type { OutputOption } from './types.js';
+
+/**
+ * WriteRecord is a single write captured by a MemoryWriter
+ */
+export interface WriteRecord {
+  data: string;
+  /** Time of the write, in milliseconds since the epoch */
+  time: number;
+}
+
+/**
+ * MemoryWriter is a writable stream that keeps everything written to it.
+ * Writes are recorded synchronously.
+ */
+export class MemoryWriter extends Writable {
+  public records: WriteRecord[] = [];
+
+  constructor() {
+    super({ decodeStrings: false });
+  }
+
+  override _write(
+    chunk: Buffer | string,
+    _encoding: BufferEncoding,
+    callback: (err?: Error | null) => void
+  ): void {
+    const data = typeof chunk === 'string' ? chunk : chunk.toString('utf8');
+    this.records.push({ data, time: Date.now() });
+    callback();
+  }
+}
+
+/**
+ * RecordingOutput is an Output that writes to memory, for tests and for capturing
+ * styled output.
+ */
+export class RecordingOutput extends OutputImpl {
+  private readonly memory: MemoryWriter;
+
+  constructor(...opts: OutputOption<OutputImpl>[]) {
+    const memory = new MemoryWriter();
+    super(memory, ...opts);
+    this.memory = memory;
+  }
+
+  /**
+   * Records returns every write with its timestamp
+   */
+  records(): WriteRecord[] {
+    return [...this.memory.records];
+  }
+
+  /**
+   * Text returns everything written, escape sequences included
+   */
+  text(): string {
+    return this.memory.records.map((r) => r.data).join('');
+  }
+
+  /**
+   * Tokens returns the written text split into text and escape sequence tokens
+   */
+  tokens(): Token[] {
+    return tokenize(this.text());
+  }
+
+  /**
+   * Sequences returns the escape sequences written, in order
+   */
+  sequences(): string[] {
+    return this.tokens()
+      .filter((t) => t.kind !== 'text')
+      .map((t) => t.value);
+  }
+
+  /**
+   * PlainText returns the written text without escape sequences
+   */
+  plainText(): string {
+    return stripAnsi(this.text());
+  }
+
+  /**
+   * ClearRecording discards everything recorded so far. Unlike reset(), which
+   * writes the terminal reset sequence, it writes nothing.
+   */
+  clearRecording(): void {
+    this.memory.records = [];
+  }
+}
+
+/**
+ * NewMemoryOutput returns an output that records everything written to it.
+ * Like a Go strings.Builder it is not a terminal unless withTTY(true) is given.
+ */
+export function newMemoryOutput(...opts: OutputOption<OutputImpl>[]): RecordingOutput {
+  return new RecordingOutput(...opts);
+}
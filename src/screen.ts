@@ -3,7 +3,7 @@
  * Port of github.com/muesli/termenv/screen.go
  */
 
-import type { Color, Output } from './types.js';
+import { type Color, type Output, sendString } from './types.js';
 
 /**
  * Terminal control sequences
@@ -58,6 +58,11 @@ export const SEQUENCES = {
   EnableBracketedPaste: '\x1b[?2004h',
   DisableBracketedPaste: '\x1b[?2004l',
 
+  // Synchronized output (DEC mode 2026)
+  BeginSynchronizedUpdate: '\x1b[?2026h',
+  EndSynchronizedUpdate: '\x1b[?2026l',
+  RequestSynchronizedUpdateMode: '\x1b[?2026$p',
+
   // Scrolling
   ChangeScrollingRegion: '\x1b[%d;%dr',
   InsertLines: '\x1b[%dL',
@@ -91,73 +96,76 @@ export class ScreenControl {
 
   // Cursor positioning
   moveCursor(row: number, column: number): this {
-    this.output.writeString(
+    sendString(
+      this.output,
       SEQUENCES.CursorPosition.replace('%d', row.toString()).replace('%d', column.toString())
     );
     return this;
   }
 
   cursorUp(n: number = 1): this {
-    this.output.writeString(SEQUENCES.CursorUp.replace('%d', n.toString()));
+    sendString(this.output, SEQUENCES.CursorUp.replace('%d', n.toString()));
     return this;
   }
 
   cursorDown(n: number = 1): this {
-    this.output.writeString(SEQUENCES.CursorDown.replace('%d', n.toString()));
+    sendString(this.output, SEQUENCES.CursorDown.replace('%d', n.toString()));
     return this;
   }
 
   cursorForward(n: number = 1): this {
-    this.output.writeString(SEQUENCES.CursorForward.replace('%d', n.toString()));
+    sendString(this.output, SEQUENCES.CursorForward.replace('%d', n.toString()));
     return this;
   }
 
   cursorBack(n: number = 1): this {
-    this.output.writeString(SEQUENCES.CursorBack.replace('%d', n.toString()));
+    sendString(this.output, SEQUENCES.CursorBack.replace('%d', n.toString()));
     return this;
   }
 
   cursorNextLine(n: number = 1): this {
-    this.output.writeString(SEQUENCES.CursorNextLine.replace('%d', n.toString()));
+    sendString(this.output, SEQUENCES.CursorNextLine.replace('%d', n.toString()));
     return this;
   }
 
   cursorPreviousLine(n: number = 1): this {
-    this.output.writeString(SEQUENCES.CursorPreviousLine.replace('%d', n.toString()));
+    sendString(this.output, SEQUENCES.CursorPreviousLine.replace('%d', n.toString()));
     return this;
   }
 
   saveCursorPosition(): this {
-    this.output.writeString(SEQUENCES.SaveCursorPosition);
+    sendString(this.output, SEQUENCES.SaveCursorPosition);
     return this;
   }
 
   restoreCursorPosition(): this {
-    this.output.writeString(SEQUENCES.RestoreCursorPosition);
+    sendString(this.output, SEQUENCES.RestoreCursorPosition);
     return this;
   }
 
   // Cursor visibility
   hideCursor(): this {
-    this.output.writeString(SEQUENCES.HideCursor);
+    sendString(this.output, SEQUENCES.HideCursor);
     return this;
   }
 
   showCursor(): this {
-    this.output.writeString(SEQUENCES.ShowCursor);
+    sendString(this.output, SEQUENCES.ShowCursor);
     return this;
   }
 
   // Screen clearing
   clearScreen(): this {
-    this.output.writeString(
+    sendString(
+      this.output,
       SEQUENCES.EraseDisplay.replace('%d', EraseMode.EraseEntireDisplay.toString())
     );
     return this;
   }
 
   clearLine(): this {
-    this.output.writeString(
+    sendString(
+      this.output,
       SEQUENCES.EraseLine.replace('%d', EraseLineMode.EraseEntireLine.toString())
     );
     return this;
@@ -175,152 +183,164 @@ export class ScreenControl {
 
   // Screen modes
   altScreen(): this {
-    this.output.writeString(SEQUENCES.AltScreen);
+    sendString(this.output, SEQUENCES.AltScreen);
     return this;
   }
 
   exitAltScreen(): this {
-    this.output.writeString(SEQUENCES.ExitAltScreen);
+    sendString(this.output, SEQUENCES.ExitAltScreen);
     return this;
   }
 
   saveScreen(): this {
-    this.output.writeString(SEQUENCES.SaveScreen);
+    sendString(this.output, SEQUENCES.SaveScreen);
     return this;
   }
 
   restoreScreen(): this {
-    this.output.writeString(SEQUENCES.RestoreScreen);
+    sendString(this.output, SEQUENCES.RestoreScreen);
     return this;
   }
 
   // Reset
   reset(): this {
-    this.output.writeString(SEQUENCES.Reset);
+    sendString(this.output, SEQUENCES.Reset);
     return this;
   }
 
   // Colors
   setForegroundColor(color: Color): this {
-    this.output.writeString(`\x1b[38;${color.sequence(false)}`);
+    sendString(this.output, `\x1b[38;${color.sequence(false)}`);
     return this;
   }
 
   setBackgroundColor(color: Color): this {
-    this.output.writeString(`\x1b[48;${color.sequence(true)}`);
+    sendString(this.output, `\x1b[48;${color.sequence(true)}`);
     return this;
   }
 
   setCursorColor(color: Color): this {
     // OSC 12 - Set cursor color
-    this.output.writeString(`\x1b]12;${color.sequence(false)}\x07`);
+    sendString(this.output, `\x1b]12;${color.sequence(false)}\x07`);
     return this;
   }
 
   // Window title
   setWindowTitle(title: string): this {
     // OSC 2 - Set window title
-    this.output.writeString(`\x1b]2;${title}\x07`);
+    sendString(this.output, `\x1b]2;${title}\x07`);
     return this;
   }
 
   // Mouse support
   enableMouse(): this {
-    this.output.writeString(SEQUENCES.EnableMouse);
+    sendString(this.output, SEQUENCES.EnableMouse);
     return this;
   }
 
   disableMouse(): this {
-    this.output.writeString(SEQUENCES.DisableMouse);
+    sendString(this.output, SEQUENCES.DisableMouse);
     return this;
   }
 
   enableMousePress(): this {
-    this.output.writeString(SEQUENCES.EnableMousePress);
+    sendString(this.output, SEQUENCES.EnableMousePress);
     return this;
   }
 
   disableMousePress(): this {
-    this.output.writeString(SEQUENCES.DisableMousePress);
+    sendString(this.output, SEQUENCES.DisableMousePress);
     return this;
   }
 
   enableMouseHilite(): this {
-    this.output.writeString(SEQUENCES.EnableMouseHilite);
+    sendString(this.output, SEQUENCES.EnableMouseHilite);
     return this;
   }
 
   disableMouseHilite(): this {
-    this.output.writeString(SEQUENCES.DisableMouseHilite);
+    sendString(this.output, SEQUENCES.DisableMouseHilite);
     return this;
   }
 
   enableMouseCellMotion(): this {
-    this.output.writeString(SEQUENCES.EnableMouseCellMotion);
+    sendString(this.output, SEQUENCES.EnableMouseCellMotion);
     return this;
   }
 
   disableMouseCellMotion(): this {
-    this.output.writeString(SEQUENCES.DisableMouseCellMotion);
+    sendString(this.output, SEQUENCES.DisableMouseCellMotion);
     return this;
   }
 
   enableMouseAllMotion(): this {
-    this.output.writeString(SEQUENCES.EnableMouseAllMotion);
+    sendString(this.output, SEQUENCES.EnableMouseAllMotion);
     return this;
   }
 
   disableMouseAllMotion(): this {
-    this.output.writeString(SEQUENCES.DisableMouseAllMotion);
+    sendString(this.output, SEQUENCES.DisableMouseAllMotion);
     return this;
   }
 
   enableMouseExtendedMode(): this {
-    this.output.writeString(SEQUENCES.EnableMouseExtendedMode);
+    sendString(this.output, SEQUENCES.EnableMouseExtendedMode);
     return this;
   }
 
   disableMouseExtendedMode(): this {
-    this.output.writeString(SEQUENCES.DisableMouseExtendedMode);
+    sendString(this.output, SEQUENCES.DisableMouseExtendedMode);
     return this;
   }
 
   enableMousePixelsMode(): this {
-    this.output.writeString(SEQUENCES.EnableMousePixelsMode);
+    sendString(this.output, SEQUENCES.EnableMousePixelsMode);
     return this;
   }
 
   disableMousePixelsMode(): this {
-    this.output.writeString(SEQUENCES.DisableMousePixelsMode);
+    sendString(this.output, SEQUENCES.DisableMousePixelsMode);
     return this;
   }
 
   // Bracketed paste
   enableBracketedPaste(): this {
-    this.output.writeString(SEQUENCES.EnableBracketedPaste);
+    sendString(this.output, SEQUENCES.EnableBracketedPaste);
     return this;
   }
 
   disableBracketedPaste(): this {
-    this.output.writeString(SEQUENCES.DisableBracketedPaste);
+    sendString(this.output, SEQUENCES.DisableBracketedPaste);
+    return this;
+  }
+
+  // Synchronized output
+  beginSynchronizedUpdate(): this {
+    sendString(this.output, SEQUENCES.BeginSynchronizedUpdate);
+    return this;
+  }
+
+  endSynchronizedUpdate(): this {
+    sendString(this.output, SEQUENCES.EndSynchronizedUpdate);
     return this;
   }
 
   // Scrolling
   changeScrollingRegion(top: number, bottom: number): this {
-    this.output.writeString(
+    sendString(
+      this.output,
       SEQUENCES.ChangeScrollingRegion.replace('%d', top.toString()).replace('%d', bottom.toString())
     );
     return this;
   }
 
   insertLines(n: number): this {
-    this.output.writeString(SEQUENCES.InsertLines.replace('%d', n.toString()));
+    sendString(this.output, SEQUENCES.InsertLines.replace('%d', n.toString()));
     return this;
   }
 
   deleteLines(n: number): this {
-    this.output.writeString(SEQUENCES.DeleteLines.replace('%d', n.toString()));
+    sendString(this.output, SEQUENCES.DeleteLines.replace('%d', n.toString()));
     return this;
   }
 }
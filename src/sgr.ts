@@ -0,0 +1,196 @@
+/**
+ * SGR (Select Graphic Rendition) state tracking.
+ * Models which attributes a sequence of SGR parameters turns on, so they can be
+ * closed with their specific off codes or changed with a minimal delta.
+ */
+
+import { tokenize } from './ansi.js';
+import { CSI } from './types.js';
+
+/**
+ * SGRAttribute is a rendition attribute that can be set and reset on its own
+ */
+export type SGRAttribute =
+  | 'bold'
+  | 'faint'
+  | 'italic'
+  | 'underline'
+  | 'blink'
+  | 'reverse'
+  | 'crossOut'
+  | 'overline'
+  | 'foreground'
+  | 'background'
+  | 'underlineColor';
+
+/**
+ * SGRState maps the attributes that are set to the parameters that set them,
+ * e.g. { bold: '1', foreground: '38;5;200' }. Unset attributes are at their default.
+ */
+export type SGRState = Partial<Record<SGRAttribute, string>>;
+
+/**
+ * SGROff holds the code that resets each attribute. Bold and faint share 22.
+ */
+export const SGROff: Record<SGRAttribute, string> = {
+  bold: '22',
+  faint: '22',
+  italic: '23',
+  underline: '24',
+  blink: '25',
+  reverse: '27',
+  crossOut: '29',
+  overline: '55',
+  foreground: '39',
+  background: '49',
+  underlineColor: '59',
+};
+
+// Attributes in the order their parameters are emitted
+const attributeOrder = Object.keys(SGROff) as SGRAttribute[];
+
+const setCodes: { [code: string]: SGRAttribute } = {
+  1: 'bold',
+  2: 'faint',
+  3: 'italic',
+  4: 'underline',
+  5: 'blink',
+  6: 'blink',
+  7: 'reverse',
+  9: 'crossOut',
+  21: 'underline',
+  53: 'overline',
+};
+
+// Off codes by the attributes they reset
+const offCodes: { [code: string]: SGRAttribute[] } = {};
+for (const attr of attributeOrder) {
+  const code = SGROff[attr];
+  offCodes[code] = [...(offCodes[code] ?? []), attr];
+}
+
+/**
+ * SGRGroups splits SGR parameters into groups that each set or reset one thing,
+ * keeping the arguments of extended colors (38;5;n, 38;2;r;g;b) together
+ */
+export function sgrGroups(params: string): string[] {
+  const parts = params.split(';');
+  const groups: string[] = [];
+  for (let i = 0; i < parts.length; i++) {
+    const p = parts[i] ?? '';
+    if ((p === '38' || p === '48' || p === '58') && i + 1 < parts.length) {
+      const n = parts[i + 1] === '5' ? 2 : parts[i + 1] === '2' ? 4 : 0;
+      groups.push(parts.slice(i, i + n + 1).join(';'));
+      i += n;
+      continue;
+    }
+    groups.push(p);
+  }
+  return groups;
+}
+
+/**
+ * ApplySGR returns the state after the given SGR parameters. Unknown parameters
+ * are ignored.
+ */
+export function applySGR(state: SGRState, params: string): SGRState {
+  const attrs = new Map(Object.entries(state) as [SGRAttribute, string][]);
+  for (const group of sgrGroups(params)) {
+    const code = group.split(/[:;]/)[0] ?? '';
+    const n = /^\d*$/.test(code) ? Number(code) : -1;
+
+    if (n === 0) {
+      attrs.clear();
+    } else if (offCodes[code] || group === '4:0') {
+      for (const attr of offCodes[code] ?? ['underline' as const]) {
+        attrs.delete(attr);
+      }
+    } else if (setCodes[code]) {
+      attrs.set(setCodes[code], group);
+    } else if ((n >= 30 && n <= 38) || (n >= 90 && n <= 97)) {
+      attrs.set('foreground', group);
+    } else if ((n >= 40 && n <= 48) || (n >= 100 && n <= 107)) {
+      attrs.set('background', group);
+    } else if (n === 58) {
+      attrs.set('underlineColor', group);
+    }
+  }
+  return Object.fromEntries(attrs);
+}
+
+/**
+ * CloseSGR returns the parameters that reset exactly the attributes set in state,
+ * or an empty string if none are
+ */
+export function closeSGR(state: SGRState): string {
+  const codes = new Set<string>();
+  for (const attr of attributeOrder) {
+    if (state[attr] !== undefined) {
+      codes.add(SGROff[attr]);
+    }
+  }
+  return [...codes].join(';');
+}
+
+/**
+ * DiffSGR returns the parameters that change from into to, using off codes rather
+ * than a full reset so attributes set outside both states are kept. Empty if the
+ * states are equal.
+ */
+export function diffSGR(from: SGRState, to: SGRState): string {
+  const offs = new Set<string>();
+  for (const attr of attributeOrder) {
+    if (from[attr] !== undefined && to[attr] === undefined) {
+      offs.add(SGROff[attr]);
+    }
+  }
+
+  // an off code may reset more than the attribute that was dropped, e.g. 22
+  const reset = new Set([...offs].flatMap((code) => offCodes[code] ?? []));
+  const sets: string[] = [];
+  for (const attr of attributeOrder) {
+    const value = to[attr];
+    if (value !== undefined && (value !== from[attr] || reset.has(attr))) {
+      sets.push(value);
+    }
+  }
+  return [...offs, ...sets].join(';');
+}
+
+/**
+ * ReapplySGR re-applies the attributes of outer after every SGR sequence in s
+ * that resets them, whether by a full reset or by their own off codes. Nothing is
+ * added after a sequence that ends s.
+ */
+export function reapplySGR(s: string, outer: string): string {
+  if (!s.includes(CSI)) {
+    return s;
+  }
+
+  const outerState = applySGR({}, outer);
+  let state = outerState;
+  const tokens = tokenize(s);
+  return tokens
+    .map((t, i) => {
+      // private CSI m sequences, like CSI > 4 m, aren't SGR
+      if (t.kind !== 'csi' || t.final !== 'm' || /^[<=>?]/.test(t.params)) {
+        return t.value;
+      }
+
+      state = applySGR(state, t.params);
+      if (i === tokens.length - 1) {
+        return t.value;
+      }
+
+      const missing = attributeOrder.filter(
+        (attr) => outerState[attr] !== undefined && state[attr] === undefined
+      );
+      if (missing.length === 0) {
+        return t.value;
+      }
+      const restore = missing.map((attr) => outerState[attr]).join(';');
+      state = applySGR(state, restore);
+      return `${CSI}${t.params};${restore}m`;
+    })
+    .join('');
+}
@@ -0,0 +1,240 @@
+/**
+ * Terminal status report support.
+ * Port of the termStatusReport/readNextResponse helpers from
+ * github.com/muesli/termenv termenv_unix.go to TypeScript.
+ */
+
+import { BEL, ESC, ST, StatusReportError } from './types.js';
+
+/**
+ * OSCTimeout is the default time to wait for a terminal status report, in milliseconds.
+ * Matches Go OSCTimeout.
+ */
+export const OSCTimeout = 5000;
+
+// Responses longer than this are considered garbage
+const maxResponseLength = 128;
+
+// Response kinds by the byte following ESC
+const responseKinds: { [key: number]: StatusReportKind } = {
+  0x5b: 'csi', // [
+  0x5d: 'osc', // ]
+  0x50: 'dcs', // P
+};
+
+/**
+ * InputStream is the readable side of a terminal, typically process.stdin
+ */
+export type InputStream = NodeJS.ReadStream | NodeJS.ReadableStream;
+
+/**
+ * Kind of a terminal response: Control Sequence, Operating System Command or
+ * Device Control String
+ */
+export type StatusReportKind = 'csi' | 'osc' | 'dcs';
+
+/**
+ * StatusReport is a single response read from the terminal
+ */
+export interface StatusReport {
+  kind: StatusReportKind;
+  response: string;
+}
+
+/**
+ * StatusReportOptions configures a StatusReportReader
+ */
+export interface StatusReportOptions {
+  /** Time to wait for each byte of a response, in milliseconds */
+  timeout?: number;
+  /** Put the input into raw mode while reading (disabled for unsafe outputs, like Go) */
+  raw?: boolean;
+}
+
+/**
+ * StatusReportReader reads terminal responses byte by byte from an input stream.
+ * The input is switched to raw mode on open() and restored on close().
+ */
+export class StatusReportReader {
+  private buffer: number[] = [];
+  private keystrokes: number[] = [];
+  private waiter: (() => void) | null = null;
+  private ended = false;
+  private opened = false;
+  private wasRaw = false;
+  private wasFlowing = false;
+  private readonly timeout: number;
+  private readonly raw: boolean;
+
+  private readonly onData = (chunk: Buffer | string): void => {
+    const bytes = typeof chunk === 'string' ? Buffer.from(chunk) : chunk;
+    for (const b of bytes) {
+      this.buffer.push(b);
+    }
+    this.waiter?.();
+  };
+
+  private readonly onEnd = (): void => {
+    this.ended = true;
+    this.waiter?.();
+  };
+
+  constructor(
+    private input: InputStream,
+    options: StatusReportOptions = {}
+  ) {
+    this.timeout = options.timeout ?? OSCTimeout;
+    this.raw = options.raw ?? true;
+  }
+
+  /**
+   * Open switches the input to raw mode and starts collecting bytes
+   */
+  open(): void {
+    if (this.opened) {
+      return;
+    }
+    this.opened = true;
+
+    const tty = this.input as NodeJS.ReadStream;
+    if (this.raw && tty.isTTY && typeof tty.setRawMode === 'function') {
+      this.wasRaw = tty.isRaw;
+      tty.setRawMode(true);
+    }
+
+    this.wasFlowing = (this.input as NodeJS.ReadStream).readableFlowing === true;
+    this.input.on('data', this.onData);
+    this.input.on('end', this.onEnd);
+    this.input.resume();
+  }
+
+  /**
+   * Close stops collecting bytes and restores the previous input mode. User input
+   * read in the meantime is pushed back onto the input for the application to read.
+   */
+  close(): void {
+    if (!this.opened) {
+      return;
+    }
+    this.opened = false;
+
+    this.input.removeListener('data', this.onData);
+    this.input.removeListener('end', this.onEnd);
+
+    const leftover = [...this.keystrokes, ...this.buffer];
+    this.keystrokes = [];
+    this.buffer = [];
+    if (leftover.length > 0 && !this.ended && this.input.listenerCount('data') === 0) {
+      this.input.unshift(Buffer.from(leftover));
+    }
+    if (!this.wasFlowing) {
+      this.input.pause();
+    }
+
+    const tty = this.input as NodeJS.ReadStream;
+    if (this.raw && tty.isTTY && typeof tty.setRawMode === 'function') {
+      tty.setRawMode(this.wasRaw);
+    }
+  }
+
+  /**
+   * ReadByte returns the next byte from the input, failing with a StatusReportError
+   * if none arrives within the timeout.
+   */
+  readByte(): Promise<number> {
+    const b = this.buffer.shift();
+    if (b !== undefined) {
+      return Promise.resolve(b);
+    }
+    if (this.ended) {
+      return Promise.reject(new StatusReportError('input closed before status report'));
+    }
+
+    return new Promise((resolve, reject) => {
+      const timer = setTimeout(() => {
+        this.waiter = null;
+        reject(new StatusReportError('timed out waiting for status report'));
+      }, this.timeout);
+
+      this.waiter = () => {
+        clearTimeout(timer);
+        this.waiter = null;
+        this.readByte().then(resolve, reject);
+      };
+    });
+  }
+
+  /**
+   * ReadResponse reads the next CSI, OSC or DCS response from the input.
+   * Bytes that don't belong to a response are kept as user input, see unread().
+   * Port of Go readNextResponse.
+   */
+  async readResponse(): Promise<StatusReport> {
+    for (;;) {
+      // first byte must be ESC, anything else was typed by the user
+      const start = await this.readByte();
+      if (start !== 0x1b) {
+        this.keystrokes.push(start);
+        continue;
+      }
+
+      // next byte is '[' (CSI), ']' (OSC) or 'P' (DCS)
+      const tpe = await this.readByte();
+      const kind = responseKinds[tpe];
+      if (!kind) {
+        this.keystrokes.push(start, tpe);
+        continue;
+      }
+
+      return this.readResponseBody(kind, tpe);
+    }
+  }
+
+  /**
+   * Unread hands a response back as user input, e.g. a key sequence that was
+   * read while waiting for a status report. It is returned to the input on close().
+   */
+  unread(report: StatusReport): void {
+    for (let i = 0; i < report.response.length; i++) {
+      this.keystrokes.push(report.response.charCodeAt(i));
+    }
+  }
+
+  private async readResponseBody(kind: StatusReportKind, tpe: number): Promise<StatusReport> {
+    let response = ESC + String.fromCharCode(tpe);
+    while (response.length <= maxResponseLength) {
+      const b = await this.readByte();
+      response += String.fromCharCode(b);
+
+      if (kind === 'csi') {
+        // CSI responses end with a final byte in the range @ to ~
+        if (b >= 0x40 && b <= 0x7e) {
+          return { kind, response };
+        }
+      } else if ((kind === 'osc' && response.endsWith(BEL)) || response.endsWith(ST)) {
+        // OSC can be terminated by BEL or ST, DCS by ST only
+        return { kind, response };
+      }
+    }
+
+    throw new StatusReportError('status report response too long');
+  }
+}
+
+/**
+ * WithStatusReportReader opens a reader on input, runs fn and always closes the
+ * reader again, restoring the input mode even if fn fails.
+ */
+export async function withStatusReportReader<T>(
+  input: InputStream,
+  options: StatusReportOptions,
+  fn: (reader: StatusReportReader) => Promise<T>
+): Promise<T> {
+  const reader = new StatusReportReader(input, options);
+  reader.open();
+  try {
+    return await fn(reader);
+  } finally {
+    reader.close();
+  }
+}
@@ -0,0 +1,361 @@
+/**
+ * Reusable, text-less style definitions.
+ * A StyleSpec describes a look once and renders any number of strings with it.
+ */
+
+import { defaultOutputInstance } from './output.js';
+import { ProfileUtils } from './profile.js';
+import { type LinkOptions, Style, type StyleLink, type UnderlineStyle } from './style.js';
+import { ANSI256Color, ANSIColor, type Color, NoColor, type Profile, RGBColor } from './types.js';
+
+/**
+ * StyleAttributes are the attributes of a StyleSpec. Undefined attributes are
+ * unset and may be inherited; false and null explicitly turn an attribute off.
+ */
+export interface StyleAttributes {
+  foreground?: Color | null;
+  background?: Color | null;
+  bold?: boolean;
+  faint?: boolean;
+  italic?: boolean;
+  /** True for a single underline, or the kind of underline */
+  underline?: boolean | UnderlineStyle;
+  underlineColor?: Color | null;
+  overline?: boolean;
+  blink?: boolean;
+  reverse?: boolean;
+  crossOut?: boolean;
+  link?: StyleLink | null;
+}
+
+/**
+ * Names of the style attributes, in the order they are rendered
+ */
+export const StyleAttributeNames = [
+  'foreground',
+  'background',
+  'bold',
+  'faint',
+  'italic',
+  'underline',
+  'underlineColor',
+  'overline',
+  'blink',
+  'reverse',
+  'crossOut',
+  'link',
+] as const satisfies readonly (keyof StyleAttributes)[];
+
+export type StyleAttributeName = (typeof StyleAttributeNames)[number];
+
+// Specs by key, so structurally equal specs are the same object
+const specs = new Map<string, WeakRef<StyleSpec>>();
+const collected = new FinalizationRegistry<string>((key) => {
+  if (specs.get(key)?.deref() === undefined) {
+    specs.delete(key);
+  }
+});
+
+/**
+ * StyleSpec is an immutable style without text. Specs are interned: two specs
+ * with the same attributes are the same object, so they can be compared with ===
+ * and used as Map keys.
+ */
+export class StyleSpec {
+  private constructor(
+    private readonly _key: string,
+    private readonly attrs: Readonly<StyleAttributes>
+  ) {}
+
+  /**
+   * Create returns the spec with the given attributes
+   */
+  static create(attributes: StyleAttributes = {}): StyleSpec {
+    const attrs = normalize(attributes);
+    const key = specKey(attrs);
+    const cached = specs.get(key)?.deref();
+    if (cached) {
+      return cached;
+    }
+
+    const spec = new StyleSpec(key, Object.freeze(attrs));
+    specs.set(key, new WeakRef(spec));
+    collected.register(spec, key);
+    return spec;
+  }
+
+  /**
+   * Attributes returns the attributes that are set
+   */
+  attributes(): Readonly<StyleAttributes> {
+    return this.attrs;
+  }
+
+  /**
+   * Key returns a string that is equal for specs with the same attributes
+   */
+  key(): string {
+    return this._key;
+  }
+
+  /**
+   * Equals reports whether other has the same attributes
+   */
+  equals(other: StyleSpec): boolean {
+    return this._key === other._key;
+  }
+
+  /**
+   * With returns a spec with the given attributes overridden
+   */
+  with(attributes: StyleAttributes): StyleSpec {
+    return StyleSpec.create({ ...this.attrs, ...definedOnly(attributes) });
+  }
+
+  /**
+   * Merge returns a spec with the attributes set in other overriding this spec's
+   */
+  merge(other: StyleSpec): StyleSpec {
+    return this.with(other.attrs);
+  }
+
+  /**
+   * Inherit returns a spec that takes the attributes this spec leaves unset from
+   * parent
+   */
+  inherit(parent: StyleSpec): StyleSpec {
+    return parent.merge(this);
+  }
+
+  /**
+   * Unset returns a spec without the given attributes, so they can be inherited again
+   */
+  unset(...names: StyleAttributeName[]): StyleSpec {
+    const attrs: StyleAttributes = {};
+    for (const name of StyleAttributeNames) {
+      if (!names.includes(name)) {
+        Object.assign(attrs, { [name]: this.attrs[name] });
+      }
+    }
+    return StyleSpec.create(attrs);
+  }
+
+  /**
+   * Foreground sets the foreground color
+   */
+  foreground(c: Color | null): StyleSpec {
+    return this.with({ foreground: c });
+  }
+
+  /**
+   * Background sets the background color
+   */
+  background(c: Color | null): StyleSpec {
+    return this.with({ background: c });
+  }
+
+  /**
+   * Bold enables or disables bold rendering
+   */
+  bold(on = true): StyleSpec {
+    return this.with({ bold: on });
+  }
+
+  /**
+   * Faint enables or disables faint rendering
+   */
+  faint(on = true): StyleSpec {
+    return this.with({ faint: on });
+  }
+
+  /**
+   * Italic enables or disables italic rendering
+   */
+  italic(on = true): StyleSpec {
+    return this.with({ italic: on });
+  }
+
+  /**
+   * Underline enables or disables underlining, optionally of a given kind
+   */
+  underline(on: boolean | UnderlineStyle = true): StyleSpec {
+    return this.with({ underline: on });
+  }
+
+  /**
+   * UnderlineColor sets the underline color
+   */
+  underlineColor(c: Color | null): StyleSpec {
+    return this.with({ underlineColor: c });
+  }
+
+  /**
+   * Overline enables or disables overline rendering
+   */
+  overline(on = true): StyleSpec {
+    return this.with({ overline: on });
+  }
+
+  /**
+   * Blink enables or disables blink mode
+   */
+  blink(on = true): StyleSpec {
+    return this.with({ blink: on });
+  }
+
+  /**
+   * Reverse enables or disables reverse color mode
+   */
+  reverse(on = true): StyleSpec {
+    return this.with({ reverse: on });
+  }
+
+  /**
+   * CrossOut enables or disables crossed-out rendering
+   */
+  crossOut(on = true): StyleSpec {
+    return this.with({ crossOut: on });
+  }
+
+  /**
+   * Link makes rendered strings hyperlinks; an empty url removes the link
+   */
+  link(url: string, options: LinkOptions = {}): StyleSpec {
+    return this.with({ link: url ? { ...options, url } : null });
+  }
+
+  /**
+   * Apply returns style with this spec's attributes added. Colors are converted
+   * to the style's profile, and the style's hyperlink and underline support is kept.
+   */
+  apply(style: Style): Style {
+    const a = this.attrs;
+    const color = (c: Color | null | undefined): Color | null => {
+      if (!c) {
+        return null;
+      }
+      const converted = ProfileUtils.convert(style.profile, c, style.colorMetric, style.palette);
+      return converted instanceof NoColor ? null : converted;
+    };
+
+    let styled = style.foreground(color(a.foreground)).background(color(a.background));
+    const flags: [boolean | undefined, (s: Style) => Style][] = [
+      [a.bold, (s) => s.bold()],
+      [a.faint, (s) => s.faint()],
+      [a.italic, (s) => s.italic()],
+      [a.underline === true, (s) => s.underline()],
+      [typeof a.underline === 'string', (s) => s.underlineStyle(a.underline as UnderlineStyle)],
+      [a.underlineColor != null, (s) => s.underlineColor(color(a.underlineColor))],
+      [a.overline, (s) => s.overline()],
+      [a.blink, (s) => s.blink()],
+      [a.reverse, (s) => s.reverse()],
+      [a.crossOut, (s) => s.crossOut()],
+    ];
+    for (const [set, add] of flags) {
+      if (set) {
+        styled = add(styled);
+      }
+    }
+
+    if (a.link) {
+      styled = styled.link(a.link.url, a.link);
+    }
+    return styled;
+  }
+
+  /**
+   * Style returns a Style for text with this spec's attributes, for the given
+   * profile or else for the default output, with its color profile, hyperlink
+   * and underline support
+   */
+  style(text: string, profile?: Profile): Style {
+    const style =
+      profile === undefined ? defaultOutputInstance().string(text) : new Style(profile, text);
+    return this.apply(style);
+  }
+
+  /**
+   * Render returns text styled for the given profile or the default output
+   */
+  render(text: string, profile?: Profile): string {
+    return this.style(text, profile).toString();
+  }
+
+  /**
+   * Wrap renders content that may contain styled strings, re-applying this spec
+   * after each of their resets. See Style.wrap.
+   */
+  wrap(content: string, profile?: Profile): string {
+    return this.style('', profile).wrap(content);
+  }
+}
+
+/**
+ * NewStyleSpec returns the spec with the given attributes
+ */
+export function newStyleSpec(attributes: StyleAttributes = {}): StyleSpec {
+  return StyleSpec.create(attributes);
+}
+
+function definedOnly(attributes: StyleAttributes): StyleAttributes {
+  const attrs: StyleAttributes = {};
+  for (const name of StyleAttributeNames) {
+    if (attributes[name] !== undefined) {
+      Object.assign(attrs, { [name]: attributes[name] });
+    }
+  }
+  return attrs;
+}
+
+// Normalize equivalent values, so they produce the same key
+function normalize(attributes: StyleAttributes): StyleAttributes {
+  const attrs = definedOnly(attributes);
+  if (attrs.underline === 'single') {
+    attrs.underline = true;
+  } else if (attrs.underline === 'none') {
+    attrs.underline = false;
+  }
+  if (attrs.link) {
+    attrs.link = { ...attrs.link };
+  }
+  return attrs;
+}
+
+function specKey(attrs: StyleAttributes): string {
+  const parts: string[] = [];
+  for (const name of StyleAttributeNames) {
+    const value = attrs[name];
+    if (value === undefined) {
+      continue;
+    }
+
+    let encoded: string;
+    if (value === null || typeof value === 'boolean' || typeof value === 'string') {
+      encoded = String(value);
+    } else if (name === 'link') {
+      const link = value as StyleLink;
+      const params = Object.entries(link.params ?? {}).sort(([a], [b]) => (a < b ? -1 : 1));
+      encoded = JSON.stringify([link.url, link.id ?? '', params]);
+    } else {
+      encoded = colorKey(value as Color);
+    }
+    parts.push(`${name}=${encoded}`);
+  }
+  return parts.join(';');
+}
+
+function colorKey(c: Color): string {
+  if (c instanceof ANSIColor) {
+    return `ansi(${c.value})`;
+  }
+  if (c instanceof ANSI256Color) {
+    return `ansi256(${c.value})`;
+  }
+  if (c instanceof RGBColor) {
+    return `rgb(${c.hex.toLowerCase()})`;
+  }
+  if (c instanceof NoColor) {
+    return 'none';
+  }
+  return `${c.constructor.name}(${c.toString()})`;
+}
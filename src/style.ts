@@ -3,8 +3,14 @@
  * Port of github.com/muesli/termenv style.go to TypeScript.
  */
 
+import type { ColorMetric } from './color-convert.js';
+import { validateColor } from './color-parser.js';
+import { displayWidth, padEnd } from './layout.js';
+import { DefaultPalette, type Palette } from './palette.js';
+import { ProfileUtils } from './profile.js';
+import { applySGR, closeSGR, diffSGR, reapplySGR, type SGRState } from './sgr.js';
 import { stringWidth } from './string-width.js';
-import { type Color, CSI, Profile } from './types.js';
+import { ANSIColor, type Color, CSI, NoColor, OSC, Profile, ST } from './types.js';
 
 // Sequence definitions - matches Go constants
 export const ResetSeq = '0';
@@ -16,6 +22,65 @@ export const BlinkSeq = '5';
 export const ReverseSeq = '7';
 export const CrossOutSeq = '9';
 export const OverlineSeq = '53';
+export const UnderlineColorSeq = '58';
+
+/**
+ * UnderlineStyle is the shape of an underline, see Style.underlineStyle
+ */
+export type UnderlineStyle = 'none' | 'single' | 'double' | 'curly' | 'dotted' | 'dashed';
+
+// SGR 4 sub-parameters of the underline styles
+const underlineStyles: { [K in UnderlineStyle]: number } = {
+  none: 0,
+  single: 1,
+  double: 2,
+  curly: 3,
+  dotted: 4,
+  dashed: 5,
+};
+
+/**
+ * ResetStrategy is how a style ends: 'full' resets all attributes (SGR 0) like the
+ * Go package, 'minimal' resets only the attributes the style set, e.g. 22 for
+ * bold and 39 for a foreground color
+ */
+export type ResetStrategy = 'full' | 'minimal';
+
+/**
+ * LineMode is how a style covers text with newlines: 'block' opens it once for
+ * the whole text like the Go package, 'lines' opens and closes it on every line,
+ * so each line renders on its own in pagers and log viewers
+ */
+export type LineMode = 'block' | 'lines';
+
+/**
+ * LinkOptions are the optional OSC 8 parameters of a hyperlink
+ */
+export interface LinkOptions {
+  /** Links with the same id are highlighted together, e.g. across wrapped lines */
+  id?: string;
+  /** Additional key=value parameters */
+  params?: Record<string, string>;
+}
+
+/**
+ * StyleLink is the hyperlink carried by a Style
+ */
+export interface StyleLink extends LinkOptions {
+  url: string;
+}
+
+/**
+ * LinkFallback renders a link where hyperlinks aren't supported
+ */
+export type LinkFallback = (text: string, url: string) => string;
+
+/**
+ * DefaultLinkFallback renders links as "text (url)", or just the url when the
+ * text is the url itself
+ */
+export const DefaultLinkFallback: LinkFallback = (text, url) =>
+  text === url ? text : `${text} (${url})`;
 
 /**
  * Style is a string that various rendering styles can be applied to.
@@ -25,11 +90,41 @@ export class Style {
   public profile: Profile;
   public string: string;
   public styles: string[];
+  /** Whether the terminal understands underline styles and colors (SGR 4:n and 58) */
+  public extendedUnderline: boolean;
+  /** Hyperlink set with link() */
+  public hyperlink: StyleLink | null;
+  /** Whether hyperlinks are rendered as OSC 8; the Ascii profile never does */
+  public linksSupported: boolean;
+  /** Renders the hyperlink when it isn't rendered as OSC 8 */
+  public linkFallback: LinkFallback;
+  /** How the style ends */
+  public resetStrategy: ResetStrategy;
+  /** How the style covers text with newlines */
+  public lineMode: LineMode;
+  /** Width lines are padded to in 'lines' mode, 'widest' for the widest line */
+  public padWidth: number | 'widest' | null;
+  /** Whether colors are validated when set, throwing an InvalidColorError */
+  public strictColors: boolean;
+  /** How colors are downsampled for the profile */
+  public colorMetric: ColorMetric;
+  /** Colors of the terminal that colors are downsampled to */
+  public palette: Palette;
 
   constructor(profile: Profile, text?: string) {
     this.profile = profile;
     this.string = text || '';
     this.styles = [];
+    this.extendedUnderline = false;
+    this.hyperlink = null;
+    this.linksSupported = true;
+    this.linkFallback = DefaultLinkFallback;
+    this.resetStrategy = 'full';
+    this.lineMode = 'block';
+    this.padWidth = null;
+    this.strictColors = false;
+    this.colorMetric = 'hsluv';
+    this.palette = DefaultPalette;
   }
 
   /**
@@ -50,6 +145,62 @@ export class Style {
    * Styled renders s with all applied styles - matches Go Styled method
    */
   styled(s: string): string {
+    return this.render(s, false);
+  }
+
+  /**
+   * Wrap renders content that may itself contain styled strings. Unlike styled,
+   * the style is re-applied after every reset in content, so nested styles don't
+   * end the outer one.
+   */
+  wrap(content: string): string {
+    return this.render(content, true);
+  }
+
+  // Render s as one span, or in 'lines' mode as one span per line
+  private render(s: string, nested: boolean): string {
+    const sgr = (text: string) => this.sgr(text, nested);
+    if (this.lineMode !== 'lines') {
+      return this.linked(s, sgr);
+    }
+
+    // a fallback is rendered once for the whole text, a hyperlink on every line
+    const link = this.hyperlink;
+    const osc8 = link !== null && this.profile !== Profile.Ascii && this.linksSupported;
+    const lines = (link && !osc8 ? this.linkFallback(s, link.url) : s).split('\n');
+    const width =
+      this.padWidth === 'widest'
+        ? Math.max(...lines.map((line) => displayWidth(line.replace(/\r$/, ''))))
+        : (this.padWidth ?? 0);
+
+    return lines
+      .map((line) => {
+        const cr = line.endsWith('\r') ? '\r' : '';
+        const body = padEnd(line.slice(0, line.length - cr.length), width);
+        if (body === '') {
+          return cr;
+        }
+        return (osc8 ? this.linked(body, sgr) : sgr(body)) + cr;
+      })
+      .join('\n');
+  }
+
+  // Wrap the rendered text in the hyperlink, or its fallback
+  private linked(s: string, render: (text: string) => string): string {
+    const link = this.hyperlink;
+    if (!link) {
+      return render(s);
+    }
+
+    if (this.profile === Profile.Ascii || !this.linksSupported) {
+      return render(this.linkFallback(s, link.url));
+    }
+
+    // the link encloses the SGR sequences, so it ends after the reset
+    return `${OSC}8;${linkParams(link)};${link.url}${ST}${render(s)}${OSC}8;;${ST}`;
+  }
+
+  private sgr(s: string, nested: boolean): string {
     if (this.profile === Profile.Ascii) {
       return s;
     }
@@ -62,7 +213,54 @@ export class Style {
       return s;
     }
 
-    return `${CSI}${seq}m${s}${CSI}${ResetSeq}m`;
+    const body = nested ? reapplySGR(s, seq) : s;
+    return `${CSI}${seq}m${body}${CSI}${this.closing(seq)}m`;
+  }
+
+  // Parameters that end the style: a full reset, or the off codes of its attributes
+  private closing(seq: string): string {
+    if (this.resetStrategy !== 'minimal') {
+      return ResetSeq;
+    }
+    return closeSGR(applySGR({}, seq)) || ResetSeq;
+  }
+
+  /**
+   * PerLine opens and closes the style on every line of text with newlines, so
+   * pagers like less -R keep it on continuation lines and backgrounds don't bleed
+   * past the end of a line. perLine(false) restores the single span.
+   */
+  perLine(enabled = true): Style {
+    const newStyle = this.copy();
+    newStyle.lineMode = enabled ? 'lines' : 'block';
+    return newStyle;
+  }
+
+  /**
+   * PadLines styles every line on its own like perLine and pads the lines with
+   * spaces to width, by default the width of the widest line, so backgrounds render
+   * as rectangles
+   */
+  padLines(width?: number): Style {
+    const newStyle = this.perLine();
+    newStyle.padWidth = width ?? 'widest';
+    return newStyle;
+  }
+
+  /**
+   * Link makes the styled string a hyperlink (OSC 8). Where hyperlinks aren't
+   * supported, including the Ascii profile, it is rendered by linkFallback, by
+   * default as "text (url)". An empty url removes the link.
+   */
+  link(url: string, options: LinkOptions = {}): Style {
+    const newStyle = this.copy();
+    if (!url) {
+      newStyle.hyperlink = null;
+      return newStyle;
+    }
+
+    newStyle.hyperlink = { ...options, url: sanitizeURL(url) };
+    return newStyle;
   }
 
   /**
@@ -71,6 +269,7 @@ export class Style {
   foreground(c: Color | null): Style {
     const newStyle = this.copy();
     if (c) {
+      this.checkColor(c);
       const sequence = c.sequence(false);
       // Always push sequence, even if empty, to match Go behavior with invalid colors
       newStyle.styles.push(sequence);
@@ -84,6 +283,7 @@ export class Style {
   background(c: Color | null): Style {
     const newStyle = this.copy();
     if (c) {
+      this.checkColor(c);
       const sequence = c.sequence(true);
       // Always push sequence, even if empty, to match Go behavior with invalid colors
       newStyle.styles.push(sequence);
@@ -127,6 +327,51 @@ export class Style {
     return newStyle;
   }
 
+  /**
+   * UnderlineStyle enables an underline of the given kind, e.g. curly for spelling
+   * errors. Falls back to a plain underline unless extendedUnderline is set.
+   */
+  underlineStyle(kind: UnderlineStyle): Style {
+    const newStyle = this.copy();
+    if (this.extendedUnderline) {
+      newStyle.styles.push(`${UnderlineSeq}:${underlineStyles[kind]}`);
+    } else if (kind !== 'none') {
+      newStyle.styles.push(UnderlineSeq);
+    }
+    return newStyle;
+  }
+
+  /**
+   * UnderlineColor sets the underline color, converted for the style's profile.
+   * Dropped unless extendedUnderline is set: terminals that don't know SGR 58 would
+   * read its parameters as other attributes, like blink.
+   */
+  underlineColor(c: Color | null): Style {
+    const newStyle = this.copy();
+    if (c) {
+      this.checkColor(c);
+    }
+    if (!c || !this.extendedUnderline) {
+      return newStyle;
+    }
+
+    const converted = ProfileUtils.convert(this.profile, c, this.colorMetric, this.palette);
+    if (converted instanceof NoColor) {
+      return newStyle;
+    }
+    if (converted instanceof ANSIColor) {
+      // there is no short form for the 16 basic colors, use their palette index
+      newStyle.styles.push(`${UnderlineColorSeq};5;${converted.value}`);
+      return newStyle;
+    }
+
+    const sequence = converted.sequence(false);
+    if (sequence !== '') {
+      newStyle.styles.push(UnderlineColorSeq + sequence.slice(2));
+    }
+    return newStyle;
+  }
+
   /**
    * Overline enables overline rendering - matches Go Overline method
    */
@@ -171,12 +416,30 @@ export class Style {
     return stringWidth(this.string);
   }
 
+  // Throws an InvalidColorError for invalid colors in strict mode; otherwise they
+  // render nothing, like in Go
+  private checkColor(c: Color): void {
+    if (this.strictColors) {
+      validateColor(c);
+    }
+  }
+
   /**
    * Create a copy of this style
    */
   private copy(): Style {
     const newStyle = new Style(this.profile, this.string);
     newStyle.styles = [...this.styles];
+    newStyle.extendedUnderline = this.extendedUnderline;
+    newStyle.hyperlink = this.hyperlink;
+    newStyle.linksSupported = this.linksSupported;
+    newStyle.linkFallback = this.linkFallback;
+    newStyle.resetStrategy = this.resetStrategy;
+    newStyle.lineMode = this.lineMode;
+    newStyle.padWidth = this.padWidth;
+    newStyle.strictColors = this.strictColors;
+    newStyle.colorMetric = this.colorMetric;
+    newStyle.palette = this.palette;
     return newStyle;
   }
 
@@ -260,6 +523,76 @@ export class Style {
   }
 }
 
+/**
+ * RenderSpans renders styled strings one after another with the fewest SGR
+ * sequences: each span changes only the attributes that differ from the previous
+ * one, and the end closes only what is still set.
+ */
+export function renderSpans(...spans: Style[]): string {
+  let out = '';
+  let state: SGRState = {};
+  let link: StyleLink | null = null;
+
+  for (const span of spans) {
+    const linked = span.hyperlink !== null && span.profile !== Profile.Ascii && span.linksSupported;
+    const next = linked ? span.hyperlink : null;
+    if (!sameLink(link, next)) {
+      out += link ? `${OSC}8;;${ST}` : '';
+      out += next ? `${OSC}8;${linkParams(next)};${next.url}${ST}` : '';
+      link = next;
+    }
+
+    const target =
+      span.profile === Profile.Ascii ? {} : applySGR({}, span.styles.filter(Boolean).join(';'));
+    const delta = diffSGR(state, target);
+    if (delta !== '') {
+      out += `${CSI}${delta}m`;
+    }
+    state = target;
+
+    const hyperlink = span.hyperlink;
+    out += hyperlink && !linked ? span.linkFallback(span.string, hyperlink.url) : span.string;
+  }
+
+  const close = closeSGR(state);
+  if (close !== '') {
+    out += `${CSI}${close}m`;
+  }
+  if (link) {
+    out += `${OSC}8;;${ST}`;
+  }
+  return out;
+}
+
+function sameLink(a: StyleLink | null, b: StyleLink | null): boolean {
+  if (a === null || b === null) {
+    return a === b;
+  }
+  return a.url === b.url && linkParams(a) === linkParams(b);
+}
+
+// OSC 8 only allows printable ASCII in URLs, percent-encode everything else
+function sanitizeURL(url: string): string {
+  return url.replace(/[^!-~]/gu, (c) =>
+    Array.from(Buffer.from(c), (b) => `%${b.toString(16).toUpperCase().padStart(2, '0')}`).join('')
+  );
+}
+
+// Render the id and params of a link as key=value pairs separated by colons
+function linkParams(link: StyleLink): string {
+  const params: [string, string][] = [];
+  if (link.id) {
+    params.push(['id', link.id]);
+  }
+  for (const [key, value] of Object.entries(link.params ?? {})) {
+    params.push([key, value]);
+  }
+
+  // colons, semicolons and equal signs would break the parameter list
+  const clean = (v: string) => v.replace(/[^!-~]|[:;=]/gu, '');
+  return params.map(([k, v]) => `${clean(k)}=${clean(v)}`).join(':');
+}
+
 /**
  * NewString returns a new Style - matches Go String function
  */
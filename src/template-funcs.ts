@@ -0,0 +1,92 @@
+/**
+ * Template functions for styling text.
+ * Port of github.com/muesli/termenv templatehelper.go to TypeScript.
+ */
+
+import { ProfileUtils } from './profile.js';
+import { Style } from './style.js';
+import type { FuncMap } from './template.js';
+import { Profile } from './types.js';
+
+// Template values are untyped; like Go's type assertions, non-strings are errors
+function text(value: unknown): string {
+  if (typeof value !== 'string') {
+    const kind = value === null || value === undefined ? 'nil' : typeof value;
+    throw new Error(`interface conversion: interface {} is ${kind}, not string`);
+  }
+  return value;
+}
+
+function last(values: unknown[]): unknown {
+  return values[values.length - 1];
+}
+
+/**
+ * TemplateFuncs returns template functions for styling text with the profile:
+ * Color, Foreground and Background take colors before the text, e.g.
+ * {{ Color "#ff0000" "" "text" }}; Bold, Faint, Italic, Underline, Overline,
+ * Blink, Reverse and CrossOut take the text. For the Ascii profile the functions
+ * return the text unchanged.
+ */
+export function templateFuncs(profile: Profile): FuncMap {
+  if (profile === Profile.Ascii) {
+    return noopTemplateFuncs;
+  }
+
+  const color = (value: unknown) => ProfileUtils.color(profile, text(value));
+  const styleFunc =
+    (f: (s: Style) => Style) =>
+    (...values: unknown[]) =>
+      f(new Style(profile, text(values[0]))).toString();
+
+  return {
+    Color: (...values) => {
+      let s = new Style(profile, text(last(values)));
+      if (values.length === 2) {
+        s = s.foreground(color(values[0]));
+      } else if (values.length === 3) {
+        s = s.foreground(color(values[0])).background(color(values[1]));
+      }
+      return s.toString();
+    },
+    Foreground: (...values) => {
+      let s = new Style(profile, text(last(values)));
+      if (values.length === 2) {
+        s = s.foreground(color(values[0]));
+      }
+      return s.toString();
+    },
+    Background: (...values) => {
+      let s = new Style(profile, text(last(values)));
+      if (values.length === 2) {
+        s = s.background(color(values[0]));
+      }
+      return s.toString();
+    },
+    Bold: styleFunc((s) => s.bold()),
+    Faint: styleFunc((s) => s.faint()),
+    Italic: styleFunc((s) => s.italic()),
+    Underline: styleFunc((s) => s.underline()),
+    Overline: styleFunc((s) => s.overline()),
+    Blink: styleFunc((s) => s.blink()),
+    Reverse: styleFunc((s) => s.reverse()),
+    CrossOut: styleFunc((s) => s.crossOut()),
+  };
+}
+
+const noColorFunc = (...values: unknown[]) => text(last(values));
+const noStyleFunc = (...values: unknown[]) => text(values[0]);
+
+const noopTemplateFuncs: FuncMap = {
+  Color: noColorFunc,
+  Foreground: noColorFunc,
+  Background: noColorFunc,
+  Bold: noStyleFunc,
+  Faint: noStyleFunc,
+  Italic: noStyleFunc,
+  Underline: noStyleFunc,
+  Overline: noStyleFunc,
+  Blink: noStyleFunc,
+  Reverse: noStyleFunc,
+  CrossOut: noStyleFunc,
+};
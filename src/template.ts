@@ -0,0 +1,1019 @@
+/**
+ * A subset of Go's text/template.
+ * Supports actions with pipelines, variables, parenthesized arguments, field
+ * chains, comments, whitespace trimming, if/else if/else, range (with else), with,
+ * and the predefined functions and, or, not, len, index, print, printf, println,
+ * eq, ne, lt, le, gt, ge, html and urlquery. define, template and block are not
+ * supported.
+ */
+
+import { TermEnvError } from './types.js';
+
+/**
+ * FuncMap maps names to functions callable from templates, like Go template.FuncMap
+ */
+export type FuncMap = { [name: string]: (...args: unknown[]) => unknown };
+
+/**
+ * TemplateError is a parse or execution error, formatted like Go's
+ * "template: name:line: message"
+ */
+export class TemplateError extends TermEnvError {
+  constructor(message: string) {
+    super(message);
+    this.name = 'TemplateError';
+  }
+}
+
+type TokenType =
+  | 'string'
+  | 'number'
+  | 'bool'
+  | 'nil'
+  | 'dot'
+  | 'field'
+  | 'variable'
+  | 'ident'
+  | 'lparen'
+  | 'rparen'
+  | 'pipe'
+  | 'declare'
+  | 'assign'
+  | 'comma';
+
+interface Token {
+  type: TokenType;
+  value: string;
+  /** Whether whitespace precedes the token; field chains must be adjacent */
+  spaced: boolean;
+}
+
+type Item = { kind: 'text'; text: string } | { kind: 'action'; tokens: Token[]; line: number };
+
+type Operand =
+  | { kind: 'literal'; value: unknown }
+  | { kind: 'dot' }
+  | { kind: 'var'; name: string }
+  | { kind: 'ident'; name: string }
+  | { kind: 'pipe'; pipe: Pipe }
+  | { kind: 'chain'; receiver: Operand; fields: string[] };
+
+interface Pipe {
+  decls: string[];
+  assign: boolean;
+  cmds: Operand[][];
+  line: number;
+}
+
+type Node =
+  | { kind: 'text'; text: string }
+  | { kind: 'action'; pipe: Pipe }
+  | { kind: 'if' | 'range' | 'with'; pipe: Pipe; list: Node[]; elseList: Node[] | null };
+
+// Go's fmt prints missing values and nil like this
+const NoValue = '<no value>';
+
+/**
+ * Template is a parsed template, like Go's *template.Template
+ */
+export class Template {
+  private readonly fns: FuncMap = {};
+  private tree: Node[] | null = null;
+
+  constructor(public readonly name: string) {}
+
+  /**
+   * Funcs adds functions to the template. Like in Go, functions must be added
+   * before parsing.
+   */
+  funcs(funcMap: FuncMap): this {
+    Object.assign(this.fns, funcMap);
+    return this;
+  }
+
+  /**
+   * Parse parses text as the template body
+   */
+  parse(text: string): this {
+    const parser = new Parser(this.name, lex(this.name, text), (name) => this.hasFunc(name));
+    this.tree = parser.parseTemplate();
+    return this;
+  }
+
+  /**
+   * Execute applies the template to data and returns the output
+   */
+  execute(data?: unknown): string {
+    if (!this.tree) {
+      throw new TemplateError(`template: ${this.name}: "${this.name}" is an incomplete template`);
+    }
+    const state = new State(this.name, { ...builtins, ...this.fns }, data);
+    return state.walk(this.tree, data);
+  }
+
+  private hasFunc(name: string): boolean {
+    return Object.hasOwn(this.fns, name) || Object.hasOwn(builtins, name);
+  }
+}
+
+/**
+ * NewTemplate allocates a new template with the given name, like Go template.New
+ */
+export function newTemplate(name: string): Template {
+  return new Template(name);
+}
+
+// Lexing
+
+function lex(name: string, text: string): Item[] {
+  const items: Item[] = [];
+  let pos = 0;
+  let trimNext = false;
+
+  const lineAt = (i: number) => text.slice(0, i).split('\n').length;
+  const fail: (i: number, msg: string) => never = (i, msg) => {
+    throw new TemplateError(`template: ${name}:${lineAt(i)}: ${msg}`);
+  };
+
+  while (pos <= text.length) {
+    const open = text.indexOf('{{', pos);
+    let chunk = text.slice(pos, open < 0 ? text.length : open);
+    if (trimNext) {
+      chunk = chunk.replace(/^\s+/, '');
+    }
+
+    if (open < 0) {
+      if (chunk !== '') {
+        items.push({ kind: 'text', text: chunk });
+      }
+      break;
+    }
+
+    let start = open + 2;
+    if (/^-\s/.test(text.slice(start, start + 2))) {
+      chunk = chunk.replace(/\s+$/, '');
+      start += 2;
+    }
+    if (chunk !== '') {
+      items.push({ kind: 'text', text: chunk });
+    }
+
+    if (text.startsWith('/*', start)) {
+      const close = text.indexOf('*/', start + 2);
+      const after = close < 0 ? '' : text.slice(close + 2);
+      const trim = /^\s-\}\}/.test(after);
+      if (close < 0 || !(trim || after.startsWith('}}'))) {
+        fail(open, 'unclosed comment');
+      }
+      trimNext = trim;
+      pos = close + (trim ? 6 : 4);
+      continue;
+    }
+
+    const [tokens, end, trim] = lexAction(text, start, (i, msg) => fail(i, msg));
+    items.push({ kind: 'action', tokens, line: lineAt(open) });
+    trimNext = trim;
+    pos = end;
+  }
+  return items;
+}
+
+// Token patterns of actions, tried in order after quoted strings
+const tokenPatterns: [RegExp, TokenType][] = [
+  [/^[+-]?(?:0[xX][0-9a-fA-F_]+|\d[\d_]*(?:\.\d*)?(?:[eE][+-]?\d+)?)/, 'number'],
+  [/^\.[\p{L}_][\p{L}\p{N}_]*/u, 'field'],
+  [/^\./, 'dot'],
+  [/^\$[\p{L}\p{N}_]*/u, 'variable'],
+  [/^[\p{L}_][\p{L}\p{N}_]*/u, 'ident'],
+  [/^:=/, 'declare'],
+  [/^\(/, 'lparen'],
+  [/^\)/, 'rparen'],
+  [/^\|/, 'pipe'],
+  [/^=/, 'assign'],
+  [/^,/, 'comma'],
+];
+
+// Lex the inside of an action; returns its tokens, the index after }} and
+// whether the action ends with a trim marker
+function lexAction(
+  text: string,
+  start: number,
+  fail: (i: number, msg: string) => never
+): [Token[], number, boolean] {
+  const tokens: Token[] = [];
+  let pos = start;
+  let spaced = true;
+
+  const push = (type: TokenType, value: string) => {
+    tokens.push({ type, value, spaced });
+    spaced = false;
+  };
+
+  while (pos < text.length) {
+    const c = text.charAt(pos);
+    const rest = text.slice(pos);
+
+    if (rest.startsWith('}}')) {
+      return [tokens, pos + 2, false];
+    }
+    if (/^\s-\}\}/.test(rest)) {
+      return [tokens, pos + 4, true];
+    }
+    if (/\s/.test(c)) {
+      spaced = true;
+      pos++;
+      continue;
+    }
+
+    if (c === '"') {
+      const quoted = /^"(?:[^"\\\n]|\\.)*"/.exec(rest)?.[0];
+      if (quoted === undefined) {
+        fail(pos, 'unterminated quoted string');
+      }
+      const unquoted = unquote(quoted.slice(1, -1));
+      if (unquoted === null) {
+        fail(pos, 'invalid syntax');
+      }
+      push('string', unquoted);
+      pos += quoted.length;
+      continue;
+    }
+    if (c === '`') {
+      const close = text.indexOf('`', pos + 1);
+      if (close < 0) {
+        fail(pos, 'unterminated raw quoted string');
+      }
+      push('string', text.slice(pos + 1, close));
+      pos = close + 1;
+      continue;
+    }
+    if (c === "'") {
+      // character constants are runes, which print as numbers
+      const quoted = /^'(?:[^'\\]|\\.)+'/.exec(rest)?.[0];
+      if (quoted === undefined) {
+        fail(pos, 'unterminated character constant');
+      }
+      const c = unquoteChar(quoted, 1, "'");
+      if (!c) {
+        fail(pos, 'invalid syntax');
+      }
+      if (c[2] !== quoted.length - 1) {
+        fail(pos, `malformed character constant: ${quoted}`);
+      }
+      push('number', String(c[0]));
+      pos += quoted.length;
+      continue;
+    }
+
+    const [word, type] =
+      tokenPatterns
+        .map(([pattern, type]) => [pattern.exec(rest)?.[0], type] as const)
+        .find(([word]) => word !== undefined) ?? [];
+    if (word === undefined || type === undefined) {
+      return fail(pos, `unexpected "${c}" in command`);
+    }
+    if (type === 'field') {
+      push(type, word.slice(1));
+    } else if (type === 'ident') {
+      push(word === 'true' || word === 'false' ? 'bool' : word === 'nil' ? 'nil' : type, word);
+    } else {
+      push(type, word);
+    }
+    pos += word.length;
+  }
+  return fail(start, 'unclosed action');
+}
+
+// Single character escapes of Go quoted strings
+const escapes: { [c: string]: number } = {
+  a: 0x07,
+  b: 0x08,
+  f: 0x0c,
+  n: 0x0a,
+  r: 0x0d,
+  t: 0x09,
+  v: 0x0b,
+  '\\': 0x5c,
+};
+
+// The character of a Go quoted string or character constant at s[i]: its value,
+// whether that is a byte rather than a code point, and the index after it; null
+// for an invalid escape. Port of Go strconv.UnquoteChar.
+function unquoteChar(s: string, i: number, quote: string): [number, boolean, number] | null {
+  const c = s.codePointAt(i) ?? 0;
+  if (c !== 0x5c) {
+    return [c, false, i + String.fromCodePoint(c).length];
+  }
+
+  const e = s.charAt(i + 1);
+  const simple = escapes[e];
+  if (simple !== undefined) {
+    return [simple, false, i + 2];
+  }
+  if (e === quote) {
+    return [quote.charCodeAt(0), false, i + 2];
+  }
+
+  const digits = e === 'x' ? 2 : e === 'u' ? 4 : e === 'U' ? 8 : 0;
+  if (digits > 0) {
+    const hex = s.slice(i + 2, i + 2 + digits);
+    if (hex.length < digits || !/^[0-9a-fA-F]+$/.test(hex)) {
+      return null;
+    }
+    const v = parseInt(hex, 16);
+    if (e === 'x') {
+      return [v, true, i + 2 + digits];
+    }
+    if (v > 0x10ffff || (v >= 0xd800 && v < 0xe000)) {
+      return null;
+    }
+    return [v, false, i + 2 + digits];
+  }
+
+  const octal = s.slice(i + 1, i + 4);
+  if (/^[0-7]{3}$/.test(octal) && parseInt(octal, 8) <= 0xff) {
+    return [parseInt(octal, 8), true, i + 4];
+  }
+  return null;
+}
+
+// Unquote the inside of a Go double-quoted string, or return null if an escape
+// is invalid. \x and octal escapes are bytes, so the result is decoded as UTF-8.
+function unquote(s: string): string | null {
+  const encoder = new TextEncoder();
+  const bytes: number[] = [];
+  let i = 0;
+  while (i < s.length) {
+    const c = unquoteChar(s, i, '"');
+    if (!c) {
+      return null;
+    }
+    const [value, isByte, next] = c;
+    if (isByte) {
+      bytes.push(value);
+    } else {
+      bytes.push(...encoder.encode(String.fromCodePoint(value)));
+    }
+    i = next;
+  }
+  return new TextDecoder().decode(new Uint8Array(bytes));
+}
+
+// Parsing
+
+class Parser {
+  private pos = 0;
+
+  constructor(
+    private readonly name: string,
+    private readonly items: Item[],
+    private readonly hasFunc: (name: string) => boolean
+  ) {}
+
+  parseTemplate(): Node[] {
+    const [list, stop] = this.parseList();
+    if (stop) {
+      this.fail(stop.line, `unexpected {{${stop.tokens[0]?.value}}}`);
+    }
+    return list;
+  }
+
+  private fail(line: number, msg: string): never {
+    throw new TemplateError(`template: ${this.name}:${line}: ${msg}`);
+  }
+
+  // Parse nodes up to an {{end}} or {{else}}, which is returned
+  private parseList(): [Node[], (Item & { kind: 'action' }) | null] {
+    const nodes: Node[] = [];
+    while (this.pos < this.items.length) {
+      const item = this.items[this.pos++];
+      if (!item) {
+        break;
+      }
+      if (item.kind === 'text') {
+        nodes.push(item);
+        continue;
+      }
+
+      const first = item.tokens[0];
+      if (!first) {
+        this.fail(item.line, 'missing value for command');
+      }
+      const keyword = first.type === 'ident' ? first.value : '';
+      if (keyword === 'end' || keyword === 'else') {
+        return [nodes, item];
+      }
+      if (keyword === 'if' || keyword === 'range' || keyword === 'with') {
+        nodes.push(this.parseControl(keyword, item.tokens.slice(1), item.line));
+      } else if (keyword === 'define' || keyword === 'template' || keyword === 'block') {
+        this.fail(item.line, `{{${keyword}}} is not supported`);
+      } else {
+        nodes.push({ kind: 'action', pipe: this.parsePipe(item.tokens, item.line, true) });
+      }
+    }
+    return [nodes, null];
+  }
+
+  private parseControl(kind: 'if' | 'range' | 'with', tokens: Token[], line: number): Node {
+    const pipe = this.parsePipe(tokens, line, kind !== 'if');
+    const [list, stop] = this.parseList();
+    if (!stop) {
+      this.fail(line, `unexpected EOF in ${kind}`);
+    }
+
+    let elseList: Node[] | null = null;
+    if (stop.tokens[0]?.value === 'else') {
+      const chained = stop.tokens[1];
+      if (chained?.type === 'ident' && (chained.value === 'if' || chained.value === 'with')) {
+        // {{else if}} and {{else with}} share the {{end}} of the outer action
+        elseList = [this.parseControl(chained.value, stop.tokens.slice(2), stop.line)];
+      } else {
+        if (stop.tokens.length > 1) {
+          this.fail(stop.line, 'unexpected tokens after else');
+        }
+        const [rest, end] = this.parseList();
+        if (end?.tokens[0]?.value !== 'end' || end.tokens.length > 1) {
+          this.fail(stop.line, `expected end; found ${end ? 'else' : 'EOF'}`);
+        }
+        elseList = rest;
+      }
+    } else if (stop.tokens.length > 1) {
+      this.fail(stop.line, 'unexpected tokens after end');
+    }
+    return { kind, pipe, list, elseList };
+  }
+
+  private parsePipe(tokens: Token[], line: number, allowDecl: boolean): Pipe {
+    const pipe: Pipe = { decls: [], assign: false, cmds: [], line };
+    let pos = 0;
+
+    // $x := or $i, $e :=
+    const declEnd = tokens.findIndex((t) => t.type === 'declare' || t.type === 'assign');
+    if (declEnd > 0 && tokens.slice(0, declEnd).every((t) => t.type !== 'lparen')) {
+      const names = tokens.slice(0, declEnd).filter((t) => t.type !== 'comma');
+      if (!allowDecl && names.length > 1) {
+        this.fail(line, 'too many declarations');
+      }
+      if (!names.every((t) => t.type === 'variable') || names.length > 2) {
+        this.fail(line, 'invalid declaration');
+      }
+      pipe.decls = names.map((t) => t.value);
+      pipe.assign = tokens[declEnd]?.type === 'assign';
+      pos = declEnd + 1;
+    }
+
+    const [cmds, end] = this.parseCommands(tokens, pos, line);
+    if (end < tokens.length) {
+      this.fail(line, `unexpected "${tokens[end]?.value}" in operand`);
+    }
+    if (cmds.length === 0) {
+      this.fail(line, 'missing value for command');
+    }
+    pipe.cmds = cmds;
+    return pipe;
+  }
+
+  // Parse commands separated by | up to a ) or the end
+  private parseCommands(tokens: Token[], start: number, line: number): [Operand[][], number] {
+    const cmds: Operand[][] = [];
+    let cmd: Operand[] = [];
+    let pos = start;
+
+    while (pos < tokens.length) {
+      const t = tokens[pos];
+      if (!t || t.type === 'rparen') {
+        break;
+      }
+      if (t.type === 'pipe') {
+        if (cmd.length === 0) {
+          this.fail(line, 'missing command');
+        }
+        cmds.push(cmd);
+        cmd = [];
+        pos++;
+        continue;
+      }
+      const [operand, next] = this.parseOperand(tokens, pos, line);
+      cmd.push(operand);
+      pos = next;
+    }
+
+    if (cmd.length > 0) {
+      cmds.push(cmd);
+    } else if (cmds.length > 0) {
+      this.fail(line, 'missing command');
+    }
+    return [cmds, pos];
+  }
+
+  private parseOperand(tokens: Token[], start: number, line: number): [Operand, number] {
+    const t = tokens[start] as Token;
+    let pos = start + 1;
+    let operand: Operand;
+
+    switch (t.type) {
+      case 'string':
+        operand = { kind: 'literal', value: t.value };
+        break;
+      case 'number':
+        operand = { kind: 'literal', value: parseNumber(t.value) };
+        break;
+      case 'bool':
+        operand = { kind: 'literal', value: t.value === 'true' };
+        break;
+      case 'nil':
+        operand = { kind: 'literal', value: null };
+        break;
+      case 'dot':
+        operand = { kind: 'dot' };
+        break;
+      case 'field':
+        operand = { kind: 'chain', receiver: { kind: 'dot' }, fields: [t.value] };
+        break;
+      case 'variable':
+        operand = { kind: 'var', name: t.value };
+        break;
+      case 'ident':
+        if (!this.hasFunc(t.value)) {
+          this.fail(line, `function "${t.value}" not defined`);
+        }
+        operand = { kind: 'ident', name: t.value };
+        break;
+      case 'lparen': {
+        const [cmds, end] = this.parseCommands(tokens, pos, line);
+        if (tokens[end]?.type !== 'rparen') {
+          this.fail(line, 'unclosed left paren');
+        }
+        if (cmds.length === 0) {
+          this.fail(line, 'missing value for parenthesized pipeline');
+        }
+        operand = { kind: 'pipe', pipe: { decls: [], assign: false, cmds, line } };
+        pos = end + 1;
+        break;
+      }
+      default:
+        return this.fail(line, `unexpected "${t.value}" in operand`);
+    }
+
+    // field chains: .A.B, $x.A, (pipeline).A
+    while (tokens[pos]?.type === 'field' && !tokens[pos]?.spaced) {
+      const field = tokens[pos++]?.value ?? '';
+      if (operand.kind === 'chain') {
+        operand.fields.push(field);
+      } else {
+        operand = { kind: 'chain', receiver: operand, fields: [field] };
+      }
+    }
+    return [operand, pos];
+  }
+}
+
+function parseNumber(s: string): number {
+  const clean = s.replace(/_/g, '');
+  return /^[+-]?0[xX]/.test(clean) ? parseInt(clean, 16) : Number(clean);
+}
+
+// Execution
+
+// Marks a command that isn't the last argument of a pipeline
+const NoFinal = Symbol('noFinal');
+
+class State {
+  private vars: [string, unknown][];
+  private line = 0;
+
+  constructor(
+    private readonly name: string,
+    private readonly fns: FuncMap,
+    data: unknown
+  ) {
+    this.vars = [['$', data]];
+  }
+
+  private fail(msg: string): never {
+    throw new TemplateError(`template: ${this.name}:${this.line}: ${msg}`);
+  }
+
+  walk(nodes: Node[], dot: unknown): string {
+    let out = '';
+    for (const node of nodes) {
+      if (node.kind === 'text') {
+        out += node.text;
+        continue;
+      }
+
+      const mark = this.vars.length;
+      if (node.kind === 'action') {
+        const value = this.evalPipe(node.pipe, dot);
+        if (node.pipe.decls.length === 0) {
+          out += printValue(value);
+        }
+        continue;
+      }
+
+      // range declares its variables per element
+      const value = this.evalPipe(node.pipe, dot, node.kind !== 'range');
+      if (node.kind === 'range') {
+        out += this.walkRange(node.pipe, value, node.list, node.elseList, dot);
+      } else if (truth(value)) {
+        out += this.walk(node.list, node.kind === 'with' ? value : dot);
+      } else if (node.elseList) {
+        out += this.walk(node.elseList, dot);
+      }
+      this.vars.length = mark;
+    }
+    return out;
+  }
+
+  private walkRange(
+    pipe: Pipe,
+    value: unknown,
+    list: Node[],
+    elseList: Node[] | null,
+    dot: unknown
+  ): string {
+    let entries: [unknown, unknown][];
+    if (Array.isArray(value)) {
+      entries = value.map((v, i) => [i, v]);
+    } else if (typeof value === 'number' && Number.isInteger(value)) {
+      entries = Array.from({ length: Math.max(value, 0) }, (_, i) => [i, i]);
+    } else if (value instanceof Map) {
+      entries = [...value.entries()].sort(([a], [b]) => compareKeys(a, b));
+    } else if (value !== null && typeof value === 'object') {
+      entries = Object.keys(value)
+        .sort()
+        .map((k) => [k, (value as Record<string, unknown>)[k]]);
+    } else if (value === null || value === undefined) {
+      entries = [];
+    } else {
+      return this.fail(`range can't iterate over ${printValue(value)}`);
+    }
+
+    if (entries.length === 0) {
+      return elseList ? this.walk(elseList, dot) : '';
+    }
+
+    let out = '';
+    const mark = this.vars.length;
+    for (const [key, elem] of entries) {
+      const [first, second] = pipe.decls;
+      if (first !== undefined) {
+        this.setVar(first, pipe.decls.length === 1 ? elem : key, !pipe.assign);
+      }
+      if (second !== undefined) {
+        this.setVar(second, elem, !pipe.assign);
+      }
+      out += this.walk(list, elem);
+      this.vars.length = mark;
+    }
+    return out;
+  }
+
+  private setVar(name: string, value: unknown, declare: boolean): void {
+    if (declare) {
+      this.vars.push([name, value]);
+      return;
+    }
+    for (let i = this.vars.length - 1; i >= 0; i--) {
+      const v = this.vars[i];
+      if (v && v[0] === name) {
+        v[1] = value;
+        return;
+      }
+    }
+    this.fail(`undefined variable: ${name}`);
+  }
+
+  private getVar(name: string): unknown {
+    for (let i = this.vars.length - 1; i >= 0; i--) {
+      const v = this.vars[i];
+      if (v && v[0] === name) {
+        return v[1];
+      }
+    }
+    return this.fail(`undefined variable: ${name}`);
+  }
+
+  private evalPipe(pipe: Pipe, dot: unknown, declare = true): unknown {
+    this.line = pipe.line;
+    let value: unknown = NoFinal;
+    for (const cmd of pipe.cmds) {
+      value = this.evalCommand(cmd, dot, value);
+    }
+    for (const decl of declare ? pipe.decls : []) {
+      this.setVar(decl, value, !pipe.assign);
+    }
+    return value;
+  }
+
+  private evalCommand(cmd: Operand[], dot: unknown, final: unknown): unknown {
+    const [first, ...rest] = cmd;
+    if (!first) {
+      return this.fail('missing command');
+    }
+    const args = () => {
+      const values = rest.map((arg) => this.evalArg(arg, dot));
+      return final === NoFinal ? values : [...values, final];
+    };
+
+    if (first.kind === 'ident') {
+      return this.call(first.name, args());
+    }
+    if (first.kind === 'chain') {
+      return this.evalChain(first, dot, rest.length > 0 || final !== NoFinal ? args() : null);
+    }
+    if (first.kind === 'literal' && first.value === null) {
+      this.fail('nil is not a command');
+    }
+    if (rest.length > 0 || final !== NoFinal) {
+      this.fail(`can't give argument to non-function ${describe(first)}`);
+    }
+    return this.evalArg(first, dot);
+  }
+
+  private evalArg(arg: Operand, dot: unknown): unknown {
+    switch (arg.kind) {
+      case 'literal':
+        return arg.value;
+      case 'dot':
+        return dot;
+      case 'var':
+        return this.getVar(arg.name);
+      case 'ident':
+        return this.call(arg.name, []);
+      case 'pipe':
+        return this.evalPipe(arg.pipe, dot);
+      case 'chain':
+        return this.evalChain(arg, dot, null);
+    }
+  }
+
+  // Resolve a field chain; methods (functions) are called, the last one with args
+  private evalChain(
+    chain: Operand & { kind: 'chain' },
+    dot: unknown,
+    args: unknown[] | null
+  ): unknown {
+    let value = this.evalArg(chain.receiver, dot);
+    for (const [i, field] of chain.fields.entries()) {
+      const last = i === chain.fields.length - 1;
+      if (value === null || value === undefined) {
+        if (i > 0) {
+          this.fail(`nil pointer evaluating .${chain.fields.slice(0, i).join('.')}.${field}`);
+        }
+        return undefined;
+      }
+
+      const receiver = value as Record<string, unknown>;
+      const member = receiver instanceof Map ? receiver.get(field) : receiver[field];
+      if (typeof member === 'function') {
+        value = member.apply(receiver, last && args ? args : []);
+      } else {
+        if (last && args) {
+          this.fail(`${field} has arguments but cannot be invoked as function`);
+        }
+        value = member;
+      }
+    }
+    return value;
+  }
+
+  private call(name: string, args: unknown[]): unknown {
+    const fn = this.fns[name];
+    if (!fn) {
+      return this.fail(`"${name}" is not a defined function`);
+    }
+    try {
+      return fn(...args);
+    } catch (err) {
+      if (err instanceof TemplateError) {
+        throw err;
+      }
+      const msg = err instanceof Error ? err.message : String(err);
+      return this.fail(`error calling ${name}: ${msg}`);
+    }
+  }
+}
+
+function describe(operand: Operand): string {
+  switch (operand.kind) {
+    case 'literal':
+      return typeof operand.value === 'string'
+        ? JSON.stringify(operand.value)
+        : printValue(operand.value);
+    case 'dot':
+      return 'dot';
+    case 'var':
+      return operand.name;
+    default:
+      return 'pipeline';
+  }
+}
+
+function compareKeys(a: unknown, b: unknown): number {
+  if (typeof a === 'number' && typeof b === 'number') {
+    return a - b;
+  }
+  return String(a) < String(b) ? -1 : String(a) > String(b) ? 1 : 0;
+}
+
+// Truth reports whether a value is true in the sense of Go's if: not the zero
+// value and not empty
+function truth(value: unknown): boolean {
+  if (Array.isArray(value)) {
+    return value.length > 0;
+  }
+  if (value instanceof Map) {
+    return value.size > 0;
+  }
+  if (value !== null && typeof value === 'object' && value.constructor === Object) {
+    return Object.keys(value).length > 0;
+  }
+  return Boolean(value);
+}
+
+/**
+ * PrintValue formats a value like Go's fmt %v: nil as <nil>, missing values as
+ * <no value>, arrays as [a b] and objects as map[k:v]
+ */
+function printValue(value: unknown): string {
+  if (value === undefined || value === NoFinal) {
+    return NoValue;
+  }
+  if (value === null) {
+    return '<nil>';
+  }
+  if (Array.isArray(value)) {
+    return `[${value.map(printValue).join(' ')}]`;
+  }
+  if (value instanceof Map) {
+    const entries = [...value.entries()].sort(([a], [b]) => compareKeys(a, b));
+    return `map[${entries.map(([k, v]) => `${printValue(k)}:${printValue(v)}`).join(' ')}]`;
+  }
+  if (typeof value === 'object' && value.constructor === Object) {
+    const keys = Object.keys(value).sort();
+    const record = value as Record<string, unknown>;
+    return `map[${keys.map((k) => `${k}:${printValue(record[k])}`).join(' ')}]`;
+  }
+  return String(value);
+}
+
+// Predefined functions
+
+// Compare basic values of the same kind; only eq and ne accept nil and booleans
+function compare(a: unknown, b: unknown, ordered: boolean): number {
+  const kind = typeof a;
+  if (kind !== typeof b || !['number', 'string', 'boolean'].includes(kind)) {
+    if (!ordered && (a === null || b === null)) {
+      return a === b ? 0 : 1;
+    }
+    throw new Error('incompatible types for comparison');
+  }
+  if (ordered && kind === 'boolean') {
+    throw new Error('invalid type for comparison');
+  }
+  const [x, y] = [a as string | number, b as string | number];
+  return x < y ? -1 : x > y ? 1 : 0;
+}
+
+// Go's fmt.Sprint adds spaces between operands when neither is a string
+function sprint(args: unknown[]): string {
+  return args
+    .map((arg, i) => {
+      const space = i > 0 && typeof arg !== 'string' && typeof args[i - 1] !== 'string';
+      return (space ? ' ' : '') + printValue(arg);
+    })
+    .join('');
+}
+
+/**
+ * Sprintf implements the common verbs of Go's fmt.Sprintf: %v %s %d %f %q %t %x
+ * %X %c and %%, with the - + and 0 flags, width and precision
+ */
+export function sprintf(format: string, ...args: unknown[]): string {
+  let n = 0;
+  return format.replace(
+    /%([-+0]*)(\d+)?(?:\.(\d+))?([vsdfqtxXc%])/g,
+    (_, flags: string, width: string | undefined, prec: string | undefined, verb: string) => {
+      if (verb === '%') {
+        return '%';
+      }
+      if (n >= args.length) {
+        return `%!${verb}(MISSING)`;
+      }
+      const arg = args[n++];
+      const bad = () => `%!${verb}(${printValue(arg)})`;
+      let s: string;
+      switch (verb) {
+        case 'd':
+          s = typeof arg === 'number' ? Math.trunc(arg).toString() : bad();
+          break;
+        case 'f':
+          s = typeof arg === 'number' ? arg.toFixed(prec === undefined ? 6 : Number(prec)) : bad();
+          break;
+        case 'q':
+          s = JSON.stringify(typeof arg === 'string' ? arg : printValue(arg));
+          break;
+        case 't':
+          s = typeof arg === 'boolean' ? String(arg) : bad();
+          break;
+        case 'x':
+        case 'X':
+          s =
+            typeof arg === 'number'
+              ? arg.toString(16)
+              : Buffer.from(printValue(arg)).toString('hex');
+          s = verb === 'X' ? s.toUpperCase() : s;
+          break;
+        case 'c':
+          s = typeof arg === 'number' ? String.fromCodePoint(arg) : bad();
+          break;
+        default:
+          s = printValue(arg);
+          if (verb === 's' && prec !== undefined) {
+            s = s.slice(0, Number(prec));
+          }
+      }
+
+      if (flags.includes('+') && typeof arg === 'number' && arg >= 0 && 'dfv'.includes(verb)) {
+        s = `+${s}`;
+      }
+      const w = Number(width ?? 0);
+      if (s.length >= w) {
+        return s;
+      }
+      if (flags.includes('-')) {
+        return s.padEnd(w);
+      }
+      if (flags.includes('0') && typeof arg === 'number') {
+        const sign = /^[+-]/.test(s) ? s.charAt(0) : '';
+        return sign + s.slice(sign.length).padStart(w - sign.length, '0');
+      }
+      return s.padStart(w);
+    }
+  );
+}
+
+const htmlEscapes: { [c: string]: string } = {
+  '<': '&lt;',
+  '>': '&gt;',
+  '&': '&amp;',
+  "'": '&#39;',
+  '"': '&#34;',
+};
+
+const builtins: FuncMap = {
+  and: (...args) => args.find((a) => !truth(a)) ?? args[args.length - 1],
+  or: (...args) => args.find((a) => truth(a)) ?? args[args.length - 1],
+  not: (a) => !truth(a),
+  len: (a) => {
+    if (typeof a === 'string') {
+      return Buffer.byteLength(a);
+    }
+    if (Array.isArray(a)) {
+      return a.length;
+    }
+    if (a instanceof Map) {
+      return a.size;
+    }
+    if (a !== null && typeof a === 'object') {
+      return Object.keys(a).length;
+    }
+    throw new Error(`len of type ${a === null ? 'nil' : typeof a}`);
+  },
+  index: (item, ...indexes) =>
+    indexes.reduce((v, i) => {
+      if (v instanceof Map) {
+        return v.get(i);
+      }
+      if (typeof v === 'string') {
+        return Buffer.from(v)[Number(i)];
+      }
+      if (v === null || typeof v !== 'object') {
+        throw new Error(`can't index item of type ${v === null ? 'nil' : typeof v}`);
+      }
+      if (Array.isArray(v) && (typeof i !== 'number' || i < 0 || i >= v.length)) {
+        throw new Error(`index out of range: ${printValue(i)}`);
+      }
+      return (v as Record<string, unknown>)[String(i)];
+    }, item),
+  print: (...args) => sprint(args),
+  printf: (format, ...args) => sprintf(String(format), ...args),
+  println: (...args) => `${args.map(printValue).join(' ')}\n`,
+  eq: (a, ...rest) => {
+    if (rest.length === 0) {
+      throw new Error('missing argument for comparison');
+    }
+    return rest.some((b) => compare(a, b, false) === 0);
+  },
+  ne: (a, b) => compare(a, b, false) !== 0,
+  lt: (a, b) => compare(a, b, true) < 0,
+  le: (a, b) => compare(a, b, true) <= 0,
+  gt: (a, b) => compare(a, b, true) > 0,
+  ge: (a, b) => compare(a, b, true) >= 0,
+  html: (...args) => sprint(args).replace(/[<>&'"\0]/g, (c) => htmlEscapes[c] ?? '\uFFFD'),
+  urlquery: (...args) =>
+    encodeURIComponent(sprint(args))
+      .replace(/[!'()*]/g, (c) => `%${c.charCodeAt(0).toString(16).toUpperCase()}`)
+      .replace(/%20/g, '+'),
+};
@@ -0,0 +1,203 @@
+/**
+ * Terminal identification using Device Attributes (DA1/DA2) and XTVERSION replies.
+ */
+
+import { CSI, ESC, Profile, ST } from './types.js';
+
+/**
+ * Query sequences sent when probing the terminal
+ */
+export const XTVersionQuery = `${CSI}>0q`;
+export const SecondaryDeviceAttributesQuery = `${CSI}>c`;
+export const PrimaryDeviceAttributesQuery = `${CSI}c`;
+
+/**
+ * Features a terminal may announce in its Primary Device Attributes
+ */
+export type TerminalFeature =
+  | 'columns132'
+  | 'printer'
+  | 'regis'
+  | 'sixel'
+  | 'selectiveErase'
+  | 'userDefinedKeys'
+  | 'nationalReplacementCharsets'
+  | 'technicalCharacters'
+  | 'locator'
+  | 'stateInterrogation'
+  | 'windowing'
+  | 'horizontalScrolling'
+  | 'ansiColor'
+  | 'rectangularEditing'
+  | 'textLocator'
+  | 'clipboard';
+
+// DA1 attribute codes as documented by xterm's ctlseqs
+const featureCodes: { [code: number]: TerminalFeature } = {
+  1: 'columns132',
+  2: 'printer',
+  3: 'regis',
+  4: 'sixel',
+  6: 'selectiveErase',
+  8: 'userDefinedKeys',
+  9: 'nationalReplacementCharsets',
+  15: 'technicalCharacters',
+  16: 'locator',
+  17: 'stateInterrogation',
+  18: 'windowing',
+  21: 'horizontalScrolling',
+  22: 'ansiColor',
+  28: 'rectangularEditing',
+  29: 'textLocator',
+  52: 'clipboard',
+};
+
+// DA2 terminal type ids that identify a specific emulator
+const secondaryTypes: { [id: number]: string } = {
+  41: 'xterm',
+  65: 'vte',
+  77: 'mintty',
+  83: 'screen',
+  84: 'tmux',
+};
+
+const trueColorTerminals = [
+  'alacritty',
+  'contour',
+  'foot',
+  'ghostty',
+  'iterm2',
+  'kitty',
+  'konsole',
+  'mintty',
+  'rio',
+  'vte',
+  'wezterm',
+];
+
+const ansi256Terminals = ['screen', 'tmux', 'xterm'];
+
+/**
+ * TerminalIdentity describes the terminal as reported by its DA1, DA2 and
+ * XTVERSION replies.
+ */
+export interface TerminalIdentity {
+  /** Lowercase terminal name, e.g. "kitty" or "xterm"; empty if unknown */
+  name: string;
+  /** Terminal version as reported, empty if unknown */
+  version: string;
+  /** Features announced in the Primary Device Attributes */
+  features: TerminalFeature[];
+  /** Conformance level from DA1, e.g. 62 for VT220 */
+  level: number;
+  /** Raw DA1 attribute codes */
+  primary: number[];
+  /** Raw DA2 parameters: terminal type, firmware version, ROM cartridge */
+  secondary: number[];
+  /** Raw XTVERSION text, e.g. "XTerm(388)" */
+  xtversion: string;
+}
+
+/**
+ * Parse a Primary Device Attributes reply of the form CSI ? level ; attrs... c
+ */
+export function parsePrimaryDeviceAttributes(s: string): number[] | null {
+  const prefix = `${CSI}?`;
+  if (!s.startsWith(prefix) || !s.endsWith('c')) {
+    return null;
+  }
+  return parseParams(s.slice(prefix.length, -1));
+}
+
+/**
+ * Parse a Secondary Device Attributes reply of the form CSI > type ; version ; rom c
+ */
+export function parseSecondaryDeviceAttributes(s: string): number[] | null {
+  const prefix = `${CSI}>`;
+  if (!s.startsWith(prefix) || !s.endsWith('c')) {
+    return null;
+  }
+  return parseParams(s.slice(prefix.length, -1));
+}
+
+/**
+ * Parse an XTVERSION reply of the form DCS > | text ST and return the text
+ */
+export function parseXTVersion(s: string): string | null {
+  const prefix = `${ESC}P>|`;
+  if (!s.startsWith(prefix) || !s.endsWith(ST)) {
+    return null;
+  }
+  return s.slice(prefix.length, -ST.length);
+}
+
+function parseParams(s: string): number[] | null {
+  const params = s.split(';');
+  if (!params.every((p) => /^\d*$/.test(p))) {
+    return null;
+  }
+  return params.map((p) => (p === '' ? 0 : parseInt(p, 10)));
+}
+
+/**
+ * Identify builds a TerminalIdentity from the parsed replies. XTVERSION names the
+ * terminal when available, the DA2 terminal type is used as a fallback.
+ */
+export function identify(
+  primary: number[],
+  secondary: number[],
+  xtversion = ''
+): TerminalIdentity {
+  let name = '';
+  let version = '';
+
+  if (xtversion !== '') {
+    // "XTerm(388)", "kitty(0.26.5)", "WezTerm 20220408-101518-b908e2dd", "tmux 3.3a"
+    const paren = xtversion.indexOf('(');
+    if (paren > 0 && xtversion.endsWith(')')) {
+      name = xtversion.slice(0, paren);
+      version = xtversion.slice(paren + 1, -1);
+    } else {
+      const space = xtversion.indexOf(' ');
+      name = space > 0 ? xtversion.slice(0, space) : xtversion;
+      version = space > 0 ? xtversion.slice(space + 1) : '';
+    }
+    name = name.trim().toLowerCase();
+    version = version.trim();
+  } else if (secondary.length > 0) {
+    const [type = 0, firmware = 0] = secondary;
+    const known = secondaryTypes[type];
+    if (known) {
+      name = known;
+      version = firmware.toString();
+    }
+  }
+
+  const [level = 0, ...attrs] = primary;
+  const features: TerminalFeature[] = [];
+  for (const code of attrs) {
+    const feature = featureCodes[code];
+    if (feature && !features.includes(feature)) {
+      features.push(feature);
+    }
+  }
+
+  return { name, version, features, level, primary: attrs, secondary, xtversion };
+}
+
+/**
+ * ProfileFromIdentity returns the color profile implied by a terminal's identity,
+ * or null if the identity doesn't tell.
+ */
+export function profileFromIdentity(identity: TerminalIdentity): Profile | null {
+  if (trueColorTerminals.includes(identity.name)) {
+    return Profile.TrueColor;
+  }
+  if (ansi256Terminals.includes(identity.name)) {
+    return Profile.ANSI256;
+  }
+  if (identity.features.includes('ansiColor')) {
+    return Profile.ANSI;
+  }
+  return null;
+}
@@ -0,0 +1,297 @@
+/**
+ * Compiled terminfo database reader.
+ * Reads the legacy and the extended number (ncurses 6) formats described in term(5).
+ */
+
+import { existsSync, readFileSync } from 'node:fs';
+import { join } from 'node:path';
+import { type Environ, Profile, TermEnvError } from './types.js';
+
+// Magic numbers of the legacy (16-bit numbers) and extended (32-bit numbers) formats
+const MagicLegacy = 0o432;
+const Magic32Bit = 0o1036;
+
+// Predefined boolean capabilities, in the order of term.h
+// biome-ignore format: keep the table compact
+const booleanNames = [
+  'bw', 'am', 'xsb', 'xhp', 'xenl', 'eo', 'gn', 'hc', 'km', 'hs', 'in', 'db', 'da',
+  'mir', 'msgr', 'os', 'eslok', 'xt', 'hz', 'ul', 'xon', 'nxon', 'mc5i', 'chts',
+  'nrrmc', 'npc', 'ndscr', 'ccc', 'bce', 'hls', 'xhpa', 'crxm', 'daisy', 'xvpa',
+  'sam', 'cpix', 'lpix',
+];
+
+// Predefined numeric capabilities, in the order of term.h
+// biome-ignore format: keep the table compact
+const numberNames = [
+  'cols', 'it', 'lines', 'lm', 'xmc', 'pb', 'vt', 'wsl', 'nlab', 'lh', 'lw', 'ma',
+  'wnum', 'colors', 'pairs', 'ncv', 'bufsz', 'spinv', 'spinh', 'maddr', 'mjump',
+  'mcs', 'mls', 'npins', 'orc', 'orhi', 'orvi', 'cps', 'widcs', 'btns', 'bitwin',
+  'bitype',
+];
+
+/**
+ * Terminfo is a parsed terminfo entry. Predefined string capabilities are not
+ * decoded, only the extended (user-defined) ones like setrgbf.
+ */
+export class Terminfo {
+  constructor(
+    public names: string[],
+    public booleans: Record<string, boolean>,
+    public numbers: Record<string, number>,
+    public strings: Record<string, string>
+  ) {}
+
+  /** Flag reports whether a boolean capability is set */
+  flag(name: string): boolean {
+    return this.booleans[name] === true;
+  }
+
+  /** Number returns a numeric capability, or -1 if absent */
+  number(name: string): number {
+    return this.numbers[name] ?? -1;
+  }
+
+  /** String returns a string capability, or null if absent */
+  string(name: string): string | null {
+    return this.strings[name] ?? null;
+  }
+}
+
+/**
+ * Parse a compiled terminfo entry
+ */
+export function parseTerminfo(data: Uint8Array): Terminfo {
+  const view = new DataView(data.buffer, data.byteOffset, data.byteLength);
+  let pos = 0;
+
+  const short = (): number => {
+    if (pos + 2 > data.length) {
+      throw new TermEnvError('terminfo: unexpected end of data');
+    }
+    const v = view.getInt16(pos, true);
+    pos += 2;
+    return v;
+  };
+
+  const magic = short();
+  if (magic !== MagicLegacy && magic !== Magic32Bit) {
+    throw new TermEnvError(`terminfo: bad magic number ${magic.toString(8)}`);
+  }
+  const numberSize = magic === Magic32Bit ? 4 : 2;
+  const number = (): number => {
+    if (numberSize === 2) {
+      return short();
+    }
+    if (pos + 4 > data.length) {
+      throw new TermEnvError('terminfo: unexpected end of data');
+    }
+    const v = view.getInt32(pos, true);
+    pos += 4;
+    return v;
+  };
+
+  const namesSize = short();
+  const boolCount = short();
+  const numCount = short();
+  const strCount = short();
+  const strTableSize = short();
+
+  const decoder = new TextDecoder('latin1');
+  const names = decoder
+    .decode(data.subarray(pos, pos + namesSize))
+    .replace(/\0.*$/, '')
+    .split('|');
+  pos += namesSize;
+
+  const booleans: Record<string, boolean> = {};
+  for (let i = 0; i < boolCount; i++) {
+    const name = booleanNames[i];
+    if (name && data[pos + i] === 1) {
+      booleans[name] = true;
+    }
+  }
+  pos += boolCount;
+  // numbers are aligned on an even byte boundary
+  pos += pos % 2;
+
+  const numbers: Record<string, number> = {};
+  for (let i = 0; i < numCount; i++) {
+    const v = number();
+    const name = numberNames[i];
+    if (name && v >= 0) {
+      numbers[name] = v;
+    }
+  }
+
+  // predefined strings: skip their offsets and table
+  pos += strCount * 2 + strTableSize;
+  const strings: Record<string, string> = {};
+
+  // extended capabilities, if any, start on an even byte boundary
+  pos += pos % 2;
+  if (pos + 10 <= data.length) {
+    const extBoolCount = short();
+    const extNumCount = short();
+    const extStrCount = short();
+    short(); // number of offsets in the table
+    const extTableSize = short();
+
+    const bools: boolean[] = [];
+    for (let i = 0; i < extBoolCount; i++) {
+      bools.push(data[pos + i] === 1);
+    }
+    pos += extBoolCount;
+    pos += pos % 2;
+
+    const nums: number[] = [];
+    for (let i = 0; i < extNumCount; i++) {
+      nums.push(number());
+    }
+
+    const valueOffsets: number[] = [];
+    for (let i = 0; i < extStrCount; i++) {
+      valueOffsets.push(short());
+    }
+    const nameOffsets: number[] = [];
+    for (let i = 0; i < extBoolCount + extNumCount + extStrCount; i++) {
+      nameOffsets.push(short());
+    }
+
+    const table = data.subarray(pos, pos + extTableSize);
+    const cstring = (offset: number): string => {
+      const end = table.indexOf(0, offset);
+      return decoder.decode(table.subarray(offset, end < 0 ? table.length : end));
+    };
+
+    // the table holds the string values first, followed by the capability names
+    let namesStart = 0;
+    const values = valueOffsets.map((offset) => {
+      if (offset < 0) {
+        return null;
+      }
+      const value = cstring(offset);
+      namesStart = Math.max(namesStart, offset + value.length + 1);
+      return value;
+    });
+    const extName = (i: number): string => cstring(namesStart + (nameOffsets[i] ?? 0));
+
+    bools.forEach((set, i) => {
+      if (set) {
+        booleans[extName(i)] = true;
+      }
+    });
+    nums.forEach((v, i) => {
+      if (v >= 0) {
+        numbers[extName(extBoolCount + i)] = v;
+      }
+    });
+    values.forEach((v, i) => {
+      if (v !== null) {
+        strings[extName(extBoolCount + extNumCount + i)] = v;
+      }
+    });
+  }
+
+  return new Terminfo(names, booleans, numbers, strings);
+}
+
+/**
+ * TerminfoDirs returns the directories searched for terminfo entries, in the
+ * order used by ncurses: $TERMINFO, ~/.terminfo, $TERMINFO_DIRS and the system
+ * default locations.
+ */
+export function terminfoDirs(environ: Environ): string[] {
+  const defaults = ['/etc/terminfo', '/lib/terminfo', '/usr/share/terminfo'];
+  const dirs: string[] = [];
+
+  const terminfo = environ.getenv('TERMINFO');
+  if (terminfo !== '') {
+    dirs.push(terminfo);
+  }
+
+  const home = environ.getenv('HOME');
+  if (home !== '') {
+    dirs.push(join(home, '.terminfo'));
+  }
+
+  const terminfoDirs = environ.getenv('TERMINFO_DIRS');
+  if (terminfoDirs !== '') {
+    for (const dir of terminfoDirs.split(':')) {
+      // an empty entry stands for the default locations
+      dirs.push(...(dir === '' ? defaults : [dir]));
+    }
+  }
+
+  dirs.push(...defaults);
+  return [...new Set(dirs)];
+}
+
+/**
+ * FindTerminfo returns the path of the compiled entry for term, looking in both
+ * the first-letter (Linux) and hex (macOS) directory layouts.
+ */
+export function findTerminfo(term: string, dirs: string[]): string | null {
+  if (term === '' || term.includes('/') || term.startsWith('.')) {
+    return null;
+  }
+
+  const first = term.charAt(0);
+  const hex = first.charCodeAt(0).toString(16);
+  for (const dir of dirs) {
+    for (const sub of [first, hex]) {
+      const path = join(dir, sub, term);
+      if (existsSync(path)) {
+        return path;
+      }
+    }
+  }
+  return null;
+}
+
+const terminfoCache = new Map<string, Terminfo | null>();
+
+/**
+ * LoadTerminfo finds and parses the terminfo entry for term. Results are cached;
+ * missing or unreadable entries yield null.
+ */
+export function loadTerminfo(term: string, environ: Environ): Terminfo | null {
+  const dirs = terminfoDirs(environ);
+  const key = `${dirs.join(':')}\0${term}`;
+  const cached = terminfoCache.get(key);
+  if (cached !== undefined) {
+    return cached;
+  }
+
+  let ti: Terminfo | null = null;
+  const path = findTerminfo(term, dirs);
+  if (path) {
+    try {
+      ti = parseTerminfo(readFileSync(path));
+    } catch {
+      ti = null;
+    }
+  }
+
+  terminfoCache.set(key, ti);
+  return ti;
+}
+
+/**
+ * ProfileFromTerminfo returns the color profile a terminfo entry describes.
+ * Direct color is announced by the RGB or Tc capabilities, a setrgbf string or
+ * a color count of 2^24.
+ */
+export function profileFromTerminfo(ti: Terminfo): Profile {
+  const colors = ti.number('colors');
+  const rgb = ti.flag('RGB') || ti.number('RGB') >= 0 || ti.string('RGB') !== null;
+  if (rgb || ti.flag('Tc') || ti.string('setrgbf') !== null || colors >= 0x1000000) {
+    return Profile.TrueColor;
+  }
+  if (colors >= 256) {
+    return Profile.ANSI256;
+  }
+  if (colors >= 8) {
+    return Profile.ANSI;
+  }
+  return Profile.Ascii;
+}
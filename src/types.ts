@@ -38,6 +38,17 @@ export class StatusReportError extends TermEnvError {
   }
 }
 
+export class MarkupError extends TermEnvError {
+  constructor(
+    message: string,
+    /** Offset of the offending tag in the markup */
+    public position: number
+  ) {
+    super(`${message} at position ${position}`);
+    this.name = 'MarkupError';
+  }
+}
+
 /**
  * Color is an interface implemented by all colors that can be converted to an ANSI sequence.
  */
@@ -200,6 +211,32 @@ export function convertToRGB(c: Color): ColorfulColor | null {
   return null;
 }
 
+/**
+ * SendString writes s to an output without waiting, with its send() method or,
+ * for outputs without one, with writeString(), handing failures to the output's
+ * handleWriteError() if it has one
+ */
+export function sendString(output: Output, s: string): void {
+  if (output.send) {
+    output.send(s);
+    return;
+  }
+  output.writeString(s).catch((err: unknown) => {
+    if (!output.handleWriteError) {
+      throw err;
+    }
+    output.handleWriteError(err);
+  });
+}
+
+/**
+ * CursorPosition is a 1-based cursor position as reported by the terminal
+ */
+export interface CursorPosition {
+  row: number;
+  column: number;
+}
+
 /**
  * Environ interface for getting environment variables
  */
@@ -249,6 +286,15 @@ export interface Output {
   write(data: Uint8Array): Promise<number>;
   writeString(s: string): Promise<number>;
 
+  /** Write buffered output, see withBuffering; optional for custom outputs */
+  flush?(): Promise<void>;
+
+  /** Write without waiting, handing failures to handleWriteError; optional */
+  send?(s: string): void;
+
+  /** Handle a failed write that nobody awaited, see withErrorHandler; optional */
+  handleWriteError?(err: unknown): void;
+
   /** Check if output is a TTY */
   isTTY(): boolean;
 
@@ -260,6 +306,10 @@ export interface Output {
   backgroundColor(): Color;
   hasDarkBackground(): boolean;
 
+  /** Query the terminal for its colors (OSC 10/11) */
+  queryForegroundColor(): Promise<Color>;
+  queryBackgroundColor(): Promise<Color>;
+
   /** Create a styled string */
   string(...strings: string[]): unknown; // Will be Style class
 
@@ -267,6 +317,7 @@ export interface Output {
   color(s: string): Color | null;
 
   // Terminal control methods (from screen.ts)
+  cursorPosition(): Promise<CursorPosition>;
   moveCursor(row: number, column: number): void;
   cursorUp(n?: number): void;
   cursorDown(n?: number): void;
@@ -309,6 +360,12 @@ export interface Output {
   enableBracketedPaste(): void;
   disableBracketedPaste(): void;
 
+  // Synchronized output
+  beginSynchronizedUpdate(): void;
+  endSynchronizedUpdate(): void;
+  withSynchronizedOutput<T>(fn: () => T): T;
+  supportsSynchronizedOutput(): Promise<boolean>;
+
   // Scrolling
   changeScrollingRegion(top: number, bottom: number): void;
   insertLines(n: number): void;
@@ -0,0 +1,82 @@
+import { describe, expect, test } from 'bun:test';
+import { stripAnsi, tokenize } from '#src/ansi.js';
+
+describe('tokenize', () => {
+  test('splits text and CSI sequences', () => {
+    expect(tokenize('a\x1b[1;31mred\x1b[0m')).toEqual([
+      { kind: 'text', value: 'a', params: '', final: '' },
+      { kind: 'csi', value: '\x1b[1;31m', params: '1;31', final: 'm' },
+      { kind: 'text', value: 'red', params: '', final: '' },
+      { kind: 'csi', value: '\x1b[0m', params: '0', final: 'm' },
+    ]);
+  });
+
+  test('keeps private markers and intermediates in CSI params', () => {
+    expect(tokenize('\x1b[?25l')[0]).toEqual({
+      kind: 'csi',
+      value: '\x1b[?25l',
+      params: '?25',
+      final: 'l',
+    });
+    expect(tokenize('\x1b[2 q')[0]?.params).toBe('2 ');
+    expect(tokenize('\x1b[m')[0]).toEqual({ kind: 'csi', value: '\x1b[m', params: '', final: 'm' });
+  });
+
+  test('reads OSC strings terminated by ST or BEL', () => {
+    const link = '\x1b]8;;https://example.com\x1b\\';
+    expect(tokenize(`${link}x`)).toEqual([
+      { kind: 'osc', value: link, params: '8;;https://example.com', final: '' },
+      { kind: 'text', value: 'x', params: '', final: '' },
+    ]);
+    expect(tokenize('\x1b]2;title\x07')[0]).toEqual({
+      kind: 'osc',
+      value: '\x1b]2;title\x07',
+      params: '2;title',
+      final: '',
+    });
+  });
+
+  test('reads DCS and APC strings', () => {
+    expect(tokenize('\x1bP>|XTerm(388)\x1b\\')[0]).toMatchObject({
+      kind: 'dcs',
+      params: '>|XTerm(388)',
+    });
+    expect(tokenize('\x1b_Gf=100;AAAA\x1b\\')[0]).toMatchObject({
+      kind: 'apc',
+      params: 'Gf=100;AAAA',
+    });
+    // BEL doesn't end a DCS
+    expect(tokenize('\x1bPa\x07b\x1b\\')[0]?.params).toBe('a\x07b');
+  });
+
+  test('reads other escape sequences', () => {
+    expect(tokenize('\x1b7\x1b(B\x1bc')).toEqual([
+      { kind: 'esc', value: '\x1b7', params: '', final: '7' },
+      { kind: 'esc', value: '\x1b(B', params: '(', final: 'B' },
+      { kind: 'esc', value: '\x1bc', params: '', final: 'c' },
+    ]);
+  });
+
+  test('unterminated sequences run to the end', () => {
+    expect(tokenize('a\x1b[12')).toEqual([
+      { kind: 'text', value: 'a', params: '', final: '' },
+      { kind: 'csi', value: '\x1b[12', params: '12', final: '' },
+    ]);
+    expect(tokenize('\x1b]8;;url')[0]).toMatchObject({ kind: 'osc', value: '\x1b]8;;url' });
+    expect(tokenize('\x1b')).toEqual([{ kind: 'esc', value: '\x1b', params: '', final: '' }]);
+  });
+
+  test('handles empty and plain input', () => {
+    expect(tokenize('')).toEqual([]);
+    expect(tokenize('plain\ntext')).toEqual([
+      { kind: 'text', value: 'plain\ntext', params: '', final: '' },
+    ]);
+  });
+});
+
+describe('stripAnsi', () => {
+  test('removes escape sequences', () => {
+    expect(stripAnsi('\x1b[1mbold\x1b[0m \x1b]8;;url\x1b\\link\x1b]8;;\x1b\\')).toBe('bold link');
+    expect(stripAnsi('plain')).toBe('plain');
+  });
+});
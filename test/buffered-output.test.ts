@@ -0,0 +1,142 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  DefaultBufferThreshold,
+  newOutput,
+  withBuffering,
+  withInput,
+  withStatusReportTimeout,
+  withTTY,
+} from '#src/output.js';
+import { FakeTerminal } from '#test/utils/fake-tty.js';
+
+// Mock writer counting the calls it receives
+class MockWriter {
+  public output: string[] = [];
+  public isTTY = true;
+
+  write(data: Uint8Array | string, callback?: (err?: Error) => void): boolean {
+    const text = typeof data === 'string' ? data : new TextDecoder().decode(data);
+    this.output.push(text);
+    if (callback) {
+      process.nextTick(() => callback());
+    }
+    return true;
+  }
+}
+
+describe('buffered output', () => {
+  test('collects sequences until flush', async () => {
+    const writer = new MockWriter();
+    const output = newOutput(writer as any, withTTY(true), withBuffering());
+
+    output.clearScreen();
+    output.moveCursor(1, 1);
+    output.hideCursor();
+    await output.writeString('frame');
+    expect(writer.output).toEqual([]);
+
+    await output.flush();
+    expect(writer.output).toEqual(['\x1b[2J\x1b[1;1H\x1b[?25lframe']);
+
+    // nothing left to write
+    await output.flush();
+    expect(writer.output.length).toBe(1);
+  });
+
+  test('writeString reports the byte length', async () => {
+    const output = newOutput(new MockWriter() as any, withBuffering());
+    expect(await output.writeString('héllo')).toBe(6);
+  });
+
+  test('flushes at the threshold', () => {
+    const writer = new MockWriter();
+    const output = newOutput(writer as any, withBuffering({ threshold: 10 }));
+
+    output.writeString('12345');
+    expect(writer.output).toEqual([]);
+    output.writeString('67890');
+    expect(writer.output).toEqual(['1234567890']);
+  });
+
+  test('uses a default threshold', () => {
+    const writer = new MockWriter();
+    const output = newOutput(writer as any, withBuffering());
+
+    output.writeString('x'.repeat(DefaultBufferThreshold - 1));
+    expect(writer.output).toEqual([]);
+    output.writeString('x');
+    expect(writer.output.length).toBe(1);
+  });
+
+  test('auto flushes at the end of the microtask', async () => {
+    const writer = new MockWriter();
+    const output = newOutput(
+      writer as any,
+      withTTY(true),
+      withBuffering({ autoFlush: 'microtask' })
+    );
+
+    output.cursorUp(2);
+    output.clearLine();
+    output.writeString('line');
+    expect(writer.output).toEqual([]);
+
+    await Promise.resolve();
+    expect(writer.output).toEqual(['\x1b[2A\x1b[2Kline']);
+
+    output.showCursor();
+    await Promise.resolve();
+    expect(writer.output).toEqual(['\x1b[2A\x1b[2Kline', '\x1b[?25h']);
+  });
+
+  test('direct writes keep their order', async () => {
+    const writer = new MockWriter();
+    const output = newOutput(writer as any, withTTY(true), withBuffering());
+
+    output.writeString('\x1b[1m');
+    await output.write(new TextEncoder().encode('bold'));
+    output.writeString('\x1b[0m');
+    await output.flush();
+
+    expect(writer.output).toEqual(['\x1b[1mbold', '\x1b[0m']);
+  });
+
+  test('can be turned off again', async () => {
+    const writer = new MockWriter();
+    const output = newOutput(writer as any, withBuffering());
+    expect(output.buffered()).toBe(true);
+
+    output.writeString('pending');
+    output.setBuffering(null);
+    expect(output.buffered()).toBe(false);
+    expect(writer.output).toEqual(['pending']);
+
+    await output.writeString('direct');
+    expect(writer.output).toEqual(['pending', 'direct']);
+  });
+
+  test('terminal queries flush pending output', async () => {
+    const term = new FakeTerminal({ '\x1b[2J\x1b[6n': '\x1b[3;7R' });
+    const output = newOutput(
+      term as any,
+      withTTY(true),
+      withInput(term.input),
+      withStatusReportTimeout(50),
+      withBuffering()
+    );
+
+    output.clearScreen();
+    expect(await output.cursorPosition()).toEqual({ row: 3, column: 7 });
+    expect(term.output).toEqual(['\x1b[2J\x1b[6n']);
+  });
+
+  test('unbuffered output writes every call', () => {
+    const writer = new MockWriter();
+    const output = newOutput(writer as any, withTTY(true));
+
+    output.clearScreen();
+    output.moveCursor(1, 1);
+    expect(writer.output).toEqual(['\x1b[2J', '\x1b[1;1H']);
+    expect(output.buffered()).toBe(false);
+  });
+});
@@ -0,0 +1,62 @@
+import { afterEach, describe, expect, test } from 'bun:test';
+import {
+  clearConversionCache,
+  configureColorConversion,
+  conversionCacheStats,
+  DefaultConversionCacheSize,
+} from '#src/color-convert.js';
+import { newOutput, withProfile } from '#src/output.js';
+import { Profile } from '#src/types.js';
+
+// Timings depend on the machine, so the benchmark only runs with TERMENV_BENCH
+// set (bun run bench) and reports rather than asserts them
+const bench = test.skipIf(!process.env.TERMENV_BENCH);
+
+// A log-like workload: many lines in a few colors
+const palette = ['#ff5f5f', '#5fafff', '#87d75f', '#ffd75f', '#af87ff', '#d0d0d0', '#ff8700'];
+const lines = 2000;
+
+function render(profile: Profile): number {
+  const output = newOutput(process.stdout, withProfile(profile));
+  const start = performance.now();
+  for (let i = 0; i < lines; i++) {
+    const color = output.color(palette[i % palette.length] ?? '');
+    output.string(`line ${i}`).foreground(color).toString();
+  }
+  return performance.now() - start;
+}
+
+function benchmark(name: string, profile: Profile): void {
+  configureColorConversion({ cacheSize: 0, ansiTable: false });
+  render(profile); // warm up
+  const uncached = render(profile);
+  configureColorConversion({ cacheSize: DefaultConversionCacheSize, ansiTable: true });
+  clearConversionCache();
+  const cached = render(profile);
+
+  const rate = (ms: number) => Math.round((lines / ms) * 1000);
+  console.log(
+    `${name}: ${rate(uncached)} lines/s uncached, ${rate(cached)} lines/s cached ` +
+      `(${(uncached / cached).toFixed(1)}x)`
+  );
+  // each color is converted once, the other lines hit the cache
+  expect(conversionCacheStats()).toMatchObject({
+    hits: lines - palette.length,
+    misses: palette.length,
+  });
+}
+
+describe('color conversion benchmark', () => {
+  afterEach(() => {
+    configureColorConversion({ cacheSize: DefaultConversionCacheSize, ansiTable: false });
+    clearConversionCache();
+  });
+
+  bench('ANSI256 rendering', () => {
+    benchmark('ANSI256', Profile.ANSI256);
+  });
+
+  bench('ANSI rendering', () => {
+    benchmark('ANSI', Profile.ANSI);
+  });
+});
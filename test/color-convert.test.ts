@@ -0,0 +1,211 @@
+import { afterEach, describe, expect, test } from 'bun:test';
+import {
+  ansi256ToANSI,
+  ColorMetrics,
+  type ColorMetricName,
+  clearConversionCache,
+  configureColorConversion,
+  conversionCacheStats,
+  convertColor,
+  DefaultConversionCacheSize,
+  type RGBChannels,
+  rgbToANSI256,
+} from '#src/color-convert.js';
+import { newOutput, withColorMetric, withProfile } from '#src/output.js';
+import { Palette } from '#src/palette.js';
+import { ProfileUtils } from '#src/profile.js';
+import { ANSI256Color, ANSIColor, ansiHex, NoColor, Profile, RGBColor } from '#src/types.js';
+
+const hex2 = (n: number) => n.toString(16).padStart(2, '0');
+
+// Colors spanning the RGB cube, every 15th value of each channel
+function cube(): RGBColor[] {
+  const colors: RGBColor[] = [];
+  for (let r = 0; r <= 255; r += 15) {
+    for (let g = 0; g <= 255; g += 15) {
+      for (let b = 0; b <= 255; b += 15) {
+        colors.push(new RGBColor(`#${hex2(r)}${hex2(g)}${hex2(b)}`));
+      }
+    }
+  }
+  return colors;
+}
+
+const to256 = (hex: string) => convertColor(Profile.ANSI256, new RGBColor(hex));
+
+describe('convertColor', () => {
+  test('matches Go for reference colors', () => {
+    expect(to256('#ff0000')).toEqual(new ANSI256Color(196));
+    expect(to256('#000000')).toEqual(new ANSI256Color(16));
+    expect(to256('#ffffff')).toEqual(new ANSI256Color(231));
+    expect(to256('#5f87af')).toEqual(new ANSI256Color(67));
+    expect(convertColor(Profile.ANSI, new RGBColor('#ff0000'))).toEqual(new ANSIColor(9));
+    expect(convertColor(Profile.ANSI, new ANSI256Color(196))).toEqual(new ANSIColor(9));
+  });
+
+  test('uses the gray ramp like Go', () => {
+    // Go averages the cube indices in integer math, so 232 is the only gray
+    expect(to256('#080808')).toEqual(new ANSI256Color(232));
+    expect(to256('#303030')).toEqual(new ANSI256Color(232));
+    expect(to256('#767676')).toEqual(new ANSI256Color(102));
+    expect(to256('#808080')).toEqual(new ANSI256Color(102));
+    expect(to256('#eeeeee')).toEqual(new ANSI256Color(231));
+  });
+
+  test('keeps colors the profile supports', () => {
+    const rgb = new RGBColor('#123456');
+    expect(convertColor(Profile.TrueColor, rgb)).toBe(rgb);
+    expect(convertColor(Profile.ANSI256, new ANSIColor(3))).toEqual(new ANSIColor(3));
+    expect(convertColor(Profile.Ascii, rgb)).toBeInstanceOf(NoColor);
+  });
+
+  test('maps the first 16 ANSI256 colors to themselves', () => {
+    for (let i = 0; i < 16; i++) {
+      expect(ansi256ToANSI(new ANSI256Color(i))).toEqual(new ANSIColor(i));
+    }
+  });
+
+  test('ProfileUtils and Output agree over the RGB cube', () => {
+    const output256 = newOutput(process.stdout, withProfile(Profile.ANSI256));
+    const output16 = newOutput(process.stdout, withProfile(Profile.ANSI));
+    for (const c of cube()) {
+      expect(output256.color(c.hex)).toEqual(ProfileUtils.convert(Profile.ANSI256, c));
+      expect(output16.color(c.hex)).toEqual(ProfileUtils.convert(Profile.ANSI, c));
+    }
+  });
+});
+
+describe('color metrics', () => {
+  const names: ColorMetricName[] = ['hsluv', 'ciede2000', 'oklab', 'redmean'];
+  const black = { r: 0, g: 0, b: 0 };
+  const white = { r: 1, g: 1, b: 1 };
+
+  test('measure distances', () => {
+    expect(ColorMetrics.ciede2000(black, white)).toBeCloseTo(100, 1);
+    expect(ColorMetrics.oklab(black, white)).toBeCloseTo(1, 3);
+    expect(ColorMetrics.redmean(black, white)).toBeCloseTo(765, 0);
+    for (const name of names) {
+      expect(ColorMetrics[name](white, white)).toBeCloseTo(0, 6);
+      const red = { r: 1, g: 0, b: 0 };
+      const orange = { r: 1, g: 0.5, b: 0 };
+      expect(ColorMetrics[name](red, orange)).toBeCloseTo(ColorMetrics[name](orange, red), 9);
+    }
+  });
+
+  test('every metric keeps palette colors', () => {
+    for (const name of names) {
+      for (const i of [16, 67, 102, 196, 231, 232]) {
+        const c = new RGBColor(ansiHex[i] ?? '');
+        expect(convertColor(Profile.ANSI256, c, name)).toEqual(new ANSI256Color(i));
+      }
+      expect(convertColor(Profile.ANSI, new RGBColor('#ff0000'), name)).toEqual(new ANSIColor(9));
+    }
+  });
+
+  test('metrics can pick different colors', () => {
+    // #333333 is between #5f5f5f (59) and #080808 (232)
+    const picks = names.map((name) => rgbToANSI256({ r: 0.2, g: 0.2, b: 0.2 }, name).value);
+    expect(picks).toEqual([232, 232, 59, 232]);
+  });
+
+  test('accept distance functions', () => {
+    const same = () => 0;
+    expect(rgbToANSI256({ r: 0.5, g: 0.5, b: 0.5 }, same)).toEqual(new ANSI256Color(102));
+    expect(ansi256ToANSI(new ANSI256Color(196), same)).toEqual(new ANSIColor(0));
+  });
+
+  test('withColorMetric sets the metric of an output and its styles', () => {
+    const output = newOutput(process.stdout, withProfile(Profile.ANSI256));
+    const oklab = newOutput(process.stdout, withProfile(Profile.ANSI256), withColorMetric('oklab'));
+    expect(output.color('#333333')).toEqual(new ANSI256Color(232));
+    expect(oklab.color('#333333')).toEqual(new ANSI256Color(59));
+    expect(oklab.string('x').colorMetric).toBe('oklab');
+  });
+});
+
+describe('conversion cache', () => {
+  afterEach(() => {
+    configureColorConversion({ cacheSize: DefaultConversionCacheSize, ansiTable: false });
+    clearConversionCache();
+  });
+
+  test('caches downsampled colors', () => {
+    clearConversionCache();
+    const red = new RGBColor('#ff0000');
+    expect(convertColor(Profile.ANSI256, red)).toEqual(new ANSI256Color(196));
+    expect(convertColor(Profile.ANSI256, new RGBColor('#FF0000'))).toEqual(new ANSI256Color(196));
+    expect(convertColor(Profile.ANSI, red)).toEqual(new ANSIColor(9));
+    expect(convertColor(Profile.ANSI, red, 'oklab')).toEqual(new ANSIColor(9));
+    expect(conversionCacheStats()).toEqual({
+      size: 3,
+      maxSize: DefaultConversionCacheSize,
+      hits: 1,
+      misses: 3,
+    });
+  });
+
+  test('converts each color of a rendering workload once', () => {
+    clearConversionCache();
+    const colors = ['#ff5f5f', '#5fafff', '#87d75f', '#ffd75f', '#af87ff'];
+    const output = newOutput(process.stdout, withProfile(Profile.ANSI256));
+    for (let i = 0; i < 1000; i++) {
+      const color = output.color(colors[i % colors.length] ?? '');
+      output.string(`line ${i}`).foreground(color).toString();
+    }
+    expect(conversionCacheStats()).toMatchObject({ size: 5, hits: 995, misses: 5 });
+  });
+
+  test('returns new colors on hits', () => {
+    const first = convertColor(Profile.ANSI256, new RGBColor('#00ff00'));
+    const second = convertColor(Profile.ANSI256, new RGBColor('#00ff00'));
+    expect(second).toEqual(first);
+    expect(second).not.toBe(first);
+  });
+
+  test('drops the least recently used colors', () => {
+    configureColorConversion({ cacheSize: 2 });
+    clearConversionCache();
+    const convert = (hex: string) => convertColor(Profile.ANSI256, new RGBColor(hex));
+    convert('#000001');
+    convert('#000002');
+    convert('#000001');
+    convert('#000003'); // drops #000002
+    convert('#000001');
+    expect(conversionCacheStats()).toMatchObject({ size: 2, hits: 2, misses: 3 });
+    convert('#000002');
+    expect(conversionCacheStats()).toMatchObject({ size: 2, hits: 2, misses: 4 });
+  });
+
+  test('can be disabled', () => {
+    configureColorConversion({ cacheSize: 0 });
+    convertColor(Profile.ANSI256, new RGBColor('#123456'));
+    convertColor(Profile.ANSI256, new RGBColor('#123456'));
+    expect(conversionCacheStats()).toMatchObject({ size: 0, hits: 0, misses: 2 });
+  });
+
+  test('keeps distance functions apart', () => {
+    const toBlack = (_a: RGBChannels, b: RGBChannels) => b.r + b.g + b.b;
+    const toWhite = (a: RGBChannels, b: RGBChannels) => 3 - toBlack(a, b);
+    expect(convertColor(Profile.ANSI, new RGBColor('#808080'), toBlack)).toEqual(new ANSIColor(0));
+    expect(convertColor(Profile.ANSI, new RGBColor('#808080'), toWhite)).toEqual(
+      new ANSIColor(15)
+    );
+  });
+
+  test('ANSI table matches the computed conversion', () => {
+    const computed = Array.from({ length: 256 }, (_, i) => ansi256ToANSI(new ANSI256Color(i)));
+    configureColorConversion({ ansiTable: true });
+    const table = Array.from({ length: 256 }, (_, i) => ansi256ToANSI(new ANSI256Color(i)));
+    expect(table).toEqual(computed);
+    expect(ansi256ToANSI(new ANSI256Color(300))).toEqual(new ANSIColor(0));
+  });
+
+  test('ANSI tables are kept per palette', () => {
+    const palette = new Palette(['#000000', '#dc322f', '#859900', '#b58900', '#268bd2']);
+    const convert = (i: number) => ansi256ToANSI(new ANSI256Color(i), 'hsluv', palette);
+    const computed = Array.from({ length: 256 }, (_, i) => convert(i));
+    configureColorConversion({ ansiTable: true });
+    expect(Array.from({ length: 256 }, (_, i) => convert(i))).toEqual(computed);
+    expect(ansi256ToANSI(new ANSI256Color(33))).toEqual(new ANSIColor(12));
+  });
+});
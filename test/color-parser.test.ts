@@ -0,0 +1,168 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  colorFromString,
+  parseColor,
+  parseNamedColor,
+  validateColor,
+} from '#src/color-parser.js';
+import { newOutput, withProfile, withStrictColors } from '#src/output.js';
+import { ProfileUtils } from '#src/profile.js';
+import { Style } from '#src/style.js';
+import { ANSI256Color, ANSIColor, InvalidColorError, Profile, RGBColor } from '#src/types.js';
+
+const tomato = new RGBColor('#ff6347');
+
+describe('parseColor', () => {
+  test('parses ANSI indices', () => {
+    expect(parseColor('9')).toEqual(new ANSIColor(9));
+    expect(parseColor('208')).toEqual(new ANSI256Color(208));
+    expect(parseColor('256')).toBeNull();
+  });
+
+  test('parses hex colors', () => {
+    expect(parseColor('#ff6347')).toEqual(tomato);
+    expect(parseColor('#FF6347')).toEqual(tomato);
+    expect(parseColor('#f64')).toEqual(new RGBColor('#ff6644'));
+    expect(parseColor('#f648')).toEqual(new RGBColor('#ff6644'));
+    expect(parseColor('#ff634780')).toEqual(tomato);
+    expect(parseColor('#fff636474')).toEqual(tomato);
+    expect(parseColor('#ffff63634747')).toEqual(tomato);
+    expect(parseColor('#ff63')).toEqual(new RGBColor('#ffff66'));
+    expect(parseColor('#ff634')).toBeNull();
+    expect(parseColor('#gg0000')).toBeNull();
+  });
+
+  test('parses names', () => {
+    expect(parseColor('tomato')).toEqual(tomato);
+    expect(parseColor('Tomato')).toEqual(tomato);
+    expect(parseColor('rebeccapurple')).toEqual(new RGBColor('#663399'));
+    expect(parseColor('light goldenrod yellow')).toEqual(new RGBColor('#fafad2'));
+    expect(parseColor('DarkSeaGreen4')).toEqual(new RGBColor('#698b69'));
+    expect(parseColor('gray50')).toEqual(new RGBColor('#7f7f7f'));
+    expect(parseColor('notacolor')).toBeNull();
+    expect(parseColor('constructor')).toBeNull();
+  });
+
+  test('prefers CSS over X11 names', () => {
+    expect(parseNamedColor('green')).toEqual(new RGBColor('#008000'));
+    expect(parseNamedColor('gray')).toEqual(new RGBColor('#808080'));
+    expect(parseNamedColor('navy blue')).toEqual(new RGBColor('#000080'));
+  });
+
+  test('parses rgb()', () => {
+    expect(parseColor('rgb(255 99 71)')).toEqual(tomato);
+    expect(parseColor('rgb(255, 99, 71)')).toEqual(tomato);
+    expect(parseColor('rgba(255, 99, 71, 0.5)')).toEqual(tomato);
+    expect(parseColor('rgb(255 99 71 / 50%)')).toEqual(tomato);
+    expect(parseColor('rgb(100% 0% 50%)')).toEqual(new RGBColor('#ff0080'));
+    expect(parseColor('rgb(300 -5 none)')).toEqual(new RGBColor('#ff0000'));
+    expect(parseColor('rgb(255 99)')).toBeNull();
+    expect(parseColor('rgb(255 99 71 1)')).toBeNull();
+    expect(parseColor('rgb(1deg 0 0)')).toBeNull();
+  });
+
+  test('parses hsl() and hwb()', () => {
+    expect(parseColor('hsl(9 100% 64%)')).toEqual(tomato);
+    expect(parseColor('hsl(9deg, 100%, 64%)')).toEqual(tomato);
+    expect(parseColor('hsla(0.025turn 100% 64% / 0.2)')).toEqual(tomato);
+    expect(parseColor('hsl(120 100% 25%)')).toEqual(new RGBColor('#008000'));
+    expect(parseColor('hsl(-120 100% 50%)')).toEqual(new RGBColor('#0000ff'));
+    expect(parseColor('hwb(0 0% 0%)')).toEqual(new RGBColor('#ff0000'));
+    expect(parseColor('hwb(120 20% 30%)')).toEqual(new RGBColor('#33b333'));
+    expect(parseColor('hwb(0 60% 60%)')).toEqual(new RGBColor('#808080'));
+    expect(parseColor('hsl(9 100%)')).toBeNull();
+  });
+
+  test('parses X11 rgb: and rgbi:', () => {
+    expect(parseColor('rgb:ffff/6363/4747')).toEqual(tomato);
+    expect(parseColor('rgb:ff/63/47')).toEqual(tomato);
+    expect(parseColor('rgb:f/0/8')).toEqual(new RGBColor('#ff0088'));
+    expect(parseColor('rgbi:1/0.388/0.278')).toEqual(tomato);
+    expect(parseColor('rgb:fffff/0/0')).toBeNull();
+    expect(parseColor('rgbi:1.5/0/0')).toBeNull();
+  });
+});
+
+describe('color strings in the profile APIs', () => {
+  test('ProfileUtils.color converts parsed colors', () => {
+    expect(ProfileUtils.color(Profile.TrueColor, 'tomato')).toEqual(tomato);
+    expect(ProfileUtils.color(Profile.ANSI256, 'rgb(255 0 0)')).toEqual(new ANSI256Color(196));
+    expect(ProfileUtils.color(Profile.TrueColor, 'nope')).toBeNull();
+    expect(ProfileUtils.color(Profile.TrueColor, '')).toBeNull();
+  });
+
+  test('OutputImpl.color converts parsed colors', () => {
+    const output = newOutput(process.stdout, withProfile(Profile.TrueColor));
+    expect(output.color('hsl(9 100% 64%)')).toEqual(tomato);
+    expect(output.color('rgb:ffff/6363/4747')?.sequence(false)).toBe('38;2;255;99;71');
+  });
+
+  test('hex and index strings keep the Go behavior', () => {
+    expect(colorFromString('#FF0000')).toEqual(new RGBColor('#FF0000'));
+    expect(colorFromString('#zzz')).toEqual(new RGBColor('#zzz'));
+    expect(colorFromString('300')).toEqual(new ANSI256Color(300));
+  });
+
+  test('long hex strings are read like Go, not the X11 way', () => {
+    const output = newOutput(process.stdout, withProfile(Profile.ANSI256));
+    expect(colorFromString('#ffff00000000')).toEqual(new RGBColor('#ffff00000000'));
+    // Go reads #ffff00, where X11 would read #ff0000 (196)
+    expect(output.color('#ffff00000000')).toEqual(new ANSI256Color(226));
+    expect(ProfileUtils.color(Profile.ANSI256, '#ffff00000000')).toEqual(new ANSI256Color(226));
+    expect(parseColor('#ffff00000000')).toEqual(new RGBColor('#ff0000'));
+  });
+});
+
+describe('strict colors', () => {
+  const strict = (s: string) => () => parseColor(s, { strict: true });
+
+  test('parseColor explains what is wrong', () => {
+    expect(strict('#GGGGGG')).toThrow(InvalidColorError);
+    expect(strict('#GGGGGG')).toThrow('invalid color "#GGGGGG": "G" is not a hex digit');
+    expect(strict('#12345')).toThrow('hex colors have 3, 4, 6, 8, 9 or 12 digits, not 5');
+    expect(strict('300')).toThrow('color index 300 is out of range 0-255');
+    expect(strict('tomatoe')).toThrow('invalid color "tomatoe": unknown color name');
+    expect(strict('')).toThrow('empty color string');
+    expect(strict('rgb(1 2)')).toThrow('rgb() takes 3 values and an optional alpha');
+    expect(strict('hsl(9 1deg 50%)')).toThrow('invalid hsl() value "1deg"');
+    expect(strict('lab(50 0 0)')).toThrow('unknown color function lab()');
+    expect(strict('rgb:fffff/0/0')).toThrow('rgb: takes 3 channels of 1 to 4 hex digits');
+    expect(strict('rgbi:2/0/0')).toThrow('rgbi: takes 3 intensities between 0 and 1');
+    expect(strict('cmyk:0/0/0/0')).toThrow('unknown color space cmyk:');
+    expect(parseColor('tomato', { strict: true })).toEqual(tomato);
+  });
+
+  test('validateColor rejects colors that render nothing', () => {
+    expect(() => validateColor(new RGBColor('#GGGGGG'))).toThrow('"G" is not a hex digit');
+    expect(() => validateColor(new RGBColor('#1234567'))).toThrow('3 or 6 hex digits, not 7');
+    expect(() => validateColor(new RGBColor('red'))).toThrow('RGB colors are hex colors');
+    expect(() => validateColor(new ANSIColor(16))).toThrow(
+      'invalid color 16: ANSI colors are 0-15'
+    );
+    expect(() => validateColor(new ANSI256Color(-1))).toThrow('ANSI256 colors are 0-255');
+    expect(() => validateColor(new RGBColor('#f00'))).not.toThrow();
+  });
+
+  test('withStrictColors validates colors', () => {
+    const output = newOutput(process.stdout, withProfile(Profile.TrueColor), withStrictColors());
+    expect(() => output.color('#GGGGGG')).toThrow(InvalidColorError);
+    expect(() => output.color('')).toThrow(InvalidColorError);
+    expect(output.color('tomato')).toEqual(tomato);
+    expect(() => output.string('x').foreground(new RGBColor('#GGGGGG'))).toThrow(
+      InvalidColorError
+    );
+    expect(() => output.string('x').background(new ANSI256Color(256))).toThrow(
+      InvalidColorError
+    );
+    expect(output.string('x').foreground(new RGBColor('#f00')).toString()).toBe(
+      '\x1b[38;2;255;0;0mx\x1b[0m'
+    );
+  });
+
+  test('lenient parsing stays the default', () => {
+    const output = newOutput(process.stdout, withProfile(Profile.TrueColor));
+    expect(output.color('tomatoe')).toBeNull();
+    const styled = new Style(Profile.TrueColor, 'x').bold().foreground(new RGBColor('#GGGGGG'));
+    expect(styled.toString()).toBe('\x1b[1;mx\x1b[0m');
+  });
+});
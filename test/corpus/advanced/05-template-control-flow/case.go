@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/muesli/termenv"
+)
+
+const report = `{{- /* a build report */ -}}
+{{ Bold .Title }}
+{{ range $i, $step := .Steps -}}
+{{ printf "%2d" $i }}. {{ if eq $step.Status "ok" }}{{ Foreground "#00ff00" "ok" }}{{ else if eq $step.Status "skip" }}{{ Faint "skip" }}{{ else }}{{ Color "#ffffff" "#ff0000" "FAIL" }}{{ end }} {{ $step.Name }}
+{{ end -}}
+{{ with .Summary }}{{ Italic . }}{{ else }}no summary{{ end }}
+{{ range $k, $v := .Counts }}{{ $k }}={{ $v }} {{ end }}
+{{ $total := 0 }}{{ range .Steps }}{{ $total = len .Name }}{{ end }}last name length: {{ $total }}
+{{ if and .Steps (not .Summary) }}unreachable{{ else }}{{ "x" | Underline | Bold }}{{ end }}
+{{ printf "%q %v %t %-6s|" .Title .Counts true "pad" }}
+{{ index .Counts "ok" }} {{ len .Steps }} {{ html "<b>" }} {{ urlquery "a b" }}`
+
+func main() {
+	fmt.Println("--- Template Control Flow Test ---")
+
+	funcs := termenv.TemplateFuncs(termenv.TrueColor)
+	tpl := template.Must(template.New("report").Funcs(funcs).Parse(report))
+
+	data := map[string]interface{}{
+		"Title": "Build",
+		"Steps": []map[string]interface{}{
+			{"Name": "compile", "Status": "ok"},
+			{"Name": "lint", "Status": "skip"},
+			{"Name": "test", "Status": "failed"},
+		},
+		"Summary": "2 of 3 passed",
+		"Counts":  map[string]int{"ok": 1, "skip": 1, "fail": 1},
+	}
+
+	var buf strings.Builder
+	if err := tpl.Execute(&buf, data); err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(buf.String())
+}
@@ -0,0 +1,35 @@
+import { newTemplate, Profile, templateFuncs } from '../../../../src/index.js';
+
+const report = `{{- /* a build report */ -}}
+{{ Bold .Title }}
+{{ range $i, $step := .Steps -}}
+{{ printf "%2d" $i }}. {{ if eq $step.Status "ok" }}{{ Foreground "#00ff00" "ok" }}{{ else if eq $step.Status "skip" }}{{ Faint "skip" }}{{ else }}{{ Color "#ffffff" "#ff0000" "FAIL" }}{{ end }} {{ $step.Name }}
+{{ end -}}
+{{ with .Summary }}{{ Italic . }}{{ else }}no summary{{ end }}
+{{ range $k, $v := .Counts }}{{ $k }}={{ $v }} {{ end }}
+{{ $total := 0 }}{{ range .Steps }}{{ $total = len .Name }}{{ end }}last name length: {{ $total }}
+{{ if and .Steps (not .Summary) }}unreachable{{ else }}{{ "x" | Underline | Bold }}{{ end }}
+{{ printf "%q %v %t %-6s|" .Title .Counts true "pad" }}
+{{ index .Counts "ok" }} {{ len .Steps }} {{ html "<b>" }} {{ urlquery "a b" }}`;
+
+console.log('--- Template Control Flow Test ---');
+
+const funcs = templateFuncs(Profile.TrueColor);
+const tpl = newTemplate('report').funcs(funcs).parse(report);
+
+const data = {
+  Title: 'Build',
+  Steps: [
+    { Name: 'compile', Status: 'ok' },
+    { Name: 'lint', Status: 'skip' },
+    { Name: 'test', Status: 'failed' },
+  ],
+  Summary: '2 of 3 passed',
+  Counts: { ok: 1, skip: 1, fail: 1 },
+};
+
+try {
+  console.log(tpl.execute(data));
+} catch (err) {
+  console.log('error:', (err as Error).message);
+}
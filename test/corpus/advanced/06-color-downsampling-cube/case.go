@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/muesli/termenv"
+)
+
+// Prints counts 16 to a line
+func printCounts(name string, counts []int) {
+	for i := 0; i < len(counts); i += 16 {
+		line := make([]string, 0, 16)
+		for _, n := range counts[i:min(i+16, len(counts))] {
+			line = append(line, fmt.Sprint(n))
+		}
+		fmt.Printf("%s %d-%d: %s\n", name, i, min(i+16, len(counts))-1, strings.Join(line, " "))
+	}
+}
+
+func main() {
+	fmt.Println("--- Color Downsampling Cube Test ---")
+
+	// Every 5th value of each channel: 52^3 colors spanning the RGB cube
+	ansi256 := make([]int, 256)
+	ansi := make([]int, 16)
+	for r := 0; r <= 255; r += 5 {
+		for g := 0; g <= 255; g += 5 {
+			for b := 0; b <= 255; b += 5 {
+				c := termenv.RGBColor(fmt.Sprintf("#%02x%02x%02x", r, g, b))
+				ansi256[termenv.ANSI256.Convert(c).(termenv.ANSI256Color)]++
+				ansi[termenv.ANSI.Convert(c).(termenv.ANSIColor)]++
+			}
+		}
+	}
+	printCounts("ANSI256", ansi256)
+	printCounts("ANSI", ansi)
+
+	// The ANSI color of every ANSI256 color
+	table := make([]int, 256)
+	for i := range table {
+		table[i] = int(termenv.ANSI.Convert(termenv.ANSI256Color(i)).(termenv.ANSIColor))
+	}
+	printCounts("ANSI of ANSI256", table)
+
+	// Grays go through the same integer math as Go's gray ramp index
+	for _, hex := range []string{"#080808", "#303030", "#767676", "#808080", "#b2b2b2", "#eeeeee"} {
+		fmt.Printf("%s -> ANSI256 %d\n", hex, termenv.ANSI256.Convert(termenv.RGBColor(hex)))
+	}
+}
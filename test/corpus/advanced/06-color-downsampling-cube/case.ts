@@ -0,0 +1,49 @@
+import {
+  ANSI256Color,
+  type ANSIColor,
+  Profile,
+  ProfileUtils,
+  RGBColor,
+} from '../../../../src/index.js';
+
+// Prints counts 16 to a line
+function printCounts(name: string, counts: number[]): void {
+  for (let i = 0; i < counts.length; i += 16) {
+    const end = Math.min(i + 16, counts.length);
+    console.log(`${name} ${i}-${end - 1}: ${counts.slice(i, end).join(' ')}`);
+  }
+}
+
+const hex2 = (n: number) => n.toString(16).padStart(2, '0');
+
+console.log('--- Color Downsampling Cube Test ---');
+
+// Every 5th value of each channel: 52^3 colors spanning the RGB cube
+const ansi256 = new Array<number>(256).fill(0);
+const ansi = new Array<number>(16).fill(0);
+for (let r = 0; r <= 255; r += 5) {
+  for (let g = 0; g <= 255; g += 5) {
+    for (let b = 0; b <= 255; b += 5) {
+      const c = new RGBColor(`#${hex2(r)}${hex2(g)}${hex2(b)}`);
+      const c256 = ProfileUtils.convert(Profile.ANSI256, c) as ANSI256Color;
+      const c16 = ProfileUtils.convert(Profile.ANSI, c) as ANSIColor;
+      ansi256[c256.value] = (ansi256[c256.value] ?? 0) + 1;
+      ansi[c16.value] = (ansi[c16.value] ?? 0) + 1;
+    }
+  }
+}
+printCounts('ANSI256', ansi256);
+printCounts('ANSI', ansi);
+
+// The ANSI color of every ANSI256 color
+const table = Array.from(
+  { length: 256 },
+  (_, i) => (ProfileUtils.convert(Profile.ANSI, new ANSI256Color(i)) as ANSIColor).value
+);
+printCounts('ANSI of ANSI256', table);
+
+// Grays go through the same integer math as Go's gray ramp index
+for (const hex of ['#080808', '#303030', '#767676', '#808080', '#b2b2b2', '#eeeeee']) {
+  const c = ProfileUtils.convert(Profile.ANSI256, new RGBColor(hex)) as ANSI256Color;
+  console.log(`${hex} -> ANSI256 ${c.value}`);
+}
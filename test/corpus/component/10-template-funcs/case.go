@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/muesli/termenv"
+)
+
+func render(p termenv.Profile, text string) string {
+	tpl := template.Must(template.New("case").Funcs(termenv.TemplateFuncs(p)).Parse(text))
+	var buf strings.Builder
+	if err := tpl.Execute(&buf, nil); err != nil {
+		return "error: " + err.Error()
+	}
+	return buf.String()
+}
+
+func main() {
+	fmt.Println("--- Template Funcs Test ---")
+
+	// Colors take their arguments before the text
+	fmt.Printf("Color fg+bg: %s\n", render(termenv.TrueColor, `{{ Color "#ff0000" "#0000ff" "text" }}`))
+	fmt.Printf("Color fg only: %s\n", render(termenv.TrueColor, `{{ Color "#ff0000" "" "text" }}`))
+	fmt.Printf("Color text only: %s\n", render(termenv.TrueColor, `{{ Color "text" }}`))
+	fmt.Printf("Foreground: %s\n", render(termenv.TrueColor, `{{ Foreground "#00ff00" "green" }}`))
+	fmt.Printf("Background: %s\n", render(termenv.TrueColor, `{{ Background "4" "blue bg" }}`))
+
+	// Every style function
+	for _, name := range []string{"Bold", "Faint", "Italic", "Underline", "Overline", "Blink", "Reverse", "CrossOut"} {
+		fmt.Printf("%s: %s\n", name, render(termenv.TrueColor, `{{ `+name+` "styled" }}`))
+	}
+
+	// Pipelines nest styles
+	fmt.Printf("Pipeline: %s\n", render(termenv.TrueColor, `{{ "x" | Bold | Italic }}`))
+
+	// Colors are converted for the profile
+	fmt.Printf("ANSI256: %s\n", render(termenv.ANSI256, `{{ Color "#ff0000" "#0000ff" "text" }}`))
+	fmt.Printf("ANSI: %s\n", render(termenv.ANSI, `{{ Foreground "#ff0000" "text" }}`))
+
+	// Ascii returns the text unchanged
+	fmt.Printf("Ascii color: %s\n", render(termenv.Ascii, `{{ Color "#ff0000" "#0000ff" "plain" }}`))
+	fmt.Printf("Ascii bold: %s\n", render(termenv.Ascii, `{{ Bold "plain" }}`))
+}
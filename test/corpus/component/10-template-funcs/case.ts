@@ -0,0 +1,44 @@
+import { newTemplate, Profile, templateFuncs } from '../../../../src/index.js';
+
+function render(p: Profile, text: string): string {
+  const tpl = newTemplate('case').funcs(templateFuncs(p)).parse(text);
+  try {
+    return tpl.execute(null);
+  } catch (err) {
+    return `error: ${(err as Error).message}`;
+  }
+}
+
+console.log('--- Template Funcs Test ---');
+
+// Colors take their arguments before the text
+console.log(`Color fg+bg: ${render(Profile.TrueColor, '{{ Color "#ff0000" "#0000ff" "text" }}')}`);
+console.log(`Color fg only: ${render(Profile.TrueColor, '{{ Color "#ff0000" "" "text" }}')}`);
+console.log(`Color text only: ${render(Profile.TrueColor, '{{ Color "text" }}')}`);
+console.log(`Foreground: ${render(Profile.TrueColor, '{{ Foreground "#00ff00" "green" }}')}`);
+console.log(`Background: ${render(Profile.TrueColor, '{{ Background "4" "blue bg" }}')}`);
+
+// Every style function
+for (const name of [
+  'Bold',
+  'Faint',
+  'Italic',
+  'Underline',
+  'Overline',
+  'Blink',
+  'Reverse',
+  'CrossOut',
+]) {
+  console.log(`${name}: ${render(Profile.TrueColor, `{{ ${name} "styled" }}`)}`);
+}
+
+// Pipelines nest styles
+console.log(`Pipeline: ${render(Profile.TrueColor, '{{ "x" | Bold | Italic }}')}`);
+
+// Colors are converted for the profile
+console.log(`ANSI256: ${render(Profile.ANSI256, '{{ Color "#ff0000" "#0000ff" "text" }}')}`);
+console.log(`ANSI: ${render(Profile.ANSI, '{{ Foreground "#ff0000" "text" }}')}`);
+
+// Ascii returns the text unchanged
+console.log(`Ascii color: ${render(Profile.Ascii, '{{ Color "#ff0000" "#0000ff" "plain" }}')}`);
+console.log(`Ascii bold: ${render(Profile.Ascii, '{{ Bold "plain" }}')}`);
@@ -0,0 +1,98 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  newOutput,
+  parseCursorPosition,
+  withEnvironment,
+  withInput,
+  withStatusReportTimeout,
+  withTTY,
+} from '#src/output.js';
+import { StatusReportError } from '#src/types.js';
+import { FakeTerminal } from '#test/utils/fake-tty.js';
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+const DSR = '\x1b[6n';
+
+function newTerminalOutput(term: FakeTerminal) {
+  return newOutput(
+    term as any,
+    withTTY(true),
+    withInput(term.input),
+    withEnvironment(new MockEnviron({ TERM: 'xterm-256color' })),
+    withStatusReportTimeout(50)
+  );
+}
+
+describe('parseCursorPosition', () => {
+  test('parses CSI row;col R', () => {
+    expect(parseCursorPosition('\x1b[12;40R')).toEqual({ row: 12, column: 40 });
+    expect(parseCursorPosition('\x1b[1;1R')).toEqual({ row: 1, column: 1 });
+  });
+
+  test('rejects other sequences', () => {
+    expect(parseCursorPosition('\x1b[A')).toBeNull();
+    expect(parseCursorPosition('\x1b[12R')).toBeNull();
+    expect(parseCursorPosition('\x1b[1;2;3R')).toBeNull();
+    expect(parseCursorPosition('\x1b[?1;2R')).toBeNull();
+    expect(parseCursorPosition('12;40R')).toBeNull();
+  });
+});
+
+describe('cursorPosition', () => {
+  test('sends DSR 6n and parses the report', async () => {
+    const term = new FakeTerminal({ [DSR]: '\x1b[7;23R' });
+    const output = newTerminalOutput(term);
+
+    expect(await output.cursorPosition()).toEqual({ row: 7, column: 23 });
+    expect(term.output).toEqual([DSR]);
+    expect(term.input.rawModes).toEqual([true, false]);
+  });
+
+  test('hands interleaved keystrokes back to the input', async () => {
+    const term = new FakeTerminal({ [DSR]: '\x1b[3;1R' });
+    const output = newTerminalOutput(term);
+
+    const pending = output.cursorPosition();
+    term.type('ab\x1b[Ac');
+
+    expect(await pending).toEqual({ row: 3, column: 1 });
+    expect(term.input.read()?.toString()).toBe('ab\x1b[Ac');
+  });
+
+  test('keeps keystrokes typed after the report', async () => {
+    const term = new FakeTerminal({ [DSR]: '\x1b[3;1Rq' });
+    const output = newTerminalOutput(term);
+
+    expect(await output.cursorPosition()).toEqual({ row: 3, column: 1 });
+    expect(term.input.read()?.toString()).toBe('q');
+  });
+
+  test('times out cleanly', async () => {
+    const term = new FakeTerminal();
+    const output = newTerminalOutput(term);
+
+    await expect(output.cursorPosition()).rejects.toThrow(StatusReportError);
+    expect(term.input.isRaw).toBe(false);
+  });
+
+  test('requires a terminal', async () => {
+    const term = new FakeTerminal({ [DSR]: '\x1b[3;1R' });
+    const output = newOutput(term as any, withInput(term.input), withTTY(false));
+    term.isTTY = false;
+
+    await expect(output.cursorPosition()).rejects.toThrow(StatusReportError);
+    expect(term.output).toEqual([]);
+  });
+});
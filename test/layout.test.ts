@@ -0,0 +1,210 @@
+import { describe, expect, test } from 'bun:test';
+import { stripAnsi } from '#src/ansi.js';
+import {
+  align,
+  center,
+  displayWidth,
+  fitColumns,
+  hardWrap,
+  padEnd,
+  padStart,
+  truncate,
+  wordWrap,
+} from '#src/layout.js';
+import { Style } from '#src/style.js';
+import { ANSIColor, Profile } from '#src/types.js';
+
+const bold = (text: string) => new Style(Profile.ANSI, text).bold().toString();
+const red = (text: string) => new Style(Profile.ANSI, text).foreground(new ANSIColor(1));
+
+describe('displayWidth', () => {
+  test('ignores escape sequences', () => {
+    expect(displayWidth(bold('hello'))).toBe(5);
+    expect(displayWidth('\x1b]8;;https://example.com\x1b\\docs\x1b]8;;\x1b\\')).toBe(4);
+  });
+
+  test('counts wide characters and grapheme clusters', () => {
+    expect(displayWidth('日本')).toBe(4);
+    expect(displayWidth('é')).toBe(1);
+    expect(displayWidth('👨‍👩‍👧')).toBe(2);
+  });
+});
+
+describe('truncate', () => {
+  test('leaves strings that fit unchanged', () => {
+    const s = bold('hello');
+    expect(truncate(s, 5)).toBe(s);
+    expect(truncate('hello', 10)).toBe('hello');
+  });
+
+  test('cuts plain text with a tail', () => {
+    expect(truncate('hello world', 8)).toBe('hello w…');
+    expect(truncate('hello world', 8, { tail: '...' })).toBe('hello...');
+    expect(truncate('hello world', 5, { tail: '' })).toBe('hello');
+  });
+
+  test('closes SGR attributes open at the cut', () => {
+    expect(truncate(bold('hello world'), 6)).toBe('\x1b[1mhello…\x1b[22m');
+    const line = `${red('error:').bold()} ${bold('disk full')}`;
+    expect(truncate(line, 10)).toBe('\x1b[31;1merror:\x1b[0m \x1b[1mdi…\x1b[22m');
+  });
+
+  test('adds nothing when no attribute is open', () => {
+    expect(truncate(`${bold('ab')}cdef`, 4)).toBe('\x1b[1mab\x1b[0mc…');
+  });
+
+  test('closes hyperlinks open at the cut', () => {
+    const link = '\x1b]8;;https://example.com\x1b\\documentation\x1b]8;;\x1b\\';
+    expect(truncate(link, 5)).toBe('\x1b]8;;https://example.com\x1b\\docu…\x1b]8;;\x1b\\');
+    expect(truncate(`${link} page`, 15)).toBe(`${link} …`);
+  });
+
+  test('never splits wide characters or clusters', () => {
+    expect(truncate('日本語', 4)).toBe('日…');
+    expect(truncate('日本語', 3, { tail: '' })).toBe('日');
+    expect(truncate('aéé', 2, { tail: '' })).toBe('aé');
+    expect(truncate('👨‍👩‍👧👨‍👩‍👧', 3)).toBe('👨‍👩‍👧…');
+  });
+
+  test('cuts the tail when it is too wide', () => {
+    expect(truncate('hello', 2, { tail: '...' })).toBe('..');
+    expect(truncate('hello', 0)).toBe('');
+  });
+
+  test('treats negative widths as 0', () => {
+    expect(truncate('hello', -1)).toBe('');
+    expect(truncate('hello', -3, { tail: '' })).toBe('');
+    expect(truncate('\x1b[1m\x1b[22m', -1)).toBe('\x1b[1m\x1b[22m');
+  });
+});
+
+describe('padding', () => {
+  test('pads by display width', () => {
+    expect(padEnd(bold('ab'), 4)).toBe(`${bold('ab')}  `);
+    expect(padStart('日', 4)).toBe('  日');
+    expect(padEnd('abc', 2)).toBe('abc');
+  });
+
+  test('pads with a fill', () => {
+    expect(padEnd('a', 4, '.')).toBe('a...');
+    expect(padStart('a', 4, '-=')).toBe('-=-a');
+    // a wide fill that doesn't fit leaves a space
+    expect(padEnd('a', 4, '日')).toBe('a日 ');
+  });
+
+  test('centers', () => {
+    expect(center('ab', 6)).toBe('  ab  ');
+    expect(center('ab', 5)).toBe(' ab  ');
+    expect(center(bold('x'), 3, '*')).toBe(`*${bold('x')}*`);
+  });
+
+  test('aligns', () => {
+    expect(align('a', 3)).toBe('a  ');
+    expect(align('a', 3, 'right')).toBe('  a');
+    expect(align('a', 3, 'center')).toBe(' a ');
+  });
+});
+
+describe('fitColumns', () => {
+  test('truncates and pads each cell', () => {
+    expect(fitColumns(['name', 'a long description', '42'], [6, 10, 4])).toBe(
+      'name   a long de… 42  '
+    );
+  });
+
+  test('aligns columns and keeps styles', () => {
+    const row = fitColumns([bold('id'), red('failed').toString(), '7'], [4, 4, 3], {
+      separator: ' | ',
+      align: ['left', 'left', 'right'],
+      tail: '.',
+    });
+    expect(row).toBe(`${bold('id')}   | \x1b[31mfai.\x1b[39m |   7`);
+    expect(stripAnsi(row)).toBe('id   | fai. |   7');
+  });
+
+  test('fills missing cells', () => {
+    expect(fitColumns(['a'], [2, 2])).toBe('a    ');
+  });
+
+  test('collapses columns with negative widths', () => {
+    expect(fitColumns(['a', 'long', 'b'], [1, -2, 1])).toBe('a  b');
+  });
+});
+
+describe('wordWrap', () => {
+  test('breaks between words', () => {
+    expect(wordWrap('the quick brown fox jumps over the lazy dog', 10)).toBe(
+      'the quick\nbrown fox\njumps over\nthe lazy\ndog'
+    );
+    expect(wordWrap('a   b', 1)).toBe('a\nb');
+  });
+
+  test('breaks words longer than a line', () => {
+    expect(wordWrap('supercalifragilistic is long', 8)).toBe('supercal\nifragili\nstic is\nlong');
+    expect(wordWrap('日本語テキスト', 5)).toBe('日本\n語テ\nキス\nト');
+  });
+
+  test('measures display width', () => {
+    const text = `${bold('bold')} words ${bold('here')}`;
+    expect(stripAnsi(wordWrap(text, 10))).toBe('bold words\nhere');
+  });
+
+  test('carries styles across line breaks', () => {
+    expect(wordWrap('\x1b[1mthe quick brown\x1b[0m fox', 10)).toBe(
+      '\x1b[1mthe quick\x1b[22m\n\x1b[1mbrown\x1b[0m fox'
+    );
+    expect(wordWrap(red('red words').toString(), 5)).toBe(
+      '\x1b[31mred\x1b[39m\n\x1b[31mwords\x1b[0m'
+    );
+  });
+
+  test('carries hyperlinks across line breaks', () => {
+    const open = '\x1b]8;;https://x\x1b\\';
+    const close = '\x1b]8;;\x1b\\';
+    expect(wordWrap(`see ${open}the docs${close}`, 7)).toBe(
+      `see ${open}the${close}\n${open}docs${close}`
+    );
+  });
+
+  test('indents', () => {
+    const usage = 'usage: cmd [options] files and more words';
+    expect(wordWrap(usage, 20, { indent: '  ', hangingIndent: '      ' })).toBe(
+      '  usage: cmd\n      [options]\n      files and more\n      words'
+    );
+    expect(wordWrap('a b c', 3, { indent: '> ' })).toBe('> a\n> b\n> c');
+  });
+
+  test('indents go outside styles', () => {
+    expect(wordWrap(bold('aa bb'), 4, { indent: '- ' })).toBe(
+      '- \x1b[1maa\x1b[22m\n- \x1b[1mbb\x1b[0m'
+    );
+  });
+
+  test('preserves newlines', () => {
+    expect(wordWrap('one\ntwo three four\n\nfive', 9)).toBe('one\ntwo three\nfour\n\nfive');
+    expect(wordWrap('one\ntwo three', 20, { preserveNewlines: false })).toBe('one two three');
+  });
+
+  test('keeps short text unchanged', () => {
+    expect(wordWrap('short   ', 20)).toBe('short   ');
+    expect(wordWrap('', 5)).toBe('');
+  });
+});
+
+describe('hardWrap', () => {
+  test('breaks at the width', () => {
+    expect(hardWrap('abcdefghij', 4)).toBe('abcd\nefgh\nij');
+    expect(hardWrap('ab cd ef', 3)).toBe('ab \ncd \nef');
+  });
+
+  test('carries styles and never splits wide characters', () => {
+    expect(hardWrap(red('abcdefghij').toString(), 4)).toBe(
+      '\x1b[31mabcd\x1b[39m\n\x1b[31mefgh\x1b[39m\n\x1b[31mij\x1b[0m'
+    );
+    expect(hardWrap('a日本', 2)).toBe('a\n日\n本');
+  });
+
+  test('uses a hanging indent', () => {
+    expect(hardWrap('abcdef', 4, { hangingIndent: '  ' })).toBe('abcd\n  ef');
+  });
+});
@@ -0,0 +1,232 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  escapeMarkup,
+  markupTag,
+  parseMarkup,
+  parseMarkupColor,
+  parseTag,
+  renderMarkup,
+} from '#src/markup.js';
+import {
+  newOutput,
+  withEnvironment,
+  withHyperlinks,
+  withLinkFallback,
+  withProfile,
+  withTTY,
+} from '#src/output.js';
+import { newMemoryOutput } from '#src/recording.js';
+import {
+  ANSI256Color,
+  ANSIColor,
+  MarkupError,
+  Profile,
+  RGBColor,
+  TermEnvError,
+} from '#src/types.js';
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+describe('markup parsing', () => {
+  test('parses colors', () => {
+    expect(parseMarkupColor('red')).toEqual(new ANSIColor(1));
+    expect(parseMarkupColor('bright-blue')).toEqual(new ANSIColor(12));
+    expect(parseMarkupColor('bright_white')).toEqual(new ANSIColor(15));
+    expect(parseMarkupColor('grey')).toEqual(new ANSIColor(8));
+    expect(parseMarkupColor('#F80')).toEqual(new RGBColor('#ff8800'));
+    expect(parseMarkupColor('#123abc')).toEqual(new RGBColor('#123abc'));
+    expect(parseMarkupColor('color(9)')).toEqual(new ANSIColor(9));
+    expect(parseMarkupColor('color(208)')).toEqual(new ANSI256Color(208));
+    expect(parseMarkupColor('color(256)')).toBeNull();
+    expect(parseMarkupColor('#12')).toBeNull();
+    expect(parseMarkupColor('reddish')).toBeNull();
+    expect(parseMarkupColor('tomato')).toEqual(new RGBColor('#ff6347'));
+    expect(parseMarkupColor('rgb(255,0,0)')).toEqual(new RGBColor('#ff0000'));
+    expect(parseMarkupColor('208')).toEqual(new ANSI256Color(208));
+  });
+
+  test('parses tags', () => {
+    expect(parseTag('bold red on #000')).toEqual({
+      bold: true,
+      foreground: new ANSIColor(1),
+      background: new RGBColor('#000000'),
+    });
+    expect(parseTag('dim strike not italic')).toEqual({
+      faint: true,
+      crossOut: true,
+      italic: false,
+    });
+    expect(parseTag('underline=curly underline-color=red')).toEqual({
+      underline: 'curly',
+      underlineColor: new ANSIColor(1),
+    });
+    expect(parseTag('link=https://example.com/?a=b')).toEqual({
+      link: { url: 'https://example.com/?a=b' },
+    });
+  });
+
+  test('rejects unknown styles', () => {
+    expect(() => parseTag('bold sparkly')).toThrow(MarkupError);
+    expect(() => parseTag('on')).toThrow(MarkupError);
+    expect(() => parseTag('underline=wavy')).toThrow(MarkupError);
+    expect(() => parseTag('not red')).toThrow(MarkupError);
+    expect(() => renderMarkup('a [sparkly]b', Profile.ANSI)).toThrow(TermEnvError);
+  });
+
+  test('builds a tree', () => {
+    expect(parseMarkup('a[bold]b[red]c[/red]d[/]e')).toEqual([
+      { kind: 'text', text: 'a' },
+      {
+        kind: 'element',
+        tag: 'bold',
+        attributes: { bold: true },
+        children: [
+          { kind: 'text', text: 'b' },
+          {
+            kind: 'element',
+            tag: 'red',
+            attributes: { foreground: new ANSIColor(1) },
+            children: [{ kind: 'text', text: 'c' }],
+          },
+          { kind: 'text', text: 'd' },
+        ],
+      },
+      { kind: 'text', text: 'e' },
+    ]);
+  });
+
+  test('closing tags name any word of the tag', () => {
+    const nodes = parseMarkup('[bold red]a[italic]b[/red]c');
+    expect(nodes).toHaveLength(2);
+    expect(nodes[1]).toEqual({ kind: 'text', text: 'c' });
+  });
+
+  test('rejects unmatched closing tags', () => {
+    expect(() => parseMarkup('a[/]')).toThrow(MarkupError);
+    expect(() => parseMarkup('[bold]a[/italic]')).toThrow('position 7');
+  });
+
+  test('brackets that are not tags are text', () => {
+    expect(parseMarkup('arr[0] = [] [ x]')).toEqual([{ kind: 'text', text: 'arr[0] = [] [ x]' }]);
+  });
+
+  test('escapes', () => {
+    expect(parseMarkup('\\[bold] C:\\dir \\\\')).toEqual([
+      { kind: 'text', text: '[bold] C:\\dir \\' },
+    ]);
+    expect(escapeMarkup('[b]\\')).toBe('\\[b]\\\\');
+    expect(parseMarkup(escapeMarkup('[bold]\\[x]\\'))).toEqual([
+      { kind: 'text', text: '[bold]\\[x]\\' },
+    ]);
+  });
+});
+
+describe('markup rendering', () => {
+  test('renders nested styles', () => {
+    expect(renderMarkup('[bold red]Error:[/] file', Profile.ANSI)).toBe(
+      '\x1b[1;31mError:\x1b[22;39m file'
+    );
+    expect(renderMarkup('[red]a [bold]b[/bold] c[/red]', Profile.ANSI)).toBe(
+      '\x1b[31ma \x1b[1mb\x1b[22m c\x1b[39m'
+    );
+  });
+
+  test('inner tags override outer attributes', () => {
+    expect(renderMarkup('[bold red]a[not bold blue]b[/]c', Profile.ANSI)).toBe(
+      '\x1b[1;31ma\x1b[22;34mb\x1b[1;31mc\x1b[22;39m'
+    );
+  });
+
+  test('converts colors for the profile', () => {
+    expect(renderMarkup('[#ff0000]x', Profile.TrueColor)).toBe('\x1b[38;2;255;0;0mx\x1b[39m');
+    expect(renderMarkup('[#ff0000]x', Profile.ANSI256)).toBe('\x1b[38;5;196mx\x1b[39m');
+    expect(renderMarkup('[on color(208)]x', Profile.ANSI)).toBe('\x1b[101mx\x1b[49m');
+    expect(renderMarkup('[bold #ff0000]x[/]', Profile.Ascii)).toBe('x');
+    expect(renderMarkup('[tomato ON navy]x', Profile.TrueColor)).toBe(
+      '\x1b[38;2;255;99;71;48;2;0;0;128mx\x1b[39;49m'
+    );
+  });
+
+  test('keywords are case-insensitive like attributes', () => {
+    expect(renderMarkup('[BOLD On blue]a[NOT bold]b', Profile.ANSI)).toBe(
+      renderMarkup('[bold on blue]a[not bold]b', Profile.ANSI)
+    );
+    expect(parseTag('LINK=https://example.com/A Underline=CURLY UNDERLINE-COLOR=red')).toEqual({
+      link: { url: 'https://example.com/A' },
+      underline: 'curly',
+      underlineColor: new ANSIColor(1),
+    });
+  });
+
+  test('renders every attribute', () => {
+    const tag = '[bold faint italic underline overline blink reverse strike]';
+    expect(renderMarkup(`${tag}x`, Profile.ANSI)).toBe(
+      '\x1b[1;2;3;4;5;7;9;53mx\x1b[22;23;24;25;27;29;55m'
+    );
+  });
+
+  test('uses the output settings', () => {
+    const output = newOutput(
+      process.stdout,
+      withTTY(true),
+      withEnvironment(new MockEnviron({ TERM: 'xterm-kitty', COLORTERM: 'truecolor' }))
+    );
+    expect(renderMarkup('[underline=curly underline-color=red]typo', output)).toBe(
+      '\x1b[4:3;58;5;1mtypo\x1b[24;59m'
+    );
+  });
+
+  test('renders links', () => {
+    const output = newMemoryOutput(withProfile(Profile.ANSI), withHyperlinks(true));
+    expect(renderMarkup('see [link=https://x]x.ts[/link]', output)).toBe(
+      'see \x1b]8;;https://x\x1b\\x.ts\x1b]8;;\x1b\\'
+    );
+    expect(renderMarkup('[link=https://x]a [bold]b[/bold][/link]', output)).toBe(
+      '\x1b]8;;https://x\x1b\\a \x1b[1mb\x1b[22m\x1b]8;;\x1b\\'
+    );
+  });
+
+  test('links fall back once per link', () => {
+    const output = newMemoryOutput(withProfile(Profile.ANSI));
+    expect(renderMarkup('[link=https://x]a [bold]b[/bold][/link]!', output)).toBe(
+      'a \x1b[1mb\x1b[22m (https://x)!'
+    );
+
+    const custom = newMemoryOutput(
+      withProfile(Profile.Ascii),
+      withLinkFallback((text, url) => `[${text}](${url})`)
+    );
+    expect(renderMarkup('[link=https://x]a [bold]b[/bold][/link]', custom)).toBe(
+      '[a b](https://x)'
+    );
+  });
+
+  test('open tags end with the text', () => {
+    expect(renderMarkup('[italic]x', Profile.ANSI)).toBe('\x1b[3mx\x1b[23m');
+  });
+});
+
+describe('markup template tag', () => {
+  const md = markupTag(Profile.ANSI);
+
+  test('renders markup', () => {
+    expect(md`[bold]${'name'}[/bold]`).toBe('\x1b[1mname\x1b[22m');
+  });
+
+  test('escapes interpolated values', () => {
+    const value = '[red]not a tag\\';
+    expect(md`[bold]${value}[/]`).toBe('\x1b[1m[red]not a tag\\\x1b[22m');
+    expect(md`${42} ${null}`).toBe('42 null');
+  });
+});
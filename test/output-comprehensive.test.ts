@@ -363,6 +363,78 @@ describe('OutputImpl', () => {
     });
   });
 
+  describe('FORCE_COLOR', () => {
+    let mockEnv: MockEnviron;
+
+    beforeEach(() => {
+      mockEnv = new MockEnviron({ TERM: 'xterm-256color' });
+    });
+
+    test('levels 1 to 3 select the profile', () => {
+      const cases: [string, Profile][] = [
+        ['1', Profile.ANSI],
+        ['2', Profile.ANSI256],
+        ['3', Profile.TrueColor],
+        ['16', Profile.TrueColor],
+      ];
+
+      for (const [level, want] of cases) {
+        mockEnv.setEnv('FORCE_COLOR', level);
+        const output = newOutput(mockWriter as any, withEnvironment(mockEnv), withTTY(true));
+        expect(output.envColorProfile()).toBe(want);
+      }
+    });
+
+    test('forces color when not writing to a terminal', () => {
+      mockEnv.setEnv('FORCE_COLOR', '3');
+      mockEnv.setEnv('CI', 'true');
+      const output = newOutput(mockWriter as any, withEnvironment(mockEnv));
+      expect(output.isTTY()).toBe(false);
+      expect(output.envColorProfile()).toBe(Profile.TrueColor);
+      expect(output.profile).toBe(Profile.TrueColor);
+    });
+
+    test('true and empty values force a minimum of ANSI', () => {
+      for (const value of ['true', '']) {
+        mockEnv.setEnv('FORCE_COLOR', value);
+        const tty = newOutput(mockWriter as any, withEnvironment(mockEnv), withTTY(true));
+        expect(tty.envColorProfile()).toBe(Profile.ANSI256);
+
+        mockWriter.isTTY = false;
+        const pipe = newOutput(mockWriter as any, withEnvironment(mockEnv));
+        expect(pipe.envColorProfile()).toBe(Profile.ANSI);
+        mockWriter.isTTY = true;
+      }
+    });
+
+    test('0 and false disable color', () => {
+      for (const value of ['0', 'false']) {
+        mockEnv.setEnv('FORCE_COLOR', value);
+        mockEnv.setEnv('CLICOLOR_FORCE', '1');
+        const output = newOutput(mockWriter as any, withEnvironment(mockEnv), withTTY(true));
+        expect(output.envNoColor()).toBe(true);
+        expect(output.envColorProfile()).toBe(Profile.Ascii);
+      }
+    });
+
+    test('overrides NO_COLOR and CLICOLOR=0', () => {
+      mockEnv.setEnv('NO_COLOR', '1');
+      mockEnv.setEnv('CLICOLOR', '0');
+      mockEnv.setEnv('FORCE_COLOR', '2');
+      const output = newOutput(mockWriter as any, withEnvironment(mockEnv), withTTY(true));
+      expect(output.envNoColor()).toBe(false);
+      expect(output.envColorProfile()).toBe(Profile.ANSI256);
+    });
+
+    test('ignores values it does not understand', () => {
+      mockEnv.setEnv('FORCE_COLOR', 'undefined');
+      mockEnv.setEnv('NO_COLOR', '1');
+      const output = newOutput(mockWriter as any, withEnvironment(mockEnv), withTTY(true));
+      expect(output.envNoColor()).toBe(true);
+      expect(output.envColorProfile()).toBe(Profile.Ascii);
+    });
+  });
+
   describe('foreground and background colors', () => {
     let mockEnv: MockEnviron;
 
@@ -0,0 +1,213 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  ansi256ToANSI,
+  clearConversionCache,
+  conversionCacheStats,
+  convertColor,
+  rgbToANSI256,
+} from '#src/color-convert.js';
+import {
+  newOutput,
+  withEnvironment,
+  withInput,
+  withPalette,
+  withProfile,
+  withStatusReportTimeout,
+  withTTY,
+} from '#src/output.js';
+import { DefaultPalette, Palette, parsePaletteReport } from '#src/palette.js';
+import { newStyleSpec } from '#src/style-spec.js';
+import {
+  ANSI256Color,
+  ANSIColor,
+  InvalidColorError,
+  Profile,
+  RGBColor,
+  StatusReportError,
+} from '#src/types.js';
+import { FakeTerminal } from '#test/utils/fake-tty.js';
+
+// Solarized Dark
+const solarized = [
+  '#073642',
+  '#dc322f',
+  '#859900',
+  '#b58900',
+  '#268bd2',
+  '#d33682',
+  '#2aa198',
+  '#eee8d5',
+  '#002b36',
+  '#cb4b16',
+  '#586e75',
+  '#657b83',
+  '#839496',
+  '#6c71c4',
+  '#93a1a1',
+  '#fdf6e3',
+];
+
+const DSR = '\x1b[6n';
+const query = (i: number) => `\x1b]4;${i};?\x1b\\`;
+const report = (i: number, hex: string) => {
+  const [r, g, b] = [1, 3, 5].map((n) => hex.slice(n, n + 2).repeat(2));
+  return `\x1b]4;${i};rgb:${r}/${g}/${b}\x1b\\`;
+};
+
+function terminalOutput(term: FakeTerminal, termName = 'xterm-256color') {
+  return newOutput(
+    term as any,
+    withTTY(true),
+    withProfile(Profile.ANSI),
+    withInput(term.input),
+    withEnvironment({ getenv: (k) => (k === 'TERM' ? termName : ''), environ: () => [] }),
+    withStatusReportTimeout(50)
+  );
+}
+
+describe('Palette', () => {
+  test('fills missing colors with the xterm defaults', () => {
+    const palette = new Palette(['tomato', new RGBColor('#123456'), new ANSIColor(9)]);
+    expect(palette.color(0)).toEqual(new RGBColor('#ff6347'));
+    expect(palette.color(1)).toEqual(new RGBColor('#123456'));
+    expect(palette.color(2)).toEqual(new RGBColor('#ff0000'));
+    expect(palette.color(3)).toEqual(DefaultPalette.color(3));
+    expect(palette.color(255)).toEqual(new RGBColor('#eeeeee'));
+    expect(palette.color(256)).toBeNull();
+    expect(palette.colors()).toHaveLength(256);
+    expect(palette.customANSI).toBe(true);
+    expect(palette.customANSI256).toBe(false);
+    expect(DefaultPalette.customANSI).toBe(false);
+  });
+
+  test('is identified by its colors', () => {
+    expect(new Palette(solarized).id).toBe(new Palette([...solarized]).id);
+    expect(new Palette(solarized).id).not.toBe(new Palette(solarized.slice(1)).id);
+    expect(new Palette(['#000000', '#800000']).id).toBe('xterm');
+    expect(new Palette(DefaultPalette.colors()).customANSI256).toBe(false);
+  });
+
+  test('rejects invalid colors', () => {
+    expect(() => new Palette(['tomatoe'])).toThrow(InvalidColorError);
+    expect(() => new Palette([new RGBColor('#GGGGGG')])).toThrow(InvalidColorError);
+  });
+
+  test('parses OSC 4 reports', () => {
+    expect(parsePaletteReport('\x1b]4;1;rgb:dcdc/3232/2f2f\x1b\\')).toEqual({
+      index: 1,
+      color: new RGBColor('#dc322f'),
+    });
+    expect(parsePaletteReport('\x1b]4;255;rgb:ee/ee/ee\x07')).toEqual({
+      index: 255,
+      color: new RGBColor('#eeeeee'),
+    });
+    expect(parsePaletteReport('\x1b]4;256;rgb:ee/ee/ee\x07')).toBeNull();
+    expect(parsePaletteReport('\x1b]11;rgb:0000/0000/0000\x07')).toBeNull();
+    expect(parsePaletteReport('\x1b]4;1;rgb:dcdc/3232/2f2f')).toBeNull();
+  });
+});
+
+describe('downsampling to a palette', () => {
+  const palette = new Palette(solarized);
+
+  test('the xterm palette converts like Go', () => {
+    expect(convertColor(Profile.ANSI, new RGBColor('#268bd2'))).toEqual(new ANSIColor(12));
+    expect(convertColor(Profile.ANSI, new RGBColor('#268bd2'), 'hsluv', DefaultPalette)).toEqual(
+      new ANSIColor(12)
+    );
+  });
+
+  test('picks the palette color nearest to the RGB color', () => {
+    for (const [i, hex] of solarized.entries()) {
+      expect(convertColor(Profile.ANSI, new RGBColor(hex), 'hsluv', palette)).toEqual(
+        new ANSIColor(i)
+      );
+    }
+    // ANSI256 conversion doesn't depend on the first 16 colors
+    expect(convertColor(Profile.ANSI256, new RGBColor('#268bd2'), 'hsluv', palette)).toEqual(
+      new ANSI256Color(32)
+    );
+  });
+
+  test('picks the nearest ANSI256 color of a palette that redefines them', () => {
+    const colors = DefaultPalette.colors();
+    colors[100] = new RGBColor('#268bd2');
+    const extended = new Palette(colors);
+    expect(extended.customANSI256).toBe(true);
+    expect(convertColor(Profile.ANSI256, new RGBColor('#268bd2'), 'hsluv', extended)).toEqual(
+      new ANSI256Color(100)
+    );
+    const blue = { r: 0x26 / 255, g: 0x8b / 255, b: 0xd2 / 255 };
+    expect(rgbToANSI256(blue, 'hsluv', extended)).toEqual(new ANSI256Color(100));
+    expect(rgbToANSI256(blue)).toEqual(new ANSI256Color(32));
+  });
+
+  test('equal palettes share cache entries', () => {
+    clearConversionCache();
+    convertColor(Profile.ANSI, new RGBColor('#123456'), 'hsluv', new Palette(solarized));
+    convertColor(Profile.ANSI, new RGBColor('#123456'), 'hsluv', new Palette(solarized));
+    expect(conversionCacheStats()).toMatchObject({ hits: 1, misses: 1 });
+  });
+
+  test('maps ANSI256 colors onto the palette', () => {
+    // 33 is #0087ff, nearest to Solarized blue rather than its bright blue
+    expect(ansi256ToANSI(new ANSI256Color(33), 'hsluv', palette)).toEqual(new ANSIColor(4));
+    expect(ansi256ToANSI(new ANSI256Color(33))).toEqual(new ANSIColor(12));
+  });
+
+  test('withPalette sets the palette of an output and its styles', () => {
+    const output = newOutput(process.stdout, withProfile(Profile.ANSI), withPalette(solarized));
+    expect(output.color('#dc322f')).toEqual(new ANSIColor(1));
+    const spec = newStyleSpec({ foreground: new RGBColor('#2aa198') });
+    expect(spec.apply(output.string('x')).toString()).toBe('\x1b[36mx\x1b[0m');
+  });
+});
+
+describe('queryPalette', () => {
+  test('reads the ANSI colors with OSC 4', async () => {
+    const replies: Record<string, string> = { [DSR]: '\x1b[5;1R' };
+    for (const [i, hex] of solarized.entries()) {
+      replies[query(i)] = report(i, hex);
+    }
+    const term = new FakeTerminal(replies);
+    const output = terminalOutput(term);
+
+    const palette = await output.queryPalette();
+    expect(palette.colors().slice(0, 16)).toEqual(solarized.map((hex) => new RGBColor(hex)));
+    expect(output.palette).toBe(palette);
+    expect(term.output).toEqual([...solarized.map((_, i) => query(i)), DSR]);
+    expect(output.color('#268bd2')).toEqual(new ANSIColor(4));
+  });
+
+  test('keeps defaults for colors the terminal does not report', async () => {
+    const term = new FakeTerminal({
+      [query(1)]: report(1, '#dc322f'),
+      [query(100)]: report(100, '#268bd2'),
+      [DSR]: '\x1b[5;1R',
+    });
+    const output = terminalOutput(term);
+
+    const palette = await output.queryPalette(256);
+    expect(palette.color(1)).toEqual(new RGBColor('#dc322f'));
+    expect(palette.color(2)).toEqual(DefaultPalette.color(2));
+    expect(palette.color(100)).toEqual(new RGBColor('#268bd2'));
+    expect(palette.customANSI256).toBe(true);
+    expect(term.output).toHaveLength(257);
+  });
+
+  test('rejects when the terminal reports no colors', async () => {
+    const term = new FakeTerminal({ [DSR]: '\x1b[5;1R' });
+    const output = terminalOutput(term);
+
+    await expect(output.queryPalette()).rejects.toThrow(StatusReportError);
+    expect(output.palette).toBe(DefaultPalette);
+  });
+
+  test('does not query multiplexers', async () => {
+    const term = new FakeTerminal({ [query(0)]: report(0, '#073642') });
+    const output = terminalOutput(term, 'tmux-256color');
+
+    await expect(output.queryPalette()).rejects.toThrow(StatusReportError);
+    expect(term.output).toEqual([]);
+  });
+});
@@ -0,0 +1,82 @@
+import { describe, expect, test } from 'bun:test';
+import { withProfile, withTTY } from '#src/output.js';
+import { MemoryWriter, newMemoryOutput, RecordingOutput } from '#src/recording.js';
+import { ANSIColor, Profile } from '#src/types.js';
+
+describe('RecordingOutput', () => {
+  test('records control method output without mocking streams', () => {
+    const output = newMemoryOutput();
+
+    output.enableMouse();
+    output.hyperlink('https://example.com', 'example');
+    output.notify('Title', 'Body');
+
+    expect(output.text()).toBe(
+      '\x1b[?1000h\x1b]8;;https://example.com\x1b\\example\x1b]8;;\x1b\\' +
+        '\x1b]777;notify;Title;Body\x1b\\'
+    );
+    expect(output.sequences()).toEqual([
+      '\x1b[?1000h',
+      '\x1b]8;;https://example.com\x1b\\',
+      '\x1b]8;;\x1b\\',
+      '\x1b]777;notify;Title;Body\x1b\\',
+    ]);
+    expect(output.plainText()).toBe('example');
+  });
+
+  test('records every write with a timestamp', () => {
+    const before = Date.now();
+    const output = newMemoryOutput();
+
+    output.hideCursor();
+    output.showCursor();
+
+    const records = output.records();
+    expect(records.map((r) => r.data)).toEqual(['\x1b[?25l', '\x1b[?25h']);
+    for (const r of records) {
+      expect(r.time).toBeGreaterThanOrEqual(before);
+      expect(r.time).toBeLessThanOrEqual(Date.now());
+    }
+  });
+
+  test('tokenizes styled output', async () => {
+    const output = newMemoryOutput(withProfile(Profile.ANSI));
+
+    await output.writeString(output.string('red').foreground(new ANSIColor(1)).toString());
+    expect(output.tokens()).toEqual([
+      { kind: 'csi', value: '\x1b[31m', params: '31', final: 'm' },
+      { kind: 'text', value: 'red', params: '', final: '' },
+      { kind: 'csi', value: '\x1b[0m', params: '0', final: 'm' },
+    ]);
+  });
+
+  test('clearRecording discards recorded output', () => {
+    const output = newMemoryOutput();
+    output.clearScreen();
+    output.clearRecording();
+
+    expect(output.text()).toBe('');
+    expect(output.records()).toEqual([]);
+    output.clearLine();
+    expect(output.text()).toBe('\x1b[2K');
+  });
+
+  test('reset writes the terminal reset sequence', () => {
+    const output = newMemoryOutput();
+    output.reset();
+    expect(output.text()).toBe('\x1bc');
+  });
+
+  test('is not a terminal by default, like a Go strings.Builder', () => {
+    expect(newMemoryOutput().colorProfile()).toBe(Profile.Ascii);
+    expect(newMemoryOutput(withTTY(true)).isTTY()).toBe(true);
+    expect(newMemoryOutput()).toBeInstanceOf(RecordingOutput);
+  });
+
+  test('MemoryWriter collects writes', async () => {
+    const writer = new MemoryWriter();
+    writer.write('a');
+    writer.write(new TextEncoder().encode('é'));
+    expect(writer.records.map((r) => r.data)).toEqual(['a', 'é']);
+  });
+});
@@ -179,6 +179,19 @@ describe('ScreenControl', () => {
     expect(writer.output[0]).toBe('\x1b[?2004l');
   });
 
+  test('synchronized output methods', () => {
+    const writer = new MockWriter();
+    const output = newOutput(writer as any);
+    const screen = new ScreenControl(output);
+
+    screen.beginSynchronizedUpdate();
+    expect(writer.output[0]).toBe('\x1b[?2026h');
+
+    writer.clear();
+    screen.endSynchronizedUpdate();
+    expect(writer.output[0]).toBe('\x1b[?2026l');
+  });
+
   test('scrolling methods', () => {
     const writer = new MockWriter();
     const output = newOutput(writer as any);
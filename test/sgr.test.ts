@@ -0,0 +1,159 @@
+import { describe, expect, test } from 'bun:test';
+import { stripAnsi } from '#src/ansi.js';
+import { withProfile, withResetStrategy } from '#src/output.js';
+import { newMemoryOutput } from '#src/recording.js';
+import { applySGR, closeSGR, diffSGR, reapplySGR, sgrGroups } from '#src/sgr.js';
+import { renderSpans, Style } from '#src/style.js';
+import { ANSI256Color, ANSIColor, Profile, RGBColor } from '#src/types.js';
+
+function minimal(profile: Profile, text: string): Style {
+  const style = new Style(profile, text);
+  style.resetStrategy = 'minimal';
+  return style;
+}
+
+describe('SGR state', () => {
+  test('groups extended color arguments', () => {
+    expect(sgrGroups('1;38;5;200;48;2;1;2;3;4:3')).toEqual(['1', '38;5;200', '48;2;1;2;3', '4:3']);
+    expect(sgrGroups('')).toEqual(['']);
+  });
+
+  test('tracks set attributes', () => {
+    expect(applySGR({}, '1;3;31;48;5;20;4:3;58;2;1;2;3')).toEqual({
+      bold: '1',
+      italic: '3',
+      foreground: '31',
+      background: '48;5;20',
+      underline: '4:3',
+      underlineColor: '58;2;1;2;3',
+    });
+  });
+
+  test('resets attributes', () => {
+    const state = applySGR({}, '1;2;3;4;31;41');
+    expect(applySGR(state, '22;39')).toEqual({ italic: '3', underline: '4', background: '41' });
+    expect(applySGR(state, '4:0')).not.toHaveProperty('underline');
+    expect(applySGR(state, '0')).toEqual({});
+    expect(applySGR(state, '')).toEqual({});
+  });
+
+  test('color arguments are not resets', () => {
+    expect(applySGR({}, '38;5;0')).toEqual({ foreground: '38;5;0' });
+    expect(applySGR({}, '48;2;0;0;0')).toEqual({ background: '48;2;0;0;0' });
+  });
+
+  test('closes only what is set', () => {
+    expect(closeSGR(applySGR({}, '1;2;9;53;91'))).toBe('22;29;55;39');
+    expect(closeSGR(applySGR({}, '4:3;58;5;1;7;5;3;44'))).toBe('23;24;25;27;49;59');
+    expect(closeSGR({})).toBe('');
+  });
+
+  test('diffs states', () => {
+    const bold = applySGR({}, '1');
+    const boldRed = applySGR({}, '1;31');
+    const faint = applySGR({}, '2');
+    expect(diffSGR(bold, boldRed)).toBe('31');
+    expect(diffSGR(boldRed, bold)).toBe('39');
+    expect(diffSGR(bold, bold)).toBe('');
+    expect(diffSGR({}, boldRed)).toBe('1;31');
+    // 22 resets faint as well as bold
+    expect(diffSGR(applySGR({}, '1;2'), faint)).toBe('22;2');
+  });
+
+  test('never uses a full reset', () => {
+    const from = applySGR({}, '1;3;4;9;31;41');
+    expect(diffSGR(from, applySGR({}, '7'))).toBe('22;23;24;29;39;49;7');
+  });
+});
+
+describe('minimal reset strategy', () => {
+  test('closes with the off codes of the style', () => {
+    const style = minimal(Profile.ANSI, 'text').bold().italic().foreground(new ANSIColor(2));
+    expect(style.toString()).toBe('\x1b[1;3;32mtext\x1b[22;23;39m');
+  });
+
+  test('closes every attribute', () => {
+    const style = minimal(Profile.TrueColor, 'x')
+      .faint()
+      .underline()
+      .blink()
+      .reverse()
+      .crossOut()
+      .overline()
+      .background(new RGBColor('#102030'));
+    expect(style.toString()).toBe('\x1b[2;4;5;7;9;53;48;2;16;32;48mx\x1b[22;24;25;27;29;55;49m');
+  });
+
+  test('keeps colors set outside the style', () => {
+    const line = `\x1b[34mblue ${minimal(Profile.ANSI, 'bold').bold()} still blue`;
+    expect(line).toBe('\x1b[34mblue \x1b[1mbold\x1b[22m still blue');
+    expect(applySGR({}, '34;1;22')).toEqual({ foreground: '34' });
+  });
+
+  test('the full strategy is the default', () => {
+    expect(new Style(Profile.ANSI, 'x').bold().toString()).toBe('\x1b[1mx\x1b[0m');
+  });
+
+  test('wrap restores outer colors reset by inner off codes', () => {
+    const inner = minimal(Profile.ANSI, 'b').foreground(new ANSIColor(2)).toString();
+    const outer = minimal(Profile.ANSI, '').foreground(new ANSIColor(1)).bold();
+    expect(outer.wrap(`a${inner}c`)).toBe('\x1b[31;1ma\x1b[32mb\x1b[39;31mc\x1b[22;39m');
+  });
+
+  test('reapplySGR leaves unrelated off codes alone', () => {
+    expect(reapplySGR('a\x1b[3mb\x1b[23mc', '31')).toBe('a\x1b[3mb\x1b[23mc');
+  });
+
+  test('withResetStrategy applies to styles of the output', () => {
+    const output = newMemoryOutput(withProfile(Profile.ANSI), withResetStrategy('minimal'));
+    expect(output.string('x').underline().toString()).toBe('\x1b[4mx\x1b[24m');
+  });
+});
+
+describe('renderSpans', () => {
+  test('emits only the changes between adjacent spans', () => {
+    const out = renderSpans(
+      new Style(Profile.ANSI, 'a').foreground(new ANSIColor(1)),
+      new Style(Profile.ANSI, 'b').foreground(new ANSIColor(1)).bold(),
+      new Style(Profile.ANSI, 'c').foreground(new ANSIColor(1)),
+      new Style(Profile.ANSI, 'd')
+    );
+    expect(out).toBe('\x1b[31ma\x1b[1mb\x1b[22mc\x1b[39md');
+  });
+
+  test('merges equal spans', () => {
+    const red = (text: string) =>
+      new Style(Profile.ANSI256, text).foreground(new ANSI256Color(160));
+    expect(renderSpans(red('a'), red('b'), red('c'))).toBe('\x1b[38;5;160mabc\x1b[39m');
+  });
+
+  test('is shorter than rendering spans one by one', () => {
+    const spans = ['one', 'two', 'three'].map((text, i) =>
+      new Style(Profile.ANSI, `${text} `).bold().foreground(new ANSIColor(i))
+    );
+    const separate = spans.map((s) => s.toString()).join('');
+    const merged = renderSpans(...spans);
+    expect(merged.length).toBeLessThan(separate.length);
+    expect(stripAnsi(merged)).toBe(stripAnsi(separate));
+  });
+
+  test('renders plain text for the Ascii profile', () => {
+    const out = renderSpans(new Style(Profile.Ascii, 'a').bold(), new Style(Profile.Ascii, 'b'));
+    expect(out).toBe('ab');
+  });
+
+  test('opens and closes links between spans', () => {
+    const docs = (text: string) => new Style(Profile.ANSI, text).link('https://example.com');
+    const out = renderSpans(docs('a'), docs('b').bold(), new Style(Profile.ANSI, 'c'));
+    expect(out).toBe('\x1b]8;;https://example.com\x1b\\a\x1b[1mb\x1b]8;;\x1b\\\x1b[22mc');
+  });
+
+  test('renders link fallbacks', () => {
+    const link = new Style(Profile.Ascii, 'docs').link('https://example.com');
+    expect(renderSpans(link)).toBe('docs (https://example.com)');
+  });
+
+  test('renders nothing without spans', () => {
+    expect(renderSpans()).toBe('');
+  });
+});
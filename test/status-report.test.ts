@@ -0,0 +1,213 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  newOutput,
+  withEnvironment,
+  withInput,
+  withStatusReportTimeout,
+  withTTY,
+  withUnsafe,
+} from '#src/output.js';
+import { StatusReportReader } from '#src/status-report.js';
+import { ANSIColor, NoColor, RGBColor, StatusReportError } from '#src/types.js';
+import { FakeTerminal, FakeTTYInput } from '#test/utils/fake-tty.js';
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+const OSC10 = '\x1b]10;?\x1b\\';
+const OSC11 = '\x1b]11;?\x1b\\';
+const DSR = '\x1b[6n';
+
+function newTerminalOutput(term: FakeTerminal, env: Record<string, string> = {}) {
+  return newOutput(
+    term as any,
+    withTTY(true),
+    withInput(term.input),
+    withEnvironment(new MockEnviron({ TERM: 'xterm-256color', ...env })),
+    withStatusReportTimeout(50)
+  );
+}
+
+describe('StatusReportReader', () => {
+  test('reads CSI, OSC and DCS responses', async () => {
+    const input = new FakeTTYInput();
+    const reader = new StatusReportReader(input, { timeout: 50 });
+    reader.open();
+    input.write('\x1b[12;40R\x1b]11;rgb:0000/0000/0000\x07\x1bP>|XTerm(388)\x1b\\');
+
+    expect(await reader.readResponse()).toEqual({ kind: 'csi', response: '\x1b[12;40R' });
+    expect(await reader.readResponse()).toEqual({
+      kind: 'osc',
+      response: '\x1b]11;rgb:0000/0000/0000\x07',
+    });
+    expect(await reader.readResponse()).toEqual({
+      kind: 'dcs',
+      response: '\x1bP>|XTerm(388)\x1b\\',
+    });
+    reader.close();
+  });
+
+  test('skips bytes before the response', async () => {
+    const input = new FakeTTYInput();
+    const reader = new StatusReportReader(input, { timeout: 50 });
+    reader.open();
+    input.write('abc\x1b[1;1R');
+
+    expect((await reader.readResponse()).response).toBe('\x1b[1;1R');
+    reader.close();
+  });
+
+  test('times out with StatusReportError', async () => {
+    const input = new FakeTTYInput();
+    const reader = new StatusReportReader(input, { timeout: 10 });
+    reader.open();
+
+    await expect(reader.readResponse()).rejects.toThrow(StatusReportError);
+    reader.close();
+  });
+
+  test('keeps unknown escape sequences as keystrokes', async () => {
+    const input = new FakeTTYInput();
+    const reader = new StatusReportReader(input, { timeout: 50 });
+    reader.open();
+    input.write('\x1bOA\x1b[1;1R');
+
+    expect((await reader.readResponse()).response).toBe('\x1b[1;1R');
+    reader.close();
+    expect(input.read()?.toString()).toBe('\x1bOA');
+  });
+
+  test('toggles raw mode and restores it on close', () => {
+    const input = new FakeTTYInput();
+    const reader = new StatusReportReader(input);
+    reader.open();
+    expect(input.isRaw).toBe(true);
+    reader.close();
+    expect(input.isRaw).toBe(false);
+    expect(input.rawModes).toEqual([true, false]);
+  });
+
+  test('leaves raw mode alone when raw is disabled', () => {
+    const input = new FakeTTYInput();
+    const reader = new StatusReportReader(input, { raw: false });
+    reader.open();
+    reader.close();
+    expect(input.rawModes).toEqual([]);
+  });
+});
+
+describe('OSC 10/11 color queries', () => {
+  test('queries the background color', async () => {
+    const term = new FakeTerminal({
+      [OSC11]: '\x1b]11;rgb:1c1c/1c1c/1c1c\x1b\\',
+      [DSR]: '\x1b[5;1R',
+    });
+    const output = newTerminalOutput(term);
+
+    const bg = await output.queryBackgroundColor();
+    expect(bg).toBeInstanceOf(RGBColor);
+    expect(bg.toString()).toBe('#1c1c1c');
+    expect(term.output).toEqual([OSC11, DSR]);
+    expect(output.hasDarkBackground()).toBe(true);
+  });
+
+  test('queries the foreground color with BEL terminated reply', async () => {
+    const term = new FakeTerminal({
+      [OSC10]: '\x1b]10;rgb:ffff/ffff/ffff\x07',
+      [DSR]: '\x1b[5;1R',
+    });
+    const output = newTerminalOutput(term);
+
+    const fg = await output.queryForegroundColor();
+    expect(fg.toString()).toBe('#ffffff');
+    expect(output.foregroundColor().toString()).toBe('#ffffff');
+  });
+
+  test('light background reported by the terminal', async () => {
+    const term = new FakeTerminal({
+      [OSC11]: '\x1b]11;rgb:fdfd/f6f6/e3e3\x1b\\',
+      [DSR]: '\x1b[5;1R',
+    });
+    const output = newTerminalOutput(term, { COLORFGBG: '15;0' });
+
+    expect(output.hasDarkBackground()).toBe(true);
+    await output.queryBackgroundColor();
+    expect(output.hasDarkBackground()).toBe(false);
+  });
+
+  test('restores raw mode after the query', async () => {
+    const term = new FakeTerminal({
+      [OSC11]: '\x1b]11;rgb:0000/0000/0000\x1b\\',
+      [DSR]: '\x1b[5;1R',
+    });
+    const output = newTerminalOutput(term);
+
+    await output.queryBackgroundColor();
+    expect(term.input.rawModes).toEqual([true, false]);
+  });
+
+  test('unsafe output does not touch raw mode', async () => {
+    const term = new FakeTerminal({
+      [OSC11]: '\x1b]11;rgb:0000/0000/0000\x1b\\',
+      [DSR]: '\x1b[5;1R',
+    });
+    const output = newTerminalOutput(term);
+    withUnsafe()(output);
+
+    await output.queryBackgroundColor();
+    expect(term.input.rawModes).toEqual([]);
+  });
+
+  test('falls back to COLORFGBG when the terminal only answers DSR', async () => {
+    const term = new FakeTerminal({ [DSR]: '\x1b[5;1R' });
+    const output = newTerminalOutput(term, { COLORFGBG: '0;15' });
+
+    await expect(output.termStatusReport(11)).rejects.toThrow(StatusReportError);
+    const bg = await output.queryBackgroundColor();
+    expect(bg).toBeInstanceOf(ANSIColor);
+    expect((bg as ANSIColor).value).toBe(15);
+  });
+
+  test('times out when the terminal does not answer', async () => {
+    const term = new FakeTerminal();
+    const output = newTerminalOutput(term);
+
+    await expect(output.termStatusReport(10)).rejects.toThrow(StatusReportError);
+    expect(await output.queryForegroundColor()).toBeInstanceOf(NoColor);
+    expect(term.input.isRaw).toBe(false);
+  });
+
+  test('does not query multiplexers', async () => {
+    const term = new FakeTerminal({ [OSC11]: '\x1b]11;rgb:0000/0000/0000\x1b\\' });
+    const output = newTerminalOutput(term, { TERM: 'screen-256color' });
+
+    await expect(output.termStatusReport(11)).rejects.toThrow(StatusReportError);
+    expect(term.output).toEqual([]);
+  });
+
+  test('does not query without an input stream', async () => {
+    const term = new FakeTerminal();
+    const output = newOutput(term as any, withTTY(true));
+
+    await expect(output.termStatusReport(11)).rejects.toThrow(StatusReportError);
+  });
+
+  test('does not query non-TTY outputs', async () => {
+    const term = new FakeTerminal({ [OSC11]: '\x1b]11;rgb:0000/0000/0000\x1b\\' });
+    const output = newOutput(term as any, withInput(term.input), withTTY(false));
+    term.isTTY = false;
+
+    expect(await output.queryBackgroundColor()).toBeInstanceOf(NoColor);
+    expect(term.output).toEqual([]);
+  });
+});
@@ -0,0 +1,95 @@
+import { describe, expect, test } from 'bun:test';
+import { stripAnsi } from '#src/ansi.js';
+import { displayWidth } from '#src/layout.js';
+import { withLineMode, withProfile, withResetStrategy } from '#src/output.js';
+import { newMemoryOutput } from '#src/recording.js';
+import { Style } from '#src/style.js';
+import { ANSIColor, Profile } from '#src/types.js';
+
+const red = (text: string) => new Style(Profile.ANSI, text).foreground(new ANSIColor(1));
+
+describe('per-line styling', () => {
+  test('block mode wraps the whole text like Go', () => {
+    expect(red('a\nb').toString()).toBe('\x1b[31ma\nb\x1b[0m');
+  });
+
+  test('styles every line on its own', () => {
+    expect(red('a\nbc').perLine().toString()).toBe('\x1b[31ma\x1b[0m\n\x1b[31mbc\x1b[0m');
+  });
+
+  test('leaves empty lines and carriage returns unstyled', () => {
+    expect(red('a\n\nb\r\n').perLine().toString()).toBe('\x1b[31ma\x1b[0m\n\n\x1b[31mb\x1b[0m\r\n');
+  });
+
+  test('uses the reset strategy', () => {
+    const output = newMemoryOutput(withProfile(Profile.ANSI), withResetStrategy('minimal'));
+    expect(output.string('a\nb').bold().perLine().toString()).toBe(
+      '\x1b[1ma\x1b[22m\n\x1b[1mb\x1b[22m'
+    );
+  });
+
+  test('can be turned off again', () => {
+    expect(red('a\nb').perLine().perLine(false).toString()).toBe('\x1b[31ma\nb\x1b[0m');
+  });
+
+  test('text without newlines renders as before', () => {
+    expect(red('abc').perLine().toString()).toBe(red('abc').toString());
+  });
+
+  test('wrap re-applies the style on each line', () => {
+    const inner = new Style(Profile.ANSI, 'x').bold().toString();
+    expect(red('').perLine().wrap(`a${inner}c\nb`)).toBe(
+      '\x1b[31ma\x1b[1mx\x1b[0;31mc\x1b[0m\n\x1b[31mb\x1b[0m'
+    );
+  });
+});
+
+describe('padded lines', () => {
+  test('pads to the widest line', () => {
+    const block = new Style(Profile.ANSI, 'ab\n日本語\nc')
+      .background(new ANSIColor(4))
+      .padLines()
+      .toString();
+    const lines = block.split('\n');
+    expect(lines.map((line) => displayWidth(line))).toEqual([6, 6, 6]);
+    expect(lines[0]).toBe('\x1b[44mab    \x1b[0m');
+  });
+
+  test('pads to a given width', () => {
+    expect(red('a\nb').padLines(3).toString()).toBe('\x1b[31ma  \x1b[0m\n\x1b[31mb  \x1b[0m');
+    // padding doesn't cut longer lines
+    expect(stripAnsi(red('abcd\nb').padLines(2).toString())).toBe('abcd\nb ');
+  });
+
+  test('pads empty lines', () => {
+    expect(red('a\n\nb').padLines().toString()).toBe(
+      '\x1b[31ma\x1b[0m\n\x1b[31m \x1b[0m\n\x1b[31mb\x1b[0m'
+    );
+  });
+
+  test('pads plain text for the Ascii profile', () => {
+    expect(new Style(Profile.Ascii, 'ab\nc').bold().padLines().toString()).toBe('ab\nc ');
+  });
+});
+
+describe('links on multiple lines', () => {
+  test('opens the hyperlink on every line', () => {
+    const style = red('a\nb').link('https://x', { id: 'l' }).perLine();
+    expect(style.toString()).toBe(
+      '\x1b]8;id=l;https://x\x1b\\\x1b[31ma\x1b[0m\x1b]8;;\x1b\\\n' +
+        '\x1b]8;id=l;https://x\x1b\\\x1b[31mb\x1b[0m\x1b]8;;\x1b\\'
+    );
+  });
+
+  test('renders the fallback once', () => {
+    const style = new Style(Profile.Ascii, 'a\nb').link('https://x').perLine();
+    expect(style.toString()).toBe('a\nb (https://x)');
+  });
+});
+
+describe('withLineMode', () => {
+  test('applies to styles of the output', () => {
+    const output = newMemoryOutput(withProfile(Profile.ANSI), withLineMode('lines'));
+    expect(output.string('a\nb').italic().toString()).toBe('\x1b[3ma\x1b[0m\n\x1b[3mb\x1b[0m');
+  });
+});
@@ -0,0 +1,156 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  newOutput,
+  withEnvironment,
+  withHyperlinks,
+  withLinkFallback,
+  withProfile,
+  withTTY,
+} from '#src/output.js';
+import { newMemoryOutput } from '#src/recording.js';
+import { DefaultLinkFallback, Style } from '#src/style.js';
+import { ANSIColor, Profile } from '#src/types.js';
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+describe('Style.link', () => {
+  test('wraps the styled text in OSC 8', () => {
+    const style = new Style(Profile.TrueColor, 'docs').link('https://example.com');
+    expect(style.toString()).toBe('\x1b]8;;https://example.com\x1b\\docs\x1b]8;;\x1b\\');
+  });
+
+  test('encloses the SGR sequences', () => {
+    const style = new Style(Profile.ANSI, 'docs')
+      .bold()
+      .foreground(new ANSIColor(1))
+      .link('https://example.com');
+    expect(style.toString()).toBe(
+      '\x1b]8;;https://example.com\x1b\\\x1b[1;31mdocs\x1b[0m\x1b]8;;\x1b\\'
+    );
+  });
+
+  test('keeps the link when more styles are added', () => {
+    const style = new Style(Profile.ANSI, 'docs').link('https://example.com').italic();
+    expect(style.toString()).toBe(
+      '\x1b]8;;https://example.com\x1b\\\x1b[3mdocs\x1b[0m\x1b]8;;\x1b\\'
+    );
+  });
+
+  test('renders the id and params', () => {
+    const style = new Style(Profile.TrueColor, 'a').link('https://example.com', {
+      id: 'ref-1',
+      params: { lang: 'en' },
+    });
+    expect(style.toString()).toBe(
+      '\x1b]8;id=ref-1:lang=en;https://example.com\x1b\\a\x1b]8;;\x1b\\'
+    );
+  });
+
+  test('sanitizes urls and params', () => {
+    const style = new Style(Profile.TrueColor, 'a').link('https://example.com/a b\x07é', {
+      id: 'x:y;z=\x1b',
+    });
+    expect(style.toString()).toContain('\x1b]8;id=xyz;https://example.com/a%20b%07%C3%A9\x1b\\');
+  });
+
+  test('an empty url removes the link', () => {
+    const style = new Style(Profile.TrueColor, 'a').link('https://example.com').link('');
+    expect(style.hyperlink).toBeNull();
+    expect(style.toString()).toBe('a');
+  });
+
+  test('does not modify the original style', () => {
+    const style = new Style(Profile.TrueColor, 'a');
+    style.link('https://example.com');
+    expect(style.hyperlink).toBeNull();
+  });
+});
+
+describe('link fallback', () => {
+  test('the Ascii profile renders text (url)', () => {
+    const style = new Style(Profile.Ascii, 'docs').bold().link('https://example.com');
+    expect(style.toString()).toBe('docs (https://example.com)');
+  });
+
+  test('unsupported links keep their colors', () => {
+    const style = new Style(Profile.ANSI, 'docs').bold().link('https://example.com');
+    style.linksSupported = false;
+    expect(style.toString()).toBe('\x1b[1mdocs (https://example.com)\x1b[0m');
+  });
+
+  test('the default fallback does not repeat a bare url', () => {
+    expect(DefaultLinkFallback('https://example.com', 'https://example.com')).toBe(
+      'https://example.com'
+    );
+    expect(DefaultLinkFallback('docs', 'https://example.com')).toBe('docs (https://example.com)');
+  });
+
+  test('a custom fallback replaces the default', () => {
+    const style = new Style(Profile.Ascii, 'docs').link('https://example.com');
+    style.linkFallback = (text, url) => `[${text}](${url})`;
+    expect(style.toString()).toBe('[docs](https://example.com)');
+  });
+});
+
+describe('output hyperlink support', () => {
+  test('terminals support hyperlinks', () => {
+    const output = newOutput(
+      process.stdout,
+      withTTY(true),
+      withEnvironment(new MockEnviron({ TERM: 'xterm-256color' }))
+    );
+    expect(output.hyperlinksSupported()).toBe(true);
+    expect(output.string('docs').link('https://example.com').toString()).toContain('\x1b]8;;');
+  });
+
+  test('the linux console and dumb terminals do not', () => {
+    for (const term of ['linux', 'dumb']) {
+      const output = newOutput(
+        process.stdout,
+        withTTY(true),
+        withEnvironment(new MockEnviron({ TERM: term }))
+      );
+      expect(output.hyperlinksSupported()).toBe(false);
+    }
+  });
+
+  test('piped output falls back to plain text', () => {
+    const output = newMemoryOutput(withProfile(Profile.ANSI));
+    expect(output.hyperlinksSupported()).toBe(false);
+    expect(output.string('docs').link('https://example.com').toString()).toBe(
+      'docs (https://example.com)'
+    );
+  });
+
+  test('withHyperlinks overrides detection', () => {
+    const output = newMemoryOutput(withProfile(Profile.ANSI), withHyperlinks(true));
+    expect(output.hyperlinksSupported()).toBe(true);
+    expect(output.string('docs').link('https://example.com').toString()).toBe(
+      '\x1b]8;;https://example.com\x1b\\docs\x1b]8;;\x1b\\'
+    );
+
+    output.setHyperlinks(null);
+    expect(output.hyperlinksSupported()).toBe(false);
+  });
+
+  test('withLinkFallback sets the fallback of new styles', () => {
+    const output = newMemoryOutput(
+      withProfile(Profile.Ascii),
+      withLinkFallback((text, url) => `${text} <${url}>`)
+    );
+    expect(output.string('docs').link('https://example.com').toString()).toBe(
+      'docs <https://example.com>'
+    );
+  });
+});
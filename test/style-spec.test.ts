@@ -0,0 +1,208 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  defaultOutputInstance,
+  newOutput,
+  setDefaultOutput,
+  withEnvironment,
+  withTTY,
+} from '#src/output.js';
+import { Style } from '#src/style.js';
+import { newStyleSpec, StyleSpec } from '#src/style-spec.js';
+import { ANSI256Color, ANSIColor, NoColor, Profile, RGBColor } from '#src/types.js';
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+describe('StyleSpec rendering', () => {
+  test('renders any text with the same look', () => {
+    const spec = newStyleSpec().bold().foreground(new ANSIColor(1));
+    expect(spec.render('a', Profile.ANSI)).toBe('\x1b[31;1ma\x1b[0m');
+    expect(spec.render('b', Profile.ANSI)).toBe('\x1b[31;1mb\x1b[0m');
+  });
+
+  test('converts colors to the profile', () => {
+    const spec = newStyleSpec({ foreground: new RGBColor('#ff0000') });
+    expect(spec.render('x', Profile.TrueColor)).toBe('\x1b[38;2;255;0;0mx\x1b[0m');
+    expect(spec.render('x', Profile.ANSI256)).toBe('\x1b[38;5;196mx\x1b[0m');
+    expect(spec.render('x', Profile.ANSI)).toBe('\x1b[91mx\x1b[0m');
+    expect(spec.render('x', Profile.Ascii)).toBe('x');
+  });
+
+  test('matches the equivalent Style chain', () => {
+    const spec = newStyleSpec({
+      foreground: new ANSI256Color(200),
+      background: new ANSIColor(4),
+      italic: true,
+      crossOut: true,
+    });
+    const style = new Style(Profile.ANSI256, 'text')
+      .foreground(new ANSI256Color(200))
+      .background(new ANSIColor(4))
+      .italic()
+      .crossOut();
+    expect(spec.render('text', Profile.ANSI256)).toBe(style.toString());
+  });
+
+  test('renders every attribute', () => {
+    const spec = newStyleSpec({
+      bold: true,
+      faint: true,
+      italic: true,
+      underline: true,
+      overline: true,
+      blink: true,
+      reverse: true,
+      crossOut: true,
+    });
+    expect(spec.render('x', Profile.ANSI)).toBe('\x1b[1;2;3;4;53;5;7;9mx\x1b[0m');
+  });
+
+  test('an empty spec leaves text unchanged', () => {
+    expect(newStyleSpec().render('plain', Profile.TrueColor)).toBe('plain');
+    expect(newStyleSpec({ foreground: new NoColor() }).render('plain', Profile.ANSI)).toBe('plain');
+  });
+
+  test('apply keeps the settings of the output', () => {
+    const output = newOutput(
+      process.stdout,
+      withTTY(true),
+      withEnvironment(new MockEnviron({ TERM: 'xterm-kitty', COLORTERM: 'truecolor' }))
+    );
+    const spec = newStyleSpec({ underline: 'curly', underlineColor: new ANSIColor(1) });
+    expect(spec.apply(output.string('typo')).toString()).toBe('\x1b[4:3;58;5;1mtypo\x1b[0m');
+    expect(spec.render('typo', Profile.TrueColor)).toBe('\x1b[4mtypo\x1b[0m');
+  });
+
+  test('renders for the default output without a profile', () => {
+    const previous = defaultOutputInstance();
+    const spec = newStyleSpec({ underline: 'curly', foreground: new RGBColor('#ff0000') });
+    try {
+      setDefaultOutput(newOutput(process.stdout, withTTY(false)));
+      expect(spec.render('typo')).toBe('typo');
+      expect(newStyleSpec().link('https://example.com').render('docs')).toBe(
+        'docs (https://example.com)'
+      );
+
+      setDefaultOutput(
+        newOutput(
+          process.stdout,
+          withTTY(true),
+          withEnvironment(new MockEnviron({ TERM: 'xterm-kitty', COLORTERM: 'truecolor' }))
+        )
+      );
+      expect(spec.render('typo')).toBe('\x1b[38;2;255;0;0;4:3mtypo\x1b[0m');
+      expect(spec.wrap('typo')).toBe(spec.render('typo'));
+    } finally {
+      setDefaultOutput(previous);
+    }
+  });
+
+  test('renders links', () => {
+    const spec = newStyleSpec().link('https://example.com');
+    expect(spec.render('docs', Profile.Ascii)).toBe('docs (https://example.com)');
+    expect(spec.render('docs', Profile.TrueColor)).toBe(
+      '\x1b]8;;https://example.com\x1b\\docs\x1b]8;;\x1b\\'
+    );
+  });
+});
+
+describe('StyleSpec composition', () => {
+  const base = newStyleSpec({ foreground: new ANSIColor(2), bold: true });
+
+  test('with overrides attributes', () => {
+    const spec = base.with({ foreground: new ANSIColor(3), italic: true });
+    expect(spec.attributes()).toEqual({
+      foreground: new ANSIColor(3),
+      bold: true,
+      italic: true,
+    });
+    expect(base.attributes()).toEqual({ foreground: new ANSIColor(2), bold: true });
+  });
+
+  test('false and null turn inherited attributes off', () => {
+    const spec = newStyleSpec({ bold: false, foreground: null }).inherit(base);
+    expect(spec.render('x', Profile.ANSI)).toBe('x');
+  });
+
+  test('inherit fills unset attributes from the parent', () => {
+    const child = newStyleSpec({ underline: true, foreground: new ANSIColor(5) }).inherit(base);
+    expect(child.attributes()).toEqual({
+      foreground: new ANSIColor(5),
+      bold: true,
+      underline: true,
+    });
+  });
+
+  test('merge lets the other spec win', () => {
+    const other = newStyleSpec({ foreground: new ANSIColor(6) });
+    expect(base.merge(other).attributes().foreground).toEqual(new ANSIColor(6));
+    expect(other.merge(base).attributes().foreground).toEqual(new ANSIColor(2));
+  });
+
+  test('unset removes attributes', () => {
+    const spec = base.unset('bold');
+    expect(spec.attributes()).toEqual({ foreground: new ANSIColor(2) });
+    expect(spec.inherit(newStyleSpec({ bold: true }))).toBe(base);
+  });
+});
+
+describe('StyleSpec equality', () => {
+  test('equal specs are the same object', () => {
+    const a = newStyleSpec().bold().foreground(new RGBColor('#ABCDEF'));
+    const b = newStyleSpec({ foreground: new RGBColor('#abcdef'), bold: true });
+    expect(a).toBe(b);
+    expect(a.equals(b)).toBe(true);
+    expect(a.key()).toBe(b.key());
+  });
+
+  test('different specs differ', () => {
+    const specs = [
+      newStyleSpec(),
+      newStyleSpec({ bold: true }),
+      newStyleSpec({ bold: false }),
+      newStyleSpec({ foreground: new ANSIColor(1) }),
+      newStyleSpec({ foreground: new ANSI256Color(1) }),
+      newStyleSpec({ background: new ANSIColor(1) }),
+      newStyleSpec({ underline: 'double' }),
+      newStyleSpec().link('https://example.com'),
+      newStyleSpec().link('https://example.com', { id: 'a' }),
+    ];
+    expect(new Set(specs).size).toBe(specs.length);
+    expect(new Set(specs.map((s) => s.key())).size).toBe(specs.length);
+  });
+
+  test('equivalent values are normalized', () => {
+    expect(newStyleSpec({ underline: 'single' })).toBe(newStyleSpec({ underline: true }));
+    expect(newStyleSpec({ underline: 'none' })).toBe(newStyleSpec({ underline: false }));
+    expect(newStyleSpec({ bold: undefined })).toBe(newStyleSpec());
+    const ab = newStyleSpec().link('https://example.com', { params: { a: '1', b: '2' } });
+    const ba = newStyleSpec().link('https://example.com', { params: { b: '2', a: '1' } });
+    expect(ab).toBe(ba);
+  });
+
+  test('specs work as map keys', () => {
+    const counts = new Map<StyleSpec, number>();
+    for (let i = 0; i < 3; i++) {
+      const spec = newStyleSpec().italic().foreground(new ANSIColor(4));
+      counts.set(spec, (counts.get(spec) ?? 0) + 1);
+    }
+    expect(counts.size).toBe(1);
+    expect([...counts.values()]).toEqual([3]);
+  });
+
+  test('specs are immutable', () => {
+    const spec = newStyleSpec({ bold: true });
+    expect(Object.isFrozen(spec.attributes())).toBe(true);
+    expect(StyleSpec.create({ bold: true })).toBe(spec);
+  });
+});
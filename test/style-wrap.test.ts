@@ -0,0 +1,85 @@
+import { describe, expect, test } from 'bun:test';
+import { stripAnsi } from '#src/ansi.js';
+import { Style } from '#src/style.js';
+import { newStyleSpec } from '#src/style-spec.js';
+import { ANSI256Color, ANSIColor, Profile, RGBColor } from '#src/types.js';
+
+const red = (p: Profile) => new Style(p).foreground(new ANSIColor(1));
+const bold = (p: Profile, text: string) => new Style(p, text).bold().toString();
+
+describe('Style.wrap', () => {
+  test('re-applies the outer style after inner resets', () => {
+    const line = red(Profile.ANSI).wrap(`error: ${bold(Profile.ANSI, 'disk')} is full`);
+    expect(line).toBe('\x1b[31merror: \x1b[1mdisk\x1b[0;31m is full\x1b[0m');
+  });
+
+  test('styled keeps the Go behavior', () => {
+    const line = red(Profile.ANSI).styled(`error: ${bold(Profile.ANSI, 'disk')} is full`);
+    expect(line).toBe('\x1b[31merror: \x1b[1mdisk\x1b[0m is full\x1b[0m');
+  });
+
+  test('handles several levels of nesting', () => {
+    const inner = new Style(Profile.ANSI).underline().wrap(`a${bold(Profile.ANSI, 'b')}c`);
+    const outer = red(Profile.ANSI).wrap(`x${inner}y`);
+    expect(outer).toBe('\x1b[31mx\x1b[4ma\x1b[1mb\x1b[0;4;31mc\x1b[0;31my\x1b[0m');
+  });
+
+  test('does not restore attributes the content sets again', () => {
+    const line = red(Profile.ANSI).wrap('a\x1b[0;1;32mb\x1b[mc');
+    expect(line).toBe('\x1b[31ma\x1b[0;1;32mb\x1b[;31mc\x1b[0m');
+  });
+
+  test('does not mistake color arguments for resets', () => {
+    const content = 'a\x1b[38;5;0mb\x1b[48;2;0;0;0mc\x1b[38:5:0md';
+    expect(red(Profile.ANSI).wrap(content)).toBe(`\x1b[31m${content}\x1b[0m`);
+  });
+
+  test('leaves non-SGR sequences alone', () => {
+    const content = 'a\x1b[>4;0mb\x1b[2Kc';
+    expect(red(Profile.ANSI).wrap(content)).toBe(`\x1b[31m${content}\x1b[0m`);
+  });
+
+  test('does not re-apply after a trailing reset', () => {
+    const line = red(Profile.ANSI).wrap(`see ${bold(Profile.ANSI, 'this')}`);
+    expect(line).toBe('\x1b[31msee \x1b[1mthis\x1b[0m\x1b[0m');
+  });
+
+  test('works with every color profile', () => {
+    const outer = new Style(Profile.TrueColor).foreground(new RGBColor('#ff8800'));
+    expect(outer.wrap(`a${bold(Profile.TrueColor, 'b')}c`)).toBe(
+      '\x1b[38;2;255;136;0ma\x1b[1mb\x1b[0;38;2;255;136;0mc\x1b[0m'
+    );
+
+    const outer256 = new Style(Profile.ANSI256).background(new ANSI256Color(57));
+    expect(outer256.wrap(`a${bold(Profile.ANSI256, 'b')}c`)).toBe(
+      '\x1b[48;5;57ma\x1b[1mb\x1b[0;48;5;57mc\x1b[0m'
+    );
+
+    const content = `a${bold(Profile.Ascii, 'b')}c`;
+    expect(red(Profile.Ascii).wrap(content)).toBe('abc');
+  });
+
+  test('keeps the visible text unchanged', () => {
+    const content = `${bold(Profile.ANSI, 'one')} two ${bold(Profile.ANSI, 'three')}`;
+    expect(stripAnsi(red(Profile.ANSI).wrap(content))).toBe('one two three');
+  });
+
+  test('unstyled styles return the content', () => {
+    const content = `a${bold(Profile.ANSI, 'b')}c`;
+    expect(new Style(Profile.ANSI).wrap(content)).toBe(content);
+  });
+
+  test('wraps links around the nested content', () => {
+    const style = red(Profile.ANSI).link('https://example.com');
+    expect(style.wrap(`a${bold(Profile.ANSI, 'b')}c`)).toBe(
+      '\x1b]8;;https://example.com\x1b\\\x1b[31ma\x1b[1mb\x1b[0;31mc\x1b[0m\x1b]8;;\x1b\\'
+    );
+  });
+
+  test('style specs wrap content too', () => {
+    const spec = newStyleSpec({ foreground: new ANSIColor(2) });
+    expect(spec.wrap(`a${bold(Profile.ANSI, 'b')}c`, Profile.ANSI)).toBe(
+      '\x1b[32ma\x1b[1mb\x1b[0;32mc\x1b[0m'
+    );
+  });
+});
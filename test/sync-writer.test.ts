@@ -0,0 +1,104 @@
+import { afterEach, beforeEach, describe, expect, test } from 'bun:test';
+import { closeSync, mkdtempSync, openSync, readFileSync, rmSync, writeSync } from 'node:fs';
+import { tmpdir } from 'node:os';
+import { join } from 'node:path';
+import { PassThrough } from 'node:stream';
+import {
+  newOutput,
+  withBuffering,
+  withErrorHandler,
+  withSyncWriter,
+  withTTY,
+} from '#src/output.js';
+
+describe('sync writer', () => {
+  let dir: string;
+  let path: string;
+  let fd: number;
+
+  beforeEach(() => {
+    dir = mkdtempSync(join(tmpdir(), 'termenv-'));
+    path = join(dir, 'out');
+    fd = openSync(path, 'w');
+  });
+
+  afterEach(() => {
+    closeSync(fd);
+    rmSync(dir, { recursive: true });
+  });
+
+  test('writes are complete when the call returns', () => {
+    const output = newOutput(process.stdout, withTTY(true), withSyncWriter(fd));
+
+    output.hideCursor();
+    expect(readFileSync(path, 'utf8')).toBe('\x1b[?25l');
+    output.writeString('héllo');
+    expect(readFileSync(path, 'utf8')).toBe('\x1b[?25lhéllo');
+  });
+
+  test('interleaves with other synchronous writes to the descriptor', () => {
+    const output = newOutput(process.stdout, withTTY(true), withSyncWriter(fd));
+
+    // what console.log does when stdout is a file or a terminal
+    output.hideCursor();
+    writeSync(fd, 'progress 1\n');
+    output.cursorUp(1);
+    output.clearLine();
+    writeSync(fd, 'progress 2\n');
+    output.showCursor();
+
+    expect(readFileSync(path, 'utf8')).toBe(
+      '\x1b[?25lprogress 1\n\x1b[1A\x1b[2Kprogress 2\n\x1b[?25h'
+    );
+  });
+
+  test('stream writers give no such guarantee', async () => {
+    // a stream that's busy queues writes until it drains
+    const stream = new PassThrough({ highWaterMark: 1 });
+    const output = newOutput(stream, withTTY(true));
+    stream.cork();
+
+    output.hideCursor();
+    expect(stream.read()).toBeNull();
+
+    stream.uncork();
+    await new Promise((resolve) => setTimeout(resolve, 1));
+    expect(stream.read()?.toString()).toBe('\x1b[?25l');
+  });
+
+  test('flushes buffered output synchronously', async () => {
+    const output = newOutput(process.stdout, withTTY(true), withSyncWriter(fd), withBuffering());
+
+    output.clearScreen();
+    output.moveCursor(1, 1);
+    expect(readFileSync(path, 'utf8')).toBe('');
+
+    const flushed = output.flush();
+    expect(readFileSync(path, 'utf8')).toBe('\x1b[2J\x1b[1;1H');
+    await flushed;
+  });
+
+  test('detects terminals from the descriptor', () => {
+    const output = newOutput(process.stdout, withSyncWriter(fd));
+    expect(output.fd()).toBe(fd);
+    expect(output.isTTY()).toBe(false);
+
+    output.setSyncWriter(null);
+    expect(output.fd()).toBeNull();
+  });
+
+  test('reports write errors to the error handler', async () => {
+    const errors: Error[] = [];
+    const output = newOutput(
+      process.stdout,
+      withTTY(true),
+      withSyncWriter(-1),
+      withErrorHandler((err) => errors.push(err))
+    );
+
+    output.showCursor();
+    await new Promise((resolve) => setTimeout(resolve, 1));
+    expect(errors.length).toBe(1);
+    await expect(output.writeString('x')).rejects.toThrow();
+  });
+});
@@ -0,0 +1,148 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  newOutput,
+  parseModeReport,
+  withEnvironment,
+  withInput,
+  withStatusReportTimeout,
+  withTTY,
+} from '#src/output.js';
+import { FakeTerminal } from '#test/utils/fake-tty.js';
+
+const begin = '\x1b[?2026h';
+const end = '\x1b[?2026l';
+const decrqm = '\x1b[?2026$p';
+const da1 = '\x1b[c';
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+function newTerminalOutput(term: FakeTerminal) {
+  return newOutput(
+    term as any,
+    withTTY(true),
+    withInput(term.input),
+    withEnvironment(new MockEnviron({ TERM: 'xterm-256color' })),
+    withStatusReportTimeout(50)
+  );
+}
+
+describe('withSynchronizedOutput', () => {
+  test('brackets the output of fn', () => {
+    const term = new FakeTerminal();
+    const output = newTerminalOutput(term);
+
+    const result = output.withSynchronizedOutput(() => {
+      output.clearScreen();
+      output.writeString('frame');
+      return 42;
+    });
+
+    expect(result).toBe(42);
+    expect(term.output).toEqual([begin, '\x1b[2J', 'frame', end]);
+  });
+
+  test('closes the bracket when fn throws', () => {
+    const term = new FakeTerminal();
+    const output = newTerminalOutput(term);
+
+    expect(() =>
+      output.withSynchronizedOutput(() => {
+        output.writeString('partial');
+        throw new Error('draw failed');
+      })
+    ).toThrow('draw failed');
+    expect(term.output).toEqual([begin, 'partial', end]);
+  });
+
+  test('closes the bracket when an async fn settles', async () => {
+    const term = new FakeTerminal();
+    const output = newTerminalOutput(term);
+
+    const frame = output.withSynchronizedOutput(async () => {
+      await new Promise((resolve) => setTimeout(resolve, 1));
+      output.writeString('frame');
+      return 'done';
+    });
+    expect(term.output).toEqual([begin]);
+    expect(await frame).toBe('done');
+    expect(term.output).toEqual([begin, 'frame', end]);
+
+    term.clear();
+    await expect(
+      output.withSynchronizedOutput(async () => {
+        throw new Error('draw failed');
+      })
+    ).rejects.toThrow('draw failed');
+    expect(term.output).toEqual([begin, end]);
+  });
+
+  test('nested calls share the outer bracket', () => {
+    const term = new FakeTerminal();
+    const output = newTerminalOutput(term);
+
+    output.withSynchronizedOutput(() => {
+      output.withSynchronizedOutput(() => {
+        output.writeString('inner');
+      });
+      output.writeString('outer');
+    });
+    expect(term.output).toEqual([begin, 'inner', 'outer', end]);
+  });
+});
+
+describe('supportsSynchronizedOutput', () => {
+  test('parses DECRPM replies', () => {
+    expect(parseModeReport('\x1b[?2026;2$y')).toEqual({ mode: 2026, value: 2 });
+    expect(parseModeReport('\x1b[?2026;0$y')).toEqual({ mode: 2026, value: 0 });
+    expect(parseModeReport('\x1b[2026;2$y')).toBeNull();
+    expect(parseModeReport('\x1b[?2026$y')).toBeNull();
+    expect(parseModeReport('\x1b[?62;22c')).toBeNull();
+  });
+
+  test('reports terminals that know mode 2026', async () => {
+    for (const value of [1, 2, 3]) {
+      const term = new FakeTerminal({ [da1]: `\x1b[?2026;${value}$y\x1b[?62;22c` });
+      const output = newTerminalOutput(term);
+
+      expect(await output.supportsSynchronizedOutput()).toBe(true);
+      expect(term.output).toEqual([decrqm, da1]);
+    }
+  });
+
+  test('reports unrecognized and permanently reset modes as unsupported', async () => {
+    for (const value of [0, 4]) {
+      const term = new FakeTerminal({ [da1]: `\x1b[?2026;${value}$y\x1b[?62;22c` });
+      expect(await newTerminalOutput(term).supportsSynchronizedOutput()).toBe(false);
+    }
+  });
+
+  test('terminals ignoring DECRQM are unsupported', async () => {
+    const term = new FakeTerminal({ [da1]: '\x1b[?1;2c' });
+    expect(await newTerminalOutput(term).supportsSynchronizedOutput()).toBe(false);
+  });
+
+  test('silent terminals are unsupported', async () => {
+    const term = new FakeTerminal();
+    expect(await newTerminalOutput(term).supportsSynchronizedOutput()).toBe(false);
+  });
+
+  test('non-terminals are unsupported without writing anything', async () => {
+    const term = new FakeTerminal();
+    const output = newOutput(term as any, withTTY(false), withInput(term.input));
+    term.isTTY = false;
+
+    expect(await output.supportsSynchronizedOutput()).toBe(false);
+    expect(term.output).toEqual([]);
+  });
+});
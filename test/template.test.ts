@@ -0,0 +1,187 @@
+import { describe, expect, test } from 'bun:test';
+import { TemplateFuncs } from '#src/go-style.js';
+import { newTemplate, sprintf, TemplateError } from '#src/template.js';
+import { templateFuncs } from '#src/template-funcs.js';
+import { Profile, TermEnvError } from '#src/types.js';
+
+function run(text: string, data?: unknown): string {
+  return newTemplate('test').parse(text).execute(data);
+}
+
+describe('template actions', () => {
+  test('prints values', () => {
+    expect(run('a {{ . }} b', 'x')).toBe('a x b');
+    expect(run('{{ .Name }} {{ .Missing }}', { Name: 'n' })).toBe('n <no value>');
+    expect(run('{{ . }} {{ print nil }}', [1, 'a'])).toBe('[1 a] <nil>');
+    expect(run('{{ . }}', { b: 2, a: { c: true } })).toBe('map[a:map[c:true] b:2]');
+  });
+
+  test('parses literals', () => {
+    expect(run('{{ "a\\tb" }}|{{ `raw\\n` }}|{{ \'a\' }}|{{ 0x1F }}|{{ -3 }}|{{ 1.5 }}')).toBe(
+      'a\tb|raw\\n|97|31|-3|1.5'
+    );
+  });
+
+  test('trims whitespace and skips comments', () => {
+    expect(run('a  {{- /* note */ -}}  b {{- "c" }} {{ "d" -}}\n e')).toBe('abc de');
+    expect(run('{{/* only a comment */}}')).toBe('');
+  });
+
+  test('branches', () => {
+    const text = '{{ if eq . 1 }}one{{ else if eq . 2 }}two{{ else }}many{{ end }}';
+    expect([1, 2, 3].map((n) => run(text, n))).toEqual(['one', 'two', 'many']);
+    // empty arrays and maps are false
+    const empty = '{{ if .L }}y{{ else }}n{{ end }}{{ if .M }}y{{ else }}n{{ end }}';
+    expect(run(empty, { L: [], M: {} })).toBe('nn');
+    expect(run('{{ with .U }}{{ .Name }}{{ else }}none{{ end }}', { U: { Name: 'bob' } })).toBe(
+      'bob'
+    );
+  });
+
+  test('ranges', () => {
+    expect(run('{{ range $i, $e := . }}{{ $i }}={{ $e }};{{ end }}', ['a', 'b'])).toBe('0=a;1=b;');
+    expect(run('{{ range $k, $v := . }}{{ $k }}:{{ $v }} {{ end }}', { b: 2, a: 1 })).toBe(
+      'a:1 b:2 '
+    );
+    expect(run('{{ range . }}{{ . }}{{ else }}none{{ end }}', [])).toBe('none');
+    expect(run('{{ range 3 }}{{ . }}{{ end }}')).toBe('012');
+  });
+
+  test('scopes variables', () => {
+    expect(run('{{ $x := 1 }}{{ if true }}{{ $x = 2 }}{{ end }}{{ $x }}')).toBe('2');
+    expect(run('{{ range .L }}{{ $.Title }}{{ end }}', { Title: 't', L: [1, 2] })).toBe('tt');
+    expect(() => run('{{ if true }}{{ $y := 1 }}{{ end }}{{ $y }}')).toThrow('undefined variable');
+  });
+
+  test('pipes and calls methods', () => {
+    const data = { F: (a: string, b: string) => a + b, S: 'abc' };
+    expect(run('{{ "x" | .F "y" }} {{ .S | len | printf "%d chars" }}', data)).toBe(
+      'yx 3 chars'
+    );
+    expect(run('{{ (len .S) }} {{ print (index .L 1) }}', { S: 'ab', L: [5, 6] })).toBe('2 6');
+  });
+});
+
+describe('template functions', () => {
+  test('logic and comparison', () => {
+    expect(run('{{ and 1 0 }} {{ or 0 "" "z" }} {{ not 1 }}')).toBe('0 z false');
+    expect(run('{{ lt 1 2 }} {{ ge "a" "b" }} {{ eq "a" "b" "a" }} {{ ne true false }}')).toBe(
+      'true false true true'
+    );
+    expect(() => run('{{ eq 1 "a" }}')).toThrow('incompatible types for comparison');
+  });
+
+  test('formats like fmt', () => {
+    expect(run('{{ print 1 2 "a" 3 }}|{{ println "a" 1 }}')).toBe('1 2a3|a 1\n');
+    const args = [3.14159, 'ab', 7, 'hi', 255, 'hi', true, 65];
+    expect(sprintf('%05.1f|%-4s|%3d|%q|%x|%X|%t|%c|%%', ...args)).toBe(
+      '003.1|ab  |  7|"hi"|ff|6869|true|A|%'
+    );
+    expect(sprintf('%+d %d %s', 5, 'x')).toBe('+5 %!d(x) %!s(MISSING)');
+  });
+
+  test('escapes', () => {
+    expect(run(`{{ html "<a href='x'>&" }}`)).toBe('&lt;a href=&#39;x&#39;&gt;&amp;');
+    expect(run('{{ urlquery "a b&c!" }}')).toBe('a+b%26c%21');
+  });
+
+  test('unquotes strings and character constants like Go', () => {
+    expect(run('{{ "a\\tb\\u00e9\\U0001F600\\"" }}')).toBe('a\tbé😀"');
+    // \x and octal escapes are bytes of UTF-8
+    expect(run('{{ "\\xc3\\xa9|\\303\\251|\\x41" }}')).toBe('é|é|A');
+    expect(run('{{ len "\\xc3\\xa9" }}')).toBe('2');
+    expect(run("{{ print 'a' '\\n' '\\'' '\\xff' '\\377' 'é' }}")).toBe('97 10 39 255 255 233');
+  });
+
+  test('len counts bytes of strings', () => {
+    expect(run('{{ len "héllo" }} {{ len . }}', { a: 1, b: 2 })).toBe('6 2');
+  });
+});
+
+describe('template errors', () => {
+  test('parse errors name the template and line', () => {
+    const parse = (text: string) => () => newTemplate('t').parse(text);
+    expect(parse('{{ nope }}')).toThrow('template: t:1: function "nope" not defined');
+    expect(parse('a\n{{ if 1 }}x')).toThrow('template: t:2: unexpected EOF in if');
+    expect(parse('{{ end }}')).toThrow('unexpected {{end}}');
+    expect(parse('{{ "a }}')).toThrow('unterminated quoted string');
+    expect(parse('{{ "\\q" }}')).toThrow('template: t:1: invalid syntax');
+    expect(parse('a\n{{ "\\x4" }}')).toThrow('template: t:2: invalid syntax');
+    expect(parse('{{ "\\400" }}')).toThrow(TemplateError);
+    expect(parse('{{ "\\uD800" }}')).toThrow(TemplateError);
+    expect(parse("{{ '\\\"' }}")).toThrow('invalid syntax');
+    expect(parse("{{ 'ab' }}")).toThrow("malformed character constant: 'ab'");
+    expect(parse('{{ 1')).toThrow('unclosed action');
+    expect(parse('{{ define "x" }}{{ end }}')).toThrow('not supported');
+  });
+
+  test('execution errors', () => {
+    expect(() => run('{{ .A.B.C }}', {})).toThrow(TemplateError);
+    expect(() => run('{{ nil }}')).toThrow('nil is not a command');
+    expect(() => run('{{ 1 | 2 }}')).toThrow("can't give argument to non-function 2");
+    expect(() => newTemplate('t').execute()).toThrow(TermEnvError);
+  });
+
+  test('functions must be added before parsing', () => {
+    const fn = () => 'ok';
+    expect(newTemplate('t').funcs({ fn }).parse('{{ fn }}').execute()).toBe('ok');
+    expect(() => newTemplate('t').parse('{{ fn }}').funcs({ fn })).toThrow(TemplateError);
+  });
+});
+
+describe('TemplateFuncs', () => {
+  function render(profile: Profile, text: string): string {
+    return newTemplate('t').funcs(templateFuncs(profile)).parse(text).execute();
+  }
+
+  test('colors', () => {
+    expect(render(Profile.TrueColor, '{{ Color "#ff0000" "#0000ff" "x" }}')).toBe(
+      '\x1b[38;2;255;0;0;48;2;0;0;255mx\x1b[0m'
+    );
+    expect(render(Profile.TrueColor, '{{ Color "#ff0000" "" "x" }}')).toBe(
+      '\x1b[38;2;255;0;0mx\x1b[0m'
+    );
+    expect(render(Profile.TrueColor, '{{ Color "x" }}')).toBe('x');
+    expect(render(Profile.ANSI, '{{ Foreground "1" "x" }}')).toBe('\x1b[31mx\x1b[0m');
+    expect(render(Profile.ANSI256, '{{ Background "#ff0000" "x" }}')).toBe(
+      '\x1b[48;5;196mx\x1b[0m'
+    );
+  });
+
+  test('styles', () => {
+    const names = ['Bold', 'Faint', 'Italic', 'Underline', 'Blink', 'Reverse', 'CrossOut'];
+    const codes = names.map((name) => render(Profile.ANSI, `{{ ${name} "x" }}`));
+    expect(codes).toEqual(['1', '2', '3', '4', '5', '7', '9'].map((c) => `\x1b[${c}mx\x1b[0m`));
+    expect(render(Profile.ANSI, '{{ Overline "x" }}')).toBe('\x1b[53mx\x1b[0m');
+    expect(render(Profile.ANSI, '{{ "x" | Bold | Italic }}')).toBe(
+      '\x1b[3m\x1b[1mx\x1b[0m\x1b[0m'
+    );
+  });
+
+  test('the Ascii profile returns text unchanged', () => {
+    const text = '{{ Color "#ff0000" "#0000ff" "x" }} {{ Bold "y" }}';
+    expect(render(Profile.Ascii, text)).toBe('x y');
+  });
+
+  test('arguments must be strings', () => {
+    expect(() => render(Profile.ANSI, '{{ Bold 1 }}')).toThrow(
+      'error calling Bold: interface conversion: interface {} is number, not string'
+    );
+  });
+
+  test('is exported Go-style', () => {
+    expect(Object.keys(TemplateFuncs(Profile.ANSI)).sort()).toEqual([
+      'Background',
+      'Blink',
+      'Bold',
+      'Color',
+      'CrossOut',
+      'Faint',
+      'Foreground',
+      'Italic',
+      'Overline',
+      'Reverse',
+      'Underline',
+    ]);
+  });
+});
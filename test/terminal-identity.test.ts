@@ -0,0 +1,184 @@
+import { describe, expect, test } from 'bun:test';
+import {
+  newOutput,
+  withEnvironment,
+  withInput,
+  withProfile,
+  withStatusReportTimeout,
+  withTerminalIdentity,
+  withTTY,
+} from '#src/output.js';
+import {
+  identify,
+  PrimaryDeviceAttributesQuery,
+  parsePrimaryDeviceAttributes,
+  parseSecondaryDeviceAttributes,
+  parseXTVersion,
+  profileFromIdentity,
+  SecondaryDeviceAttributesQuery,
+  XTVersionQuery,
+} from '#src/terminal-identity.js';
+import { Profile, StatusReportError } from '#src/types.js';
+import { FakeTerminal } from '#test/utils/fake-tty.js';
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+function newTerminalOutput(term: FakeTerminal, env: Record<string, string> = {}) {
+  return newOutput(
+    term as any,
+    withTTY(true),
+    withInput(term.input),
+    withEnvironment(new MockEnviron(env)),
+    withStatusReportTimeout(50)
+  );
+}
+
+describe('device attribute parsing', () => {
+  test('parses DA1 replies', () => {
+    expect(parsePrimaryDeviceAttributes('\x1b[?62;22;52c')).toEqual([62, 22, 52]);
+    expect(parsePrimaryDeviceAttributes('\x1b[?1;2c')).toEqual([1, 2]);
+    expect(parsePrimaryDeviceAttributes('\x1b[>1;2c')).toBeNull();
+    expect(parsePrimaryDeviceAttributes('\x1b[?1;xc')).toBeNull();
+  });
+
+  test('parses DA2 replies', () => {
+    expect(parseSecondaryDeviceAttributes('\x1b[>41;388;0c')).toEqual([41, 388, 0]);
+    expect(parseSecondaryDeviceAttributes('\x1b[?41;388;0c')).toBeNull();
+  });
+
+  test('parses XTVERSION replies', () => {
+    expect(parseXTVersion('\x1bP>|XTerm(388)\x1b\\')).toBe('XTerm(388)');
+    expect(parseXTVersion('\x1bP>|WezTerm 20220408\x1b\\')).toBe('WezTerm 20220408');
+    expect(parseXTVersion('\x1bP1$r0m\x1b\\')).toBeNull();
+  });
+});
+
+describe('identify', () => {
+  test('names the terminal from XTVERSION', () => {
+    const kitty = identify([62, 52], [1, 4000, 29], 'kitty(0.40.0)');
+    expect(kitty.name).toBe('kitty');
+    expect(kitty.version).toBe('0.40.0');
+    expect(kitty.level).toBe(62);
+    expect(kitty.features).toEqual(['clipboard']);
+
+    const wezterm = identify([65, 4, 6, 22], [], 'WezTerm 20220408-101518-b908e2dd');
+    expect(wezterm.name).toBe('wezterm');
+    expect(wezterm.version).toBe('20220408-101518-b908e2dd');
+    expect(wezterm.features).toEqual(['sixel', 'selectiveErase', 'ansiColor']);
+  });
+
+  test('falls back to the DA2 terminal type', () => {
+    const xterm = identify([64, 1, 2, 6, 22], [41, 388, 0]);
+    expect(xterm.name).toBe('xterm');
+    expect(xterm.version).toBe('388');
+    expect(xterm.secondary).toEqual([41, 388, 0]);
+
+    expect(identify([62], [1, 95, 0]).name).toBe('');
+  });
+
+  test('maps identities to profiles', () => {
+    expect(profileFromIdentity(identify([62], [], 'foot(1.13.1)'))).toBe(Profile.TrueColor);
+    expect(profileFromIdentity(identify([62], [65, 6800, 1]))).toBe(Profile.TrueColor);
+    expect(profileFromIdentity(identify([62], [84, 0, 0]))).toBe(Profile.ANSI256);
+    expect(profileFromIdentity(identify([62, 22], []))).toBe(Profile.ANSI);
+    expect(profileFromIdentity(identify([1, 2], []))).toBeNull();
+  });
+});
+
+describe('probeTerminal', () => {
+  const kittyReplies = {
+    [XTVersionQuery]: '\x1bP>|kitty(0.40.0)\x1b\\',
+    [SecondaryDeviceAttributesQuery]: '\x1b[>1;4000;29c',
+    [PrimaryDeviceAttributesQuery]: '\x1b[?62;52c',
+  };
+
+  test('identifies the terminal with a fake responder', async () => {
+    const term = new FakeTerminal(kittyReplies);
+    const output = newTerminalOutput(term);
+
+    const identity = await output.probeTerminal();
+    expect(identity.name).toBe('kitty');
+    expect(identity.secondary).toEqual([1, 4000, 29]);
+    expect(output.terminalIdentity()).toBe(identity);
+    expect(term.output).toEqual([
+      XTVersionQuery,
+      SecondaryDeviceAttributesQuery,
+      PrimaryDeviceAttributesQuery,
+    ]);
+    expect(term.input.rawModes).toEqual([true, false]);
+  });
+
+  test('upgrades an auto-detected profile stripped by sudo/ssh', async () => {
+    const term = new FakeTerminal(kittyReplies);
+    const output = newTerminalOutput(term);
+    expect(output.profile).toBe(Profile.Ascii);
+
+    await output.probeTerminal();
+    expect(output.colorProfile()).toBe(Profile.TrueColor);
+    expect(output.profile).toBe(Profile.TrueColor);
+  });
+
+  test('never downgrades the environment profile', async () => {
+    const term = new FakeTerminal({ [PrimaryDeviceAttributesQuery]: '\x1b[?62;22c' });
+    const output = newTerminalOutput(term, { COLORTERM: 'truecolor' });
+
+    const identity = await output.probeTerminal();
+    expect(identity.name).toBe('');
+    expect(output.colorProfile()).toBe(Profile.TrueColor);
+  });
+
+  test('keeps an explicitly set profile', async () => {
+    const term = new FakeTerminal(kittyReplies);
+    const output = newOutput(
+      term as any,
+      withTTY(true),
+      withInput(term.input),
+      withProfile(Profile.ANSI)
+    );
+
+    await output.probeTerminal();
+    expect(output.profile).toBe(Profile.ANSI);
+  });
+
+  test('works with terminals that only answer DA1', async () => {
+    const term = new FakeTerminal({ [PrimaryDeviceAttributesQuery]: '\x1b[?1;2c' });
+    const output = newTerminalOutput(term);
+
+    const identity = await output.probeTerminal();
+    expect(identity.level).toBe(1);
+    expect(identity.features).toEqual(['printer']);
+    expect(output.colorProfile()).toBe(Profile.Ascii);
+  });
+
+  test('rejects when the terminal does not answer', async () => {
+    const term = new FakeTerminal();
+    const output = newTerminalOutput(term);
+
+    await expect(output.probeTerminal()).rejects.toThrow(StatusReportError);
+    expect(output.terminalIdentity()).toBeNull();
+  });
+
+  test('a saved identity can be passed as an option', () => {
+    const term = new FakeTerminal();
+    const output = newOutput(
+      term as any,
+      withTTY(true),
+      withEnvironment(new MockEnviron({ TERM: 'xterm' })),
+      withTerminalIdentity(identify([62], [], 'ghostty 1.1.0'))
+    );
+
+    expect(output.terminalIdentity()?.name).toBe('ghostty');
+    expect(output.colorProfile()).toBe(Profile.TrueColor);
+  });
+});
@@ -0,0 +1,168 @@
+import { describe, expect, test } from 'bun:test';
+import { readFileSync } from 'node:fs';
+import { join } from 'node:path';
+import { newOutput, withEnvironment, withTTY } from '#src/output.js';
+import {
+  findTerminfo,
+  loadTerminfo,
+  parseTerminfo,
+  profileFromTerminfo,
+  Terminfo,
+  terminfoDirs,
+} from '#src/terminfo.js';
+import { Profile, TermEnvError } from '#src/types.js';
+
+// Compiled from fixtures/terminfo/fixtures.ti
+const fixtures = join(import.meta.dir, 'fixtures', 'terminfo');
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+function fixture(name: string): Terminfo {
+  return parseTerminfo(readFileSync(join(fixtures, name.charAt(0), name)));
+}
+
+describe('terminfo parsing', () => {
+  test('parses the legacy format', () => {
+    const ti = fixture('acme-256');
+    expect(ti.names).toEqual(['acme-256', 'ACME terminal with 256 colors']);
+    expect(ti.flag('am')).toBe(true);
+    expect(ti.flag('xenl')).toBe(true);
+    expect(ti.flag('bw')).toBe(false);
+    expect(ti.number('colors')).toBe(256);
+    expect(ti.number('pairs')).toBe(32767);
+    expect(ti.number('cols')).toBe(80);
+    expect(ti.number('lines')).toBe(24);
+    expect(ti.number('it')).toBe(-1);
+  });
+
+  test('parses the extended number format', () => {
+    const ti = fixture('acme-256color-direct');
+    expect(ti.number('colors')).toBe(0x1000000);
+    expect(ti.number('pairs')).toBe(0x10000);
+    expect(ti.flag('RGB')).toBe(true);
+    expect(ti.string('setrgbf')).toBe('\x1b[38;2;%p1%d;%p2%d;%p3%dm');
+    expect(ti.string('setrgbb')).toBe('\x1b[48;2;%p1%d;%p2%d;%p3%dm');
+    expect(ti.string('missing')).toBeNull();
+  });
+
+  test('parses extended booleans', () => {
+    const ti = fixture('vendorterm');
+    expect(ti.flag('Tc')).toBe(true);
+    expect(ti.number('colors')).toBe(256);
+  });
+
+  test('rejects data that is not terminfo', () => {
+    expect(() => parseTerminfo(new Uint8Array([0x12, 0x34, 0, 0]))).toThrow(TermEnvError);
+    expect(() => parseTerminfo(new Uint8Array([0x1a]))).toThrow(TermEnvError);
+  });
+});
+
+describe('terminfo lookup', () => {
+  test('searches TERMINFO, ~/.terminfo, TERMINFO_DIRS and the system directories', () => {
+    const dirs = terminfoDirs(
+      new MockEnviron({ TERMINFO: '/a', HOME: '/home/u', TERMINFO_DIRS: '/b::/c' })
+    );
+    expect(dirs).toEqual([
+      '/a',
+      '/home/u/.terminfo',
+      '/b',
+      '/etc/terminfo',
+      '/lib/terminfo',
+      '/usr/share/terminfo',
+      '/c',
+    ]);
+  });
+
+  test('finds entries in the first letter and hex layouts', () => {
+    expect(findTerminfo('acme-8', [fixtures])).toBe(join(fixtures, 'a', 'acme-8'));
+    expect(findTerminfo('hexterm', [fixtures])).toBe(join(fixtures, '68', 'hexterm'));
+    expect(findTerminfo('nonexistent', [fixtures])).toBeNull();
+    expect(findTerminfo('../a/acme-8', [fixtures])).toBeNull();
+    expect(findTerminfo('', [fixtures])).toBeNull();
+  });
+
+  test('earlier directories take precedence', () => {
+    expect(findTerminfo('acme-8', ['/nonexistent', fixtures])).toBe(join(fixtures, 'a', 'acme-8'));
+  });
+
+  test('loads entries from TERMINFO', () => {
+    const environ = new MockEnviron({ TERMINFO: fixtures });
+    expect(loadTerminfo('acme-8', environ)?.number('colors')).toBe(8);
+    expect(loadTerminfo('no-such-terminal', environ)).toBeNull();
+  });
+});
+
+describe('terminfo color profile', () => {
+  test('maps capabilities to profiles', () => {
+    expect(profileFromTerminfo(fixture('acme-256color-direct'))).toBe(Profile.TrueColor);
+    expect(profileFromTerminfo(fixture('vendorterm'))).toBe(Profile.TrueColor);
+    expect(profileFromTerminfo(fixture('acme-256'))).toBe(Profile.ANSI256);
+    expect(profileFromTerminfo(fixture('acme-8'))).toBe(Profile.ANSI);
+    expect(profileFromTerminfo(fixture('acme-mono'))).toBe(Profile.Ascii);
+  });
+
+  test('colorProfile falls back to terminfo for unknown terminals', () => {
+    const cases: [string, Profile][] = [
+      // the TERM name heuristics come first
+      ['acme-256color-direct', Profile.ANSI256],
+      ['vendorterm', Profile.TrueColor],
+      ['acme-256', Profile.ANSI256],
+      ['acme-8', Profile.ANSI],
+      ['acme-mono', Profile.Ascii],
+      ['hexterm', Profile.ANSI256],
+    ];
+
+    for (const [term, want] of cases) {
+      const output = newOutput(
+        process.stdout,
+        withTTY(true),
+        withEnvironment(new MockEnviron({ TERM: term, TERMINFO: fixtures }))
+      );
+      expect(output.colorProfile()).toBe(want);
+    }
+  });
+
+  test('environment variables still take precedence', () => {
+    const output = newOutput(
+      process.stdout,
+      withTTY(true),
+      withEnvironment(
+        new MockEnviron({ TERM: 'acme-mono', TERMINFO: fixtures, COLORTERM: 'truecolor' })
+      )
+    );
+    expect(output.colorProfile()).toBe(Profile.TrueColor);
+  });
+
+  test('looks entries up by the TERM name as is', () => {
+    const profile = (term: string) =>
+      newOutput(
+        process.stdout,
+        withTTY(true),
+        withEnvironment(new MockEnviron({ TERM: term, TERMINFO: fixtures }))
+      ).colorProfile();
+    expect(profile('Acmeterm')).toBe(Profile.ANSI256);
+    expect(profile('acmeterm')).toBe(Profile.Ascii);
+  });
+
+  test('missing entries keep the TERM name heuristics', () => {
+    const output = newOutput(
+      process.stdout,
+      withTTY(true),
+      withEnvironment(
+        new MockEnviron({ TERM: 'unknown-256color', TERMINFO: fixtures, TERMINFO_DIRS: fixtures })
+      )
+    );
+    expect(output.colorProfile()).toBe(Profile.ANSI256);
+  });
+});
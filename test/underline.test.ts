@@ -0,0 +1,140 @@
+import { describe, expect, test } from 'bun:test';
+import { join } from 'node:path';
+import {
+  newOutput,
+  withEnvironment,
+  withExtendedUnderline,
+  withProfile,
+  withTerminalIdentity,
+  withTTY,
+} from '#src/output.js';
+import { Style } from '#src/style.js';
+import { identify } from '#src/terminal-identity.js';
+import { ANSI256Color, ANSIColor, NoColor, Profile, RGBColor } from '#src/types.js';
+
+// Mock environment for testing
+class MockEnviron {
+  constructor(private env: Record<string, string> = {}) {}
+
+  getenv(key: string): string {
+    return this.env[key] || '';
+  }
+
+  environ(): string[] {
+    return Object.entries(this.env).map(([k, v]) => `${k}=${v}`);
+  }
+}
+
+function extendedStyle(profile: Profile, text = 'text'): Style {
+  const style = new Style(profile, text);
+  style.extendedUnderline = true;
+  return style;
+}
+
+describe('underline styles', () => {
+  test('renders the SGR 4 sub-parameters', () => {
+    const cases: [Parameters<Style['underlineStyle']>[0], string][] = [
+      ['none', '4:0'],
+      ['single', '4:1'],
+      ['double', '4:2'],
+      ['curly', '4:3'],
+      ['dotted', '4:4'],
+      ['dashed', '4:5'],
+    ];
+
+    for (const [kind, seq] of cases) {
+      const style = extendedStyle(Profile.TrueColor).underlineStyle(kind);
+      expect(style.toString()).toBe(`\x1b[${seq}mtext\x1b[0m`);
+    }
+  });
+
+  test('falls back to a plain underline without support', () => {
+    const style = new Style(Profile.TrueColor, 'text');
+    expect(style.underlineStyle('curly').toString()).toBe('\x1b[4mtext\x1b[0m');
+    expect(style.underlineStyle('none').toString()).toBe('text');
+  });
+
+  test('is dropped by the Ascii profile', () => {
+    expect(extendedStyle(Profile.Ascii).underlineStyle('curly').toString()).toBe('text');
+  });
+});
+
+describe('underline color', () => {
+  test('converts the color for the profile', () => {
+    const red = new RGBColor('#ff0000');
+
+    expect(extendedStyle(Profile.TrueColor).underlineColor(red).styles).toEqual(['58;2;255;0;0']);
+    expect(extendedStyle(Profile.ANSI256).underlineColor(red).styles).toEqual(['58;5;196']);
+    expect(extendedStyle(Profile.ANSI).underlineColor(red).styles).toEqual(['58;5;9']);
+    expect(extendedStyle(Profile.Ascii).underlineColor(red).styles).toEqual([]);
+  });
+
+  test('uses palette indexes for ANSI colors', () => {
+    const style = extendedStyle(Profile.TrueColor);
+    expect(style.underlineColor(new ANSIColor(1)).styles).toEqual(['58;5;1']);
+    expect(style.underlineColor(new ANSI256Color(202)).styles).toEqual(['58;5;202']);
+  });
+
+  test('combines with the underline style', () => {
+    const style = extendedStyle(Profile.TrueColor, 'typo')
+      .underlineStyle('curly')
+      .underlineColor(new RGBColor('#ff0000'));
+    expect(style.toString()).toBe('\x1b[4:3;58;2;255;0;0mtypo\x1b[0m');
+  });
+
+  test('is dropped without support', () => {
+    const style = new Style(Profile.TrueColor, 'text').underlineColor(new RGBColor('#ff0000'));
+    expect(style.styles).toEqual([]);
+  });
+
+  test('ignores missing colors', () => {
+    const style = extendedStyle(Profile.TrueColor);
+    expect(style.underlineColor(null).styles).toEqual([]);
+    expect(style.underlineColor(new NoColor()).styles).toEqual([]);
+  });
+});
+
+describe('underline support detection', () => {
+  // The fixtures are searched first, so results don't depend on the host's entries
+  const terminfo = join(import.meta.dir, 'fixtures', 'terminfo');
+
+  function detect(env: Record<string, string>, ...opts: any[]): boolean {
+    const environ = new MockEnviron(env);
+    const output = newOutput(process.stdout, withTTY(true), withEnvironment(environ), ...opts);
+    return output.string('x').underlineStyle('curly').styles[0] === '4:3';
+  }
+
+  test('detects known terminals', () => {
+    expect(detect({ TERM: 'xterm-kitty' })).toBe(true);
+    expect(detect({ TERM: 'foot' })).toBe(true);
+    expect(detect({ TERM: 'xterm-256color', TERM_PROGRAM: 'WezTerm' })).toBe(true);
+    expect(detect({ TERM: 'xterm-256color', VTE_VERSION: '7600' })).toBe(true);
+    expect(detect({ TERM: 'acme-256', TERMINFO: terminfo, VTE_VERSION: '5000' })).toBe(false);
+    expect(detect({ TERM: 'acme-256', TERMINFO: terminfo })).toBe(false);
+  });
+
+  test('detects the terminfo Smulx capability', () => {
+    expect(detect({ TERM: 'acme-256color-direct', TERMINFO: terminfo })).toBe(true);
+    expect(detect({ TERM: 'acme-256', TERMINFO: terminfo })).toBe(false);
+  });
+
+  test('uses the terminal identity', () => {
+    const kitty = identify([62, 22], [1, 4000, 1], 'kitty(0.40.0)');
+    expect(detect({ TERM: 'xterm-256color' }, withTerminalIdentity(kitty))).toBe(true);
+  });
+
+  test('can be overridden', () => {
+    expect(detect({ TERM: 'xterm-256color' }, withExtendedUnderline(true))).toBe(true);
+    expect(detect({ TERM: 'xterm-kitty' }, withExtendedUnderline(false))).toBe(false);
+  });
+
+  test('is off for non-terminals', () => {
+    const output = newOutput(
+      process.stdout,
+      withTTY(false),
+      withProfile(Profile.TrueColor),
+      withEnvironment(new MockEnviron({ TERM: 'xterm-kitty', CI: 'true' }))
+    );
+    expect(output.extendedUnderline()).toBe(false);
+  });
+});
@@ -0,0 +1,52 @@
+import { PassThrough } from 'node:stream';
+
+/**
+ * FakeTTYInput is a readable stream that pretends to be a terminal input,
+ * recording raw mode changes.
+ */
+export class FakeTTYInput extends PassThrough {
+  public isTTY = true;
+  public isRaw = false;
+  public rawModes: boolean[] = [];
+
+  setRawMode(mode: boolean): this {
+    this.isRaw = mode;
+    this.rawModes.push(mode);
+    return this;
+  }
+}
+
+/**
+ * FakeTerminal is a scripted terminal: it records everything written to it and
+ * answers known queries by writing the scripted reply to its input stream.
+ */
+export class FakeTerminal {
+  public readonly input = new FakeTTYInput();
+  public isTTY = true;
+  public output: string[] = [];
+
+  constructor(public replies: Record<string, string> = {}) {}
+
+  write(data: Uint8Array | string, callback?: (err?: Error) => void): boolean {
+    const text = typeof data === 'string' ? data : new TextDecoder().decode(data);
+    this.output.push(text);
+    if (callback) {
+      process.nextTick(() => callback());
+    }
+
+    const reply = this.replies[text];
+    if (reply !== undefined) {
+      setTimeout(() => this.input.write(reply), 1);
+    }
+    return true;
+  }
+
+  /** Type simulates the user typing while a query is in flight */
+  type(keys: string): void {
+    this.input.write(keys);
+  }
+
+  clear(): void {
+    this.output = [];
+  }
+}
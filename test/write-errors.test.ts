@@ -0,0 +1,197 @@
+import { afterEach, beforeEach, describe, expect, test } from 'bun:test';
+import { newOutput, withBuffering, withErrorHandler, withTTY } from '#src/output.js';
+import { MemoryWriter } from '#src/recording.js';
+import { ScreenControl } from '#src/screen.js';
+
+function brokenPipe(): NodeJS.ErrnoException {
+  const err: NodeJS.ErrnoException = new Error('write EPIPE');
+  err.code = 'EPIPE';
+  return err;
+}
+
+// Mock writer whose writes fail
+class FailingWriter {
+  public isTTY = true;
+  public writes = 0;
+
+  constructor(private err: Error) {}
+
+  write(_data: Uint8Array | string, callback?: (err?: Error) => void): boolean {
+    this.writes++;
+    if (callback) {
+      process.nextTick(() => callback(this.err));
+    }
+    return false;
+  }
+}
+
+function tick(): Promise<void> {
+  return new Promise((resolve) => setTimeout(resolve, 1));
+}
+
+describe('write errors', () => {
+  test('control methods hand write errors to the error handler', async () => {
+    const errors: Error[] = [];
+    const writer = new FailingWriter(new Error('stream closed'));
+    const output = newOutput(
+      writer as any,
+      withTTY(true),
+      withErrorHandler((err) => errors.push(err))
+    );
+
+    output.clearScreen();
+    output.moveCursor(1, 1);
+    output.hyperlink('https://example.com', 'example');
+    output.notify('title', 'body');
+    await tick();
+
+    expect(writer.writes).toBe(4);
+    expect(errors.length).toBe(4);
+    expect(errors[0]?.message).toBe('stream closed');
+  });
+
+  test('buffered flushes hand write errors to the error handler', async () => {
+    const errors: Error[] = [];
+    const output = newOutput(
+      new FailingWriter(brokenPipe()) as any,
+      withBuffering({ autoFlush: 'microtask' }),
+      withErrorHandler((err) => errors.push(err))
+    );
+
+    output.hideCursor();
+    output.showCursor();
+    await tick();
+
+    expect(errors.length).toBe(1);
+    expect((errors[0] as NodeJS.ErrnoException).code).toBe('EPIPE');
+  });
+
+  test('awaited writes still reject', async () => {
+    const errors: Error[] = [];
+    const output = newOutput(
+      new FailingWriter(new Error('stream closed')) as any,
+      withErrorHandler((err) => errors.push(err))
+    );
+
+    await expect(output.writeString('text')).rejects.toThrow('stream closed');
+    expect(errors).toEqual([]);
+  });
+
+  test('writes to a destroyed stream go to the error handler', async () => {
+    const errors: Error[] = [];
+    const writer = new MemoryWriter();
+    writer.destroy();
+    const output = newOutput(writer, withErrorHandler((err) => errors.push(err)));
+
+    output.clearScreen();
+    await tick();
+
+    expect(errors.length).toBe(1);
+    expect((errors[0] as NodeJS.ErrnoException).code).toBe('ERR_STREAM_DESTROYED');
+  });
+
+  test('controls work with custom outputs that only implement writeString', async () => {
+    const written: string[] = [];
+    const errors: unknown[] = [];
+    const screen = new ScreenControl({
+      writeString: async (s: string) => {
+        written.push(s);
+        return s.length;
+      },
+    } as any);
+    screen.clearLine();
+    expect(written).toEqual(['\x1b[2K']);
+
+    const failing = new ScreenControl({
+      writeString: () => Promise.reject(new Error('stream closed')),
+      handleWriteError: (err: unknown) => errors.push(err),
+    } as any);
+    failing.clearLine();
+    await tick();
+    expect(errors).toEqual([new Error('stream closed')]);
+  });
+
+  test('non-Error rejections are wrapped', () => {
+    const errors: Error[] = [];
+    const output = newOutput(
+      new FailingWriter(new Error()) as any,
+      withErrorHandler((err) => errors.push(err))
+    );
+
+    output.handleWriteError('boom');
+    expect(errors[0]).toBeInstanceOf(Error);
+    expect(errors[0]?.message).toBe('boom');
+  });
+});
+
+describe('broken pipe policy', () => {
+  const exit = process.exit;
+  let exitCodes: (number | string | null | undefined)[];
+
+  beforeEach(() => {
+    exitCodes = [];
+    process.exit = ((code?: number | string | null) => {
+      exitCodes.push(code);
+    }) as typeof process.exit;
+  });
+
+  afterEach(() => {
+    process.exit = exit;
+  });
+
+  test('exits silently on a broken stdout pipe', () => {
+    const output = newOutput(process.stdout);
+    output.handleWriteError(brokenPipe());
+    expect(exitCodes).toEqual([0]);
+  });
+
+  test('an error handler replaces the silent exit', () => {
+    const errors: Error[] = [];
+    const output = newOutput(
+      process.stdout,
+      withErrorHandler((err) => errors.push(err))
+    );
+
+    output.handleWriteError(brokenPipe());
+    expect(exitCodes).toEqual([]);
+    expect(errors.length).toBe(1);
+  });
+
+  test('other errors are rethrown', () => {
+    const output = newOutput(process.stdout);
+    expect(() => output.handleWriteError(new Error('disk full'))).toThrow('disk full');
+    expect(exitCodes).toEqual([]);
+  });
+
+  test('broken pipes on other streams are rethrown', () => {
+    const output = newOutput(new FailingWriter(brokenPipe()) as any);
+    expect(() => output.handleWriteError(brokenPipe())).toThrow('write EPIPE');
+    expect(exitCodes).toEqual([]);
+  });
+
+  test('closed streams exit silently like broken pipes', () => {
+    const output = newOutput(process.stdout);
+    const err: NodeJS.ErrnoException = new Error('Cannot call write after a stream was destroyed');
+    err.code = 'ERR_STREAM_DESTROYED';
+    output.handleWriteError(err);
+    expect(exitCodes).toEqual([0]);
+  });
+
+  test('stdout gets a single broken pipe listener from the first unawaited write', () => {
+    const before = process.stdout.listenerCount('error');
+    const output = newOutput(process.stdout);
+    newOutput(process.stdout, withErrorHandler(() => {})).send('');
+    expect(process.stdout.listenerCount('error')).toBe(before);
+
+    output.send('');
+    const guarded = process.stdout.listenerCount('error');
+    expect(guarded).toBeGreaterThan(0);
+    expect(guarded - before).toBeLessThanOrEqual(1);
+    output.send('');
+    newOutput(process.stdout).send('');
+    expect(process.stdout.listenerCount('error')).toBe(guarded);
+
+    process.stdout.emit('error', brokenPipe());
+    expect(exitCodes).toEqual([0]);
+  });
+});